@@ -17,22 +17,120 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// Issue trackers a GitHubIssue can be synced to
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	// ProviderGitea covers Forgejo too
+	ProviderGitea = "gitea"
+	ProviderJira  = "jira"
+	// ProviderBitbucket is Bitbucket Data Center, issues are pull request tasks
+	ProviderBitbucket = "bitbucket"
+)
+
 // GitHubIssueSpec defines the desired state of GitHubIssue
 type GitHubIssueSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9\_.-]+/[a-zA-Z0-9\_.-]+$
-	Repo        string `json:"repo"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	// Provider is the issue tracker hosting Repo, its address and token are
+	// part of the operator's configuration.
+	// +kubebuilder:validation:Enum=github;gitlab;gitea;jira;bitbucket
+	// +kubebuilder:default=github
+	// +optional
+	Provider string `json:"provider,omitempty"`
+	// Repo is owner/name, GitLab projects may be nested in subgroups. On Jira
+	// it is PROJECT/IssueType, e.g. OPS/Bug, and on Bitbucket PROJECT/repo/ID
+	// where ID is the pull request holding the tasks.
+	// +kubebuilder:validation:Pattern=^[a-zA-Z0-9\_.-]+(/[a-zA-Z0-9\_.-]+)+$
+	Repo  string `json:"repo"`
+	Title string `json:"title"`
+	// Description is sent verbatim as the issue body when BodyTemplate is not set.
+	// +optional
+	Description string `json:"description,omitempty"`
 	//Number      int    `json:"number,omitempty"`
+
+	// BodyTemplate is a Go text/template rendered into the issue body.
+	// When it is set, Title is rendered as a template with the same data too.
+	// +optional
+	BodyTemplate *IssueTemplate `json:"bodyTemplate,omitempty"`
+	// Values are exposed to the templates as .Values.
+	// +optional
+	Values map[string]string `json:"values,omitempty"`
+
+	// Labels of the issue, when set they replace the labels added by hand.
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+	// Assignees are usernames, when set they replace the assignees added by hand.
+	// +optional
+	Assignees []string `json:"assignees,omitempty"`
+	// Milestone is the title of an existing milestone of the repo.
+	// +optional
+	Milestone string `json:"milestone,omitempty"`
+
+	// State is the state the issue is kept in, closed closes it without
+	// deleting the GitHubIssue and open reopens it.
+	// +kubebuilder:validation:Enum=open;closed
+	// +kubebuilder:default=open
+	// +optional
+	State string `json:"state,omitempty"`
+	// Comments are posted on the issue once each, in order. Only appending
+	// is supported, status.commentsPosted counts the ones already posted.
+	// +optional
+	Comments []string `json:"comments,omitempty"`
+	// TargetRef binds the issue to an object of the GitHubIssue's namespace,
+	// the issue is open while the object is missing or not ready and closed
+	// once it is ready, whatever State says. The manager needs read access to
+	// the kind of the object.
+	// +optional
+	TargetRef *TargetReference `json:"targetRef,omitempty"`
+	// DedupKey identifies a problem reported by several GitHubIssues of the
+	// repo, or repeatedly by one. They share a single issue whose title and
+	// body are only written when it is created, afterwards only its
+	// occurrences section is kept up to date.
+	// +optional
+	DedupKey string `json:"dedupKey,omitempty"`
+}
+
+// TargetReference is the object an issue tracks, e.g. the Job of a migration
+type TargetReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	// ReadyWhen tells when the object is ready, by default when its Ready
+	// condition is True.
+	// +optional
+	ReadyWhen *ReadinessCheck `json:"readyWhen,omitempty"`
+	// OnReady is what is done once the object is ready, close closes the
+	// issue and delete deletes the GitHubIssue along with it.
+	// +kubebuilder:validation:Enum=close;delete
+	// +kubebuilder:default=close
+	// +optional
+	OnReady string `json:"onReady,omitempty"`
+}
+
+// ReadinessCheck compares a field of the target object with a value
+type ReadinessCheck struct {
+	// JSONPath is a kubectl JSONPath template, e.g. {.status.succeeded}
+	JSONPath string `json:"jsonPath"`
+	// Value is what the JSONPath renders to once the object is ready
+	Value string `json:"value"`
+}
+
+// IssueTemplate is the source of a body template, either inline or kept in a
+// ConfigMap of the GitHubIssue's namespace so that it can be shared.
+type IssueTemplate struct {
+	// +optional
+	Inline string `json:"inline,omitempty"`
+	// +optional
+	ConfigMapRef *corev1.ConfigMapKeySelector `json:"configMapRef,omitempty"`
 }
 
 // GitHubIssueStatus defines the observed state of GitHubIssue
@@ -45,6 +143,54 @@ type GitHubIssueStatus struct {
 	LastUpdateTimestamp  string `json:"updated_at,omitempty"` */
 	State                string `json:"state,omitempty"`
 	LastUpdatedTimeStamp string `json:"lastUpdatedTimeStamp,omitempty"`
+	// Number of the issue on GitHub, it saves listing the repo on the next sync.
+	Number int `json:"number,omitempty"`
+	// URL is the web page of the issue on GitHub.
+	URL string `json:"url,omitempty"`
+	// Key of the issue on trackers that identify issues by key, e.g. the Jira issue key.
+	Key string `json:"key,omitempty"`
+	// RenderedHash is the sha256 of the title and body last sent to GitHub.
+	RenderedHash string `json:"renderedHash,omitempty"`
+	// CommentsPosted is the number of spec.comments already posted on the issue.
+	// +optional
+	CommentsPosted int `json:"commentsPosted,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Plan is what would be sent to GitHub, it is only set in dry-run mode.
+	// +optional
+	Plan *IssuePlan `json:"plan,omitempty"`
+	// Occurrences are the reports of the problem of spec.dedupKey by this GitHubIssue.
+	// +optional
+	Occurrences *Occurrences `json:"occurrences,omitempty"`
+}
+
+// Occurrences counts the generations of a GitHubIssue, every update of its
+// spec is a new report of the problem
+type Occurrences struct {
+	Count     int         `json:"count"`
+	FirstSeen metav1.Time `json:"firstSeen"`
+	LastSeen  metav1.Time `json:"lastSeen"`
+	// ObservedGeneration is the generation counted last.
+	ObservedGeneration int64 `json:"observedGeneration"`
+}
+
+// IssuePlan is the action the reconciler computed but did not send to GitHub
+type IssuePlan struct {
+	// +kubebuilder:validation:Enum=create;edit;reopen;close;comment;none
+	Action string `json:"action"`
+	// +optional
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is the difference of a single issue field between GitHub and the GitHubIssue
+type FieldChange struct {
+	Field string `json:"field"`
+	// +optional
+	From string `json:"from,omitempty"`
+	// +optional
+	To string `json:"to,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,89 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GitHubIssueDigestSpec defines the desired state of GitHubIssueDigest
+type GitHubIssueDigestSpec struct {
+	// Selector selects the GitHubIssues of the digest's namespace it rolls up,
+	// an empty selector selects all of them.
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// Provider is the issue tracker of the rollup issue, github when not set.
+	// +kubebuilder:validation:Enum=github;gitlab;gitea;jira;bitbucket
+	// +optional
+	Provider string `json:"provider,omitempty"`
+	// Repo of the rollup issue, e.g. AlmogLevii/example-operator.
+	Repo  string `json:"repo"`
+	Title string `json:"title"`
+	// Description is put above the task list of the rollup issue.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Labels of the rollup issue.
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+}
+
+// GitHubIssueDigestStatus defines the observed state of GitHubIssueDigest
+type GitHubIssueDigestStatus struct {
+	// IssueName is the GitHubIssue holding the rollup issue.
+	// +optional
+	IssueName string `json:"issueName,omitempty"`
+	// URL is the web page of the rollup issue.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// State of the rollup issue, it is closed once every selected GitHubIssue is.
+	// +optional
+	State string `json:"state,omitempty"`
+	// Total is the number of selected GitHubIssues.
+	Total int `json:"total"`
+	// Closed is the number of selected GitHubIssues whose issue is closed.
+	Closed int `json:"closed"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Closed",type=integer,JSONPath=`.status.closed`
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.total`
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+
+// GitHubIssueDigest keeps a rollup issue listing the issues of the
+// GitHubIssues it selects as a task list
+type GitHubIssueDigest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitHubIssueDigestSpec   `json:"spec,omitempty"`
+	Status GitHubIssueDigestStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// GitHubIssueDigestList contains a list of GitHubIssueDigest
+type GitHubIssueDigestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitHubIssueDigest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GitHubIssueDigest{}, &GitHubIssueDigestList{})
+}
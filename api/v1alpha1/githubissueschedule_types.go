@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConcurrencyPolicy tells what happens to the issues of the previous ticks
+// when a GitHubIssueSchedule files a new one
+// +kubebuilder:validation:Enum=Keep;Close
+type ConcurrencyPolicy string
+
+const (
+	// KeepConcurrent leaves the issues of the previous ticks as they are
+	KeepConcurrent ConcurrencyPolicy = "Keep"
+	// ClosePrevious closes the issues of the previous ticks
+	ClosePrevious ConcurrencyPolicy = "Close"
+)
+
+// GitHubIssueScheduleSpec defines the desired state of GitHubIssueSchedule
+type GitHubIssueScheduleSpec struct {
+	// Schedule in Cron format, e.g. "0 9 * * 1" for every Monday at 9:00.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// TimeZone of the schedule and of the dates, an IANA name such as
+	// Europe/Paris. UTC when not set.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// StartingDeadlineSeconds is how late a missed tick can still be filed,
+	// e.g. after the manager was down. Only the last missed tick is filed.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// ConcurrencyPolicy is what happens to the issues of the previous ticks.
+	// +kubebuilder:default=Keep
+	// +optional
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// Suspend stops filing new issues, the ones filed are left as they are.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+	// ClosedHistoryLimit is the number of GitHubIssues whose issue is closed
+	// kept, the oldest are deleted. All of them are kept when not set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ClosedHistoryLimit *int32 `json:"closedHistoryLimit,omitempty"`
+	// DateFormat is the Go layout of the date appended to the title of every
+	// issue, 2006-01-02 when not set. Issues are found by title, a schedule
+	// ticking more than once a day needs the time in it too.
+	// +optional
+	DateFormat string `json:"dateFormat,omitempty"`
+
+	// IssueTemplate is the GitHubIssue filed on every tick. The date of the
+	// tick is appended to its title and exposed to its templates as
+	// .Values.date, the tick itself as .Values.scheduledTime.
+	IssueTemplate GitHubIssueTemplateSpec `json:"issueTemplate"`
+}
+
+// GitHubIssueTemplateSpec describes the GitHubIssues created from a template
+type GitHubIssueTemplateSpec struct {
+	// +optional
+	Metadata TemplateMetadata `json:"metadata,omitempty"`
+	Spec     GitHubIssueSpec  `json:"spec"`
+}
+
+// TemplateMetadata are the labels and annotations of the objects created from a template
+type TemplateMetadata struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// GitHubIssueScheduleStatus defines the observed state of GitHubIssueSchedule
+type GitHubIssueScheduleStatus struct {
+	// Active are the GitHubIssues of the schedule whose issue isn't closed.
+	// +optional
+	Active []string `json:"active,omitempty"`
+	// LastScheduleTime is the last tick an issue was filed for.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// Conditions hold InvalidSchedule, true while the schedule or the time zone can't be parsed.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+
+// GitHubIssueSchedule files a dated GitHubIssue on every tick of a Cron
+// schedule, like a CronJob runs Jobs
+type GitHubIssueSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitHubIssueScheduleSpec   `json:"spec,omitempty"`
+	Status GitHubIssueScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// GitHubIssueScheduleList contains a list of GitHubIssueSchedule
+type GitHubIssueScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitHubIssueSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GitHubIssueSchedule{}, &GitHubIssueScheduleList{})
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bitbucketOpen     = "OPEN"
+	bitbucketResolved = "RESOLVED"
+)
+
+// NewBitbucketClientFactory returns a factory of clients talking to the
+// Bitbucket Data Center instance at baseURL, e.g. https://bitbucket.example.com
+func NewBitbucketClientFactory(baseURL string, requestTimeout time.Duration) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		bitbucketClient, err := newBitbucketClient(baseURL, repo, credentials.Token, requestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &bitbucketClient, nil
+	}
+}
+
+// BitbucketClient is the GitHubClient of the tasks of a Bitbucket pull request.
+// Bitbucket has no issues, so a repo is PROJECT/repo/pull request id and the
+// issues are the blocker comments (tasks) of that pull request. A task only has
+// a text, the title is its first paragraph and the description the rest, and
+// it has no labels, assignees or milestone.
+type BitbucketClient struct {
+	restClient
+	baseURL     string
+	project     string
+	slug        string
+	pullRequest int
+}
+
+func newBitbucketClient(baseURL string, repo string, token string, requestTimeout time.Duration) (BitbucketClient, error) {
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	parts := strings.Split(repo, "/")
+	pullRequest := 0
+	if len(parts) == 3 {
+		pullRequest, _ = strconv.Atoi(parts[2])
+	}
+	if pullRequest <= 0 {
+		return BitbucketClient{}, fmt.Errorf("bitbucket repo %q is not PROJECT/repo/pull request id", repo)
+	}
+
+	return BitbucketClient{
+		restClient: restClient{
+			provider:       "Bitbucket",
+			httpClient:     http.Client{},
+			repo:           repo,
+			requestTimeout: requestTimeout,
+			authorize: func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+token)
+			},
+		},
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		project:     parts[0],
+		slug:        parts[1],
+		pullRequest: pullRequest,
+	}, nil
+}
+
+func (bb *BitbucketClient) pullRequestPath() string {
+	return fmt.Sprintf("/projects/%s/repos/%s/pull-requests/%d", bb.project, bb.slug, bb.pullRequest)
+}
+
+func (bb *BitbucketClient) tasksURL() string {
+	return bb.baseURL + "/rest/api/1.0" + bb.pullRequestPath() + "/blocker-comments"
+}
+
+func (bb *BitbucketClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	var issues []IssueData
+
+	for start := 0; ; {
+		pageURL := fmt.Sprintf("%s?state=%s&state=%s&start=%d&limit=%d", bb.tasksURL(), bitbucketOpen, bitbucketResolved, start, listPageSize)
+		body, ie := bb.connect(ctx, "GET", pageURL, nil, http.StatusOK, bb.repo)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+
+		var page struct {
+			Values        []bitbucketTask `json:"values"`
+			IsLastPage    bool            `json:"isLastPage"`
+			NextPageStart int             `json:"nextPageStart"`
+		}
+		json.Unmarshal(body, &page)
+		for _, task := range page.Values {
+			issues = append(issues, bb.issueData(task))
+		}
+
+		if page.IsLastPage || len(page.Values) == 0 {
+			return issues, ie
+		}
+		start = page.NextPageStart
+	}
+}
+
+func (bb *BitbucketClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	var realWorldIssue IssueData
+
+	task, ie := bb.get(ctx, number, fmt.Sprintf("%s#%d", bb.repo, number))
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = bb.issueData(task)
+	}
+
+	return &realWorldIssue, ie
+}
+
+func (bb *BitbucketClient) get(ctx context.Context, number int, callerID string) (bitbucketTask, *InfoError) {
+	var task bitbucketTask
+
+	body, ie := bb.connect(ctx, "GET", fmt.Sprintf("%s/%d", bb.tasksURL(), number), nil, http.StatusOK, callerID)
+	if requestSucceeded(ie.Err) {
+		json.Unmarshal(body, &task)
+	}
+
+	return task, ie
+}
+
+func (bb *BitbucketClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	var realWorldIssue IssueData
+
+	if ie := bb.checkSupported(k8sBasedIssue); !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	jsonData, _ := json.Marshal(map[string]string{"text": taskText(k8sBasedIssue)})
+	body, ie := bb.connect(ctx, "POST", bb.tasksURL(), jsonData, http.StatusCreated, k8sBasedIssue.Name)
+
+	if requestSucceeded(ie.Err) {
+		var task bitbucketTask
+		json.Unmarshal(body, &task)
+		realWorldIssue = bb.issueData(task)
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
+		ie = &iep
+	}
+
+	return &realWorldIssue, ie
+}
+
+// Update edits the task text and resolves or reopens it, Bitbucket needs the
+// version of the task it edits so the task is read first
+func (bb *BitbucketClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	var realWorldIssue IssueData
+
+	if ie := bb.checkSupported(existingIssue); !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	current, ie := bb.get(ctx, existingIssue.Number, existingIssue.Name)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+
+	state := current.State
+	switch existingIssue.State {
+	case "open":
+		state = bitbucketOpen
+	case "closed":
+		state = bitbucketResolved
+	}
+	task, ie := bb.put(ctx, current, taskText(existingIssue), state, existingIssue.Name)
+
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = bb.issueData(task)
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+		ie = &iep
+	}
+
+	return &realWorldIssue, ie
+}
+
+func (bb *BitbucketClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+	current, ie := bb.get(ctx, existIssue.Number, existIssue.Name)
+	if !requestSucceeded(ie.Err) || current.State == bitbucketResolved {
+		return ie
+	}
+
+	_, ie = bb.put(ctx, current, current.Text, bitbucketResolved, existIssue.Name)
+	return ie
+}
+
+func (bb *BitbucketClient) put(ctx context.Context, current bitbucketTask, text string, state string, callerID string) (bitbucketTask, *InfoError) {
+	var task bitbucketTask
+
+	jsonData, _ := json.Marshal(map[string]interface{}{"text": text, "state": state, "version": current.Version})
+	body, ie := bb.connect(ctx, "PUT", fmt.Sprintf("%s/%d", bb.tasksURL(), current.ID), jsonData, http.StatusOK, callerID)
+	if requestSucceeded(ie.Err) {
+		json.Unmarshal(body, &task)
+	}
+
+	return task, ie
+}
+
+// checkSupported fails on the managed fields tasks don't have, rather than silently dropping them
+func (bb *BitbucketClient) checkSupported(issue IssueData) *InfoError {
+	if len(issue.Labels) == 0 && len(issue.Assignees) == 0 && isEmpty(issue.Milestone) {
+		return &InfoError{}
+	}
+	iep := newInfoError(fmt.Errorf("labels, assignees and milestone of Bitbucket tasks are %w", errNotSupported), fmt.Sprintf("%s - failed to map the issue onto a task", issue.Name))
+	return &iep
+}
+
+// bitbucketTask is a blocker comment of a pull request
+type bitbucketTask struct {
+	ID          int    `json:"id"`
+	Version     int    `json:"version"`
+	Text        string `json:"text"`
+	State       string `json:"state"`
+	UpdatedDate int64  `json:"updatedDate"`
+}
+
+func (bb *BitbucketClient) issueData(task bitbucketTask) IssueData {
+	title := task.Text
+	description := ""
+	if paragraphs := strings.SplitN(task.Text, "\n\n", 2); len(paragraphs) == 2 {
+		title, description = paragraphs[0], paragraphs[1]
+	}
+
+	issue := IssueData{
+		Title:       title,
+		Description: description,
+		Number:      task.ID,
+		State:       "open",
+		URL:         fmt.Sprintf("%s%s/overview?commentId=%d", bb.baseURL, bb.pullRequestPath(), task.ID),
+	}
+	if task.State == bitbucketResolved {
+		issue.State = "closed"
+	}
+	if task.UpdatedDate > 0 {
+		issue.LastUpdatedTimeStamp = time.Unix(0, task.UpdatedDate*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+	}
+	return issue
+}
+
+// taskText is the title of issue, followed by its description as a second paragraph
+func taskText(issue IssueData) string {
+	if isEmpty(issue.Description) {
+		return issue.Title
+	}
+	return issue.Title + "\n\n" + issue.Description
+}
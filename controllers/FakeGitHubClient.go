@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FakeGitHubClient is an in-memory GitHubClient of a single repo, for tests.
+// It follows the GitHub API behaviour without any network access.
+type FakeGitHubClient struct {
+	Repo string
+	// Err, when set, fails every call
+	Err error
+
+	mu       sync.Mutex
+	issues   []IssueData
+	comments map[int][]string
+	calls    []string
+}
+
+// NewFakeGitHubClient returns a fake of repo that already holds issues
+func NewFakeGitHubClient(repo string, issues ...IssueData) *FakeGitHubClient {
+	fake := &FakeGitHubClient{Repo: repo}
+	for _, issue := range issues {
+		if issue.Number == 0 {
+			issue.Number = len(fake.issues) + 1
+		}
+		if isEmpty(issue.State) {
+			issue.State = "open"
+		}
+		if isEmpty(issue.URL) {
+			issue.URL = fake.issueURL(issue.Number)
+		}
+		fake.issues = append(fake.issues, issue)
+	}
+	return fake
+}
+
+// NewFakeGitHubClientFactory resolves every repo to its fake whatever the
+// provider, an unknown repo is an error
+func NewFakeGitHubClientFactory(fakes ...*FakeGitHubClient) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		for _, fake := range fakes {
+			if fake.Repo == repo {
+				return fake, nil
+			}
+		}
+		return nil, fmt.Errorf("no fake GitHub client for repo %s", repo)
+	}
+}
+
+// Issues is a copy of the issues currently held by the fake
+func (f *FakeGitHubClient) Issues() []IssueData {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]IssueData(nil), f.issues...)
+}
+
+// Calls are the mutating calls the fake received in order, e.g. "create #1"
+func (f *FakeGitHubClient) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Comments are the comments posted on the issue with number
+func (f *FakeGitHubClient) Comments(number int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.comments[number]...)
+}
+
+func (f *FakeGitHubClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ie := f.fail(f.Repo); ie != nil {
+		return nil, ie
+	}
+	return append([]IssueData(nil), f.issues...), &InfoError{}
+}
+
+func (f *FakeGitHubClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ie := f.fail(f.Repo); ie != nil {
+		return &IssueData{}, ie
+	}
+	i, ie := f.find(number)
+	if !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	issue := f.issues[i]
+	return &issue, ie
+}
+
+func (f *FakeGitHubClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ie := f.fail(k8sBasedIssue.Name); ie != nil {
+		return &IssueData{}, ie
+	}
+	issue := k8sBasedIssue
+	issue.Number = len(f.issues) + 1
+	issue.State = "open"
+	issue.URL = f.issueURL(issue.Number)
+	issue.LastUpdatedTimeStamp = time.Now().UTC().Format(time.RFC3339)
+	f.issues = append(f.issues, issue)
+	f.calls = append(f.calls, fmt.Sprintf("create #%d", issue.Number))
+
+	ie := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
+	return &issue, &ie
+}
+
+func (f *FakeGitHubClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ie := f.fail(existingIssue.Name); ie != nil {
+		return &IssueData{}, ie
+	}
+	issue, ie := f.update(existingIssue.Number, func(issue *IssueData) {
+		issue.Title = existingIssue.Title
+		issue.Description = existingIssue.Description
+		if !isEmpty(existingIssue.State) {
+			issue.State = existingIssue.State
+		}
+		if len(existingIssue.Labels) > 0 {
+			issue.Labels = existingIssue.Labels
+		}
+		if len(existingIssue.Assignees) > 0 {
+			issue.Assignees = existingIssue.Assignees
+		}
+		if !isEmpty(existingIssue.Milestone) {
+			issue.Milestone = existingIssue.Milestone
+		}
+	})
+	if requestSucceeded(ie.Err) {
+		f.calls = append(f.calls, fmt.Sprintf("update #%d", issue.Number))
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+		ie = &iep
+	}
+	return issue, ie
+}
+
+func (f *FakeGitHubClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ie := f.fail(existIssue.Name); ie != nil {
+		return ie
+	}
+	issue, ie := f.update(existIssue.Number, func(issue *IssueData) {
+		issue.State = "closed"
+	})
+	if requestSucceeded(ie.Err) {
+		f.calls = append(f.calls, fmt.Sprintf("close #%d", issue.Number))
+	}
+	return ie
+}
+
+func (f *FakeGitHubClient) Comment(ctx context.Context, issue IssueData, body string) *InfoError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ie := f.fail(issue.Name); ie != nil {
+		return ie
+	}
+	if _, ie := f.find(issue.Number); !requestSucceeded(ie.Err) {
+		return ie
+	}
+	if f.comments == nil {
+		f.comments = map[int][]string{}
+	}
+	f.comments[issue.Number] = append(f.comments[issue.Number], body)
+	f.calls = append(f.calls, fmt.Sprintf("comment #%d", issue.Number))
+	return &InfoError{}
+}
+
+// update applies change to the issue with number and returns a copy of it, f.mu must be held
+func (f *FakeGitHubClient) update(number int, change func(issue *IssueData)) (*IssueData, *InfoError) {
+	i, ie := f.find(number)
+	if !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	change(&f.issues[i])
+	f.issues[i].LastUpdatedTimeStamp = time.Now().UTC().Format(time.RFC3339)
+	issue := f.issues[i]
+	return &issue, ie
+}
+
+// find is the index of the issue with number, f.mu must be held
+func (f *FakeGitHubClient) find(number int) (int, *InfoError) {
+	for i := range f.issues {
+		if f.issues[i].Number == number {
+			return i, &InfoError{}
+		}
+	}
+	ie := newInfoError(&apiError{StatusCode: http.StatusNotFound, Message: "Not Found"}, fmt.Sprintf("%s#%d - Actual status code: 404", f.Repo, number))
+	return -1, &ie
+}
+
+func (f *FakeGitHubClient) fail(callerID string) *InfoError {
+	if f.Err == nil {
+		return nil
+	}
+	ie := newInfoError(f.Err, fmt.Sprintf("%s - fake GitHub client failure", callerID))
+	return &ie
+}
+
+func (f *FakeGitHubClient) issueURL(number int) string {
+	return fmt.Sprintf("https://github.com/%s/issues/%d", f.Repo, number)
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const frontMatterDelimiter = "---\n"
+
+// NewFileClientFactory returns a factory of clients writing the issues of
+// every provider as Markdown files under dir, for clusters that can't reach
+// their issue tracker. The files are synced to the tracker out of band.
+func NewFileClientFactory(dir string) GitHubClientFactory {
+	// the clients of a directory share a lock so that two creates never get the same number
+	lock := &sync.Mutex{}
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		fileClient, err := newFileClient(dir, provider, repo, lock)
+		if err != nil {
+			return nil, err
+		}
+		return &fileClient, nil
+	}
+}
+
+// FileClient is the GitHubClient of the directory dir/provider/repo, each
+// issue is a Markdown file named after its number whose YAML front matter
+// holds everything but the description, e.g. dir/github/owner/name/0012.md.
+// The comments are appended to the front matter in the order they were posted.
+type FileClient struct {
+	provider string
+	repo     string
+	dir      string
+	lock     *sync.Mutex
+	now      func() time.Time
+}
+
+func newFileClient(dir string, provider string, repo string, lock *sync.Mutex) (FileClient, error) {
+	for _, segment := range strings.Split(repo, "/") {
+		// the repo pattern of the CRD lets . and .. through
+		if segment == "" || segment == "." || segment == ".." {
+			return FileClient{}, fmt.Errorf("repo %q can't be used as a directory", repo)
+		}
+	}
+
+	return FileClient{
+		provider: provider,
+		repo:     repo,
+		dir:      filepath.Join(dir, provider, filepath.FromSlash(repo)),
+		lock:     lock,
+		now:      time.Now,
+	}, nil
+}
+
+// fileIssue is the front matter of an issue file
+type fileIssue struct {
+	Provider  string        `json:"provider"`
+	Repo      string        `json:"repo"`
+	Number    int           `json:"number"`
+	Title     string        `json:"title"`
+	State     string        `json:"state"`
+	UpdatedAt string        `json:"updated_at"`
+	Labels    []string      `json:"labels,omitempty"`
+	Assignees []string      `json:"assignees,omitempty"`
+	Milestone string        `json:"milestone,omitempty"`
+	Comments  []fileComment `json:"comments,omitempty"`
+}
+
+type fileComment struct {
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (fc *FileClient) path(number int) string {
+	return filepath.Join(fc.dir, fmt.Sprintf("%04d.md", number))
+}
+
+func (fc *FileClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	numbers, ie := fc.numbers()
+	if !requestSucceeded(ie.Err) {
+		return nil, ie
+	}
+
+	var issues []IssueData
+	for _, number := range numbers {
+		issue, ie := fc.read(number, fc.repo)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+		issues = append(issues, *issue)
+	}
+	return issues, &InfoError{}
+}
+
+func (fc *FileClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	return fc.read(number, fmt.Sprintf("%s#%d", fc.repo, number))
+}
+
+// Create writes the issue with the number following the highest one of the repo
+func (fc *FileClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	numbers, ie := fc.numbers()
+	if !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	issue := k8sBasedIssue
+	issue.Number = 1
+	if len(numbers) > 0 {
+		issue.Number = numbers[len(numbers)-1] + 1
+	}
+	issue.State = "open"
+
+	if ie := fc.write(&issue, nil, k8sBasedIssue.Name); !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	iep := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
+	return &issue, &iep
+}
+
+func (fc *FileClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	issue, comments, ie := fc.readFile(existingIssue.Number, existingIssue.Name)
+	if !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	issue.Title = existingIssue.Title
+	issue.Description = existingIssue.Description
+	if !isEmpty(existingIssue.State) {
+		issue.State = existingIssue.State
+	}
+	if len(existingIssue.Labels) > 0 {
+		issue.Labels = existingIssue.Labels
+	}
+	if len(existingIssue.Assignees) > 0 {
+		issue.Assignees = existingIssue.Assignees
+	}
+	if !isEmpty(existingIssue.Milestone) {
+		issue.Milestone = existingIssue.Milestone
+	}
+
+	if ie := fc.write(issue, comments, existingIssue.Name); !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+	return issue, &iep
+}
+
+func (fc *FileClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	issue, comments, ie := fc.readFile(existIssue.Number, existIssue.Name)
+	if !requestSucceeded(ie.Err) || issue.State == "closed" {
+		return ie
+	}
+	issue.State = "closed"
+	return fc.write(issue, comments, existIssue.Name)
+}
+
+// Comment appends the comment to the file of the issue
+func (fc *FileClient) Comment(ctx context.Context, issue IssueData, body string) *InfoError {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	existing, comments, ie := fc.readFile(issue.Number, issue.Name)
+	if !requestSucceeded(ie.Err) {
+		return ie
+	}
+	comments = append(comments, fileComment{Body: body, CreatedAt: fc.now().UTC().Format(time.RFC3339)})
+	return fc.write(existing, comments, issue.Name)
+}
+
+// numbers are the sorted numbers of the issue files of the repo, a repo that
+// has no directory yet has no issues
+func (fc *FileClient) numbers() ([]int, *InfoError) {
+	entries, err := ioutil.ReadDir(fc.dir)
+	if os.IsNotExist(err) {
+		return nil, &InfoError{}
+	}
+	if err != nil {
+		iep := newInfoError(err, fmt.Sprintf("%s - failed to list the issue files", fc.repo))
+		return nil, &iep
+	}
+
+	var numbers []int
+	for _, entry := range entries {
+		number, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".md"))
+		if err == nil && number > 0 && !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers, &InfoError{}
+}
+
+func (fc *FileClient) read(number int, callerID string) (*IssueData, *InfoError) {
+	issue, _, ie := fc.readFile(number, callerID)
+	return issue, ie
+}
+
+// readFile is the issue of the file and its comments
+func (fc *FileClient) readFile(number int, callerID string) (*IssueData, []fileComment, *InfoError) {
+	path := fc.path(number)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		iep := newInfoError(err, fmt.Sprintf("%s - failed to read the issue file", callerID))
+		return &IssueData{}, nil, &iep
+	}
+
+	var front fileIssue
+	description, err := parseFrontMatter(data, &front)
+	if err != nil {
+		iep := newInfoError(fmt.Errorf("%s: %w", path, err), fmt.Sprintf("%s - failed to parse the issue file", callerID))
+		return &IssueData{}, nil, &iep
+	}
+	return &IssueData{
+		Title:                front.Title,
+		Description:          description,
+		Number:               number,
+		State:                front.State,
+		LastUpdatedTimeStamp: front.UpdatedAt,
+		URL:                  "file://" + filepath.ToSlash(path),
+		Labels:               front.Labels,
+		Assignees:            front.Assignees,
+		Milestone:            front.Milestone,
+	}, front.Comments, &InfoError{}
+}
+
+// write replaces the file of issue through a rename, so that the out of band
+// sync never reads half an issue, and sets its timestamp and URL
+func (fc *FileClient) write(issue *IssueData, comments []fileComment, callerID string) *InfoError {
+	issue.LastUpdatedTimeStamp = fc.now().UTC().Format(time.RFC3339)
+	front, _ := yaml.Marshal(fileIssue{
+		Provider:  fc.provider,
+		Repo:      fc.repo,
+		Number:    issue.Number,
+		Title:     issue.Title,
+		State:     issue.State,
+		UpdatedAt: issue.LastUpdatedTimeStamp,
+		Labels:    issue.Labels,
+		Assignees: issue.Assignees,
+		Milestone: issue.Milestone,
+		Comments:  comments,
+	})
+	content := frontMatterDelimiter + string(front) + frontMatterDelimiter
+	if !isEmpty(issue.Description) {
+		content += "\n" + issue.Description
+	}
+
+	path := fc.path(issue.Number)
+	if err := writeFileAtomically(path, []byte(content)); err != nil {
+		iep := newInfoError(err, fmt.Sprintf("%s - failed to write the issue file", callerID))
+		return &iep
+	}
+	issue.URL = "file://" + filepath.ToSlash(path)
+	return &InfoError{}
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// parseFrontMatter decodes the YAML front matter of a Markdown file into v and
+// returns the rest, without the blank line following the front matter
+func parseFrontMatter(data []byte, v interface{}) (string, error) {
+	if !bytes.HasPrefix(data, []byte(frontMatterDelimiter)) {
+		return "", fmt.Errorf("no front matter")
+	}
+	rest := data[len(frontMatterDelimiter):]
+	end := bytes.Index(rest, []byte("\n"+frontMatterDelimiter))
+	if end < 0 {
+		return "", fmt.Errorf("the front matter isn't closed")
+	}
+	if err := yaml.Unmarshal(rest[:end+1], v); err != nil {
+		return "", err
+	}
+	body := rest[end+1+len(frontMatterDelimiter):]
+	return string(bytes.TrimPrefix(body, []byte("\n"))), nil
+}
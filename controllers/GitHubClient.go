@@ -1,50 +1,121 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"strings"
-
-	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"time"
 )
 
+// GitHubClient is the issue-tracker API of a single repo. Matching, finalizers
+// and the rest of the orchestration are done by the reconciler, so another
+// backend only has to implement these calls.
+// Calls are bound to ctx, cancelling it aborts the in-flight request.
 type GitHubClient interface {
-	IsExist(k8sBasedIssue IssueData) (bool, *IssueData, *InfoError)
-	Create(k8sBasedIssue IssueData) (*IssueData, *InfoError)
-	EditIfNeeded(k8sBasedIssue IssueData, existIssue IssueData) (*IssueData, *InfoError)
-	Close(existIssue IssueData) *InfoError
-	DeleteIfNeeded(ghIssue examplev1alpha1.GitHubIssue, r *GitHubIssueReconciler, issueExist bool, ctx context.Context, existingIssue IssueData) (bool, *InfoError)
+	// List returns the open and closed issues of the repo
+	List(ctx context.Context) ([]IssueData, *InfoError)
+	Get(ctx context.Context, number int) (*IssueData, *InfoError)
+	Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError)
+	// Update sends the title, body, state and the set labels, assignees and
+	// milestone of existingIssue, found by its number
+	Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError)
+	Close(ctx context.Context, existIssue IssueData) *InfoError
+}
+
+// Commenter is implemented by the GitHubClients of trackers with comments,
+// spec.comments are posted through it
+type Commenter interface {
+	Comment(ctx context.Context, issue IssueData, body string) *InfoError
+}
+
+// errNotSupported is returned when the spec asks for something the issue tracker doesn't have
+var errNotSupported = errors.New("not supported by the issue tracker")
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultAPIURL         = "https://api.github.com"
+	// listPageSize is the largest page GitHub serves
+	listPageSize = 100
+)
+
+// Credentials authenticate a GitHubClient against the issue tracker
+type Credentials struct {
+	Token string
+	// Username is only used by trackers that take the token as a password
+	Username string
+}
+
+// GitHubClientFactory resolves the GitHubClient that serves repo of provider with the given credentials
+type GitHubClientFactory func(provider string, repo string, credentials Credentials) (GitHubClient, error)
+
+// NewProviderClientFactory dispatches to the factory of each provider
+func NewProviderClientFactory(factories map[string]GitHubClientFactory) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		factory, found := factories[provider]
+		if !found {
+			return nil, fmt.Errorf("issue tracker provider %q is not configured", provider)
+		}
+		return factory(provider, repo, credentials)
+	}
+}
+
+// NewRealGitHubClientFactory returns a factory of clients talking to the GitHub
+// API at apiURL, an empty apiURL is https://api.github.com
+func NewRealGitHubClientFactory(apiURL string, requestTimeout time.Duration) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		realClient := newRealGitHubClient(apiURL, repo, credentials.Token, requestTimeout)
+		return &realClient, nil
+	}
 }
 
 type RealGitHubClient struct {
-	httpClient http.Client
-	token      string
-	repo       string
+	restClient
+	apiURL string
 }
 
-func newRealGitHubClient(repoURL string) RealGitHubClient {
+func newRealGitHubClient(apiURL string, repoURL string, token string, requestTimeout time.Duration) RealGitHubClient {
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	if isEmpty(apiURL) {
+		apiURL = defaultAPIURL
+	}
 	return RealGitHubClient{
-		httpClient: http.Client{},
-		token:      os.Getenv("GITOKEN"),
-		repo:       repoURL,
+		restClient: restClient{
+			provider:       "GitHub",
+			httpClient:     http.Client{},
+			repo:           repoURL,
+			requestTimeout: requestTimeout,
+			authorize: func(req *http.Request) {
+				req.Header.Set("Authorization", "token "+token)
+			},
+		},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
 	}
 }
 
-func (rc *RealGitHubClient) Create(k8sBasedIssue IssueData) (*IssueData, *InfoError) {
-	apiURL := getApiUrl(rc.repo)
-	jsonData, _ := json.Marshal(&k8sBasedIssue)
+// issuesURL is the issues endpoint of the client's repo
+func (rc *RealGitHubClient) issuesURL() string {
+	return rc.apiURL + "/repos/" + rc.repo + "/issues"
+}
+
+func (rc *RealGitHubClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	apiURL := rc.issuesURL()
 	var realWorldIssue IssueData
 
-	body, ie := rc.connect("POST", apiURL, jsonData, http.StatusCreated, k8sBasedIssue.Name)
+	jsonData, ie := rc.issueRequest(ctx, k8sBasedIssue)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	body, ie := rc.connect(ctx, "POST", apiURL, jsonData, http.StatusCreated, k8sBasedIssue.Name)
 
 	if requestSucceeded(ie.Err) {
-		json.Unmarshal(body, &realWorldIssue)
+		realWorldIssue = decodeGitHubIssue(body)
 
 		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
 		ie = &iep
@@ -53,157 +124,207 @@ func (rc *RealGitHubClient) Create(k8sBasedIssue IssueData) (*IssueData, *InfoEr
 	return &realWorldIssue, ie
 }
 
-func (rc *RealGitHubClient) EditIfNeeded(k8sBasedIssue IssueData, existingIssue IssueData) (*IssueData, *InfoError) {
-	apiURL := getApiUrl(rc.repo) + fmt.Sprintf("/%d", existingIssue.Number)
-	needEdit := existingIssue.Description != k8sBasedIssue.Description || existingIssue.State == "closed"
-
-	var realWorldIssue *IssueData
-	ie := &(InfoError{})
-
-	if needEdit {
-
-		existingIssue.Description = k8sBasedIssue.Description
-		existingIssue.State = "open"
-
-		jsonData, _ := json.Marshal(&existingIssue)
-		body, ie := rc.connect("PATCH", apiURL, jsonData, http.StatusOK, k8sBasedIssue.Name)
+func (rc *RealGitHubClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	apiURL := rc.issuesURL() + fmt.Sprintf("/%d", number)
+	var realWorldIssue IssueData
 
-		if requestSucceeded(ie.Err) {
-			json.Unmarshal(body, &realWorldIssue)
-			iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", k8sBasedIssue.Name))
-			ie = &iep
-		}
+	body, ie := rc.connect(ctx, "GET", apiURL, nil, http.StatusOK, fmt.Sprintf("%s#%d", rc.repo, number))
 
-	} else {
-		realWorldIssue = &existingIssue
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = decodeGitHubIssue(body)
 	}
 
-	return realWorldIssue, ie
+	return &realWorldIssue, ie
 }
 
-func (rc *RealGitHubClient) IsExist(k8sBasedIssue IssueData) (bool, *IssueData, *InfoError) {
-
-	exist := false
-	existingIssue := &k8sBasedIssue
+func (rc *RealGitHubClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	apiURL := rc.issuesURL() + fmt.Sprintf("/%d", existingIssue.Number)
+	var realWorldIssue IssueData
 
-	issues, ie := rc.getIssuesList(getApiUrl(rc.repo), k8sBasedIssue.Name)
+	jsonData, ie := rc.issueRequest(ctx, existingIssue)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	body, ie := rc.connect(ctx, "PATCH", apiURL, jsonData, http.StatusOK, existingIssue.Name)
 
 	if requestSucceeded(ie.Err) {
-
-		for _, issue := range issues {
-			if issue.Title == k8sBasedIssue.Title {
-				exist = true
-				existingIssue = &issue
-				break
-			}
-		}
+		realWorldIssue = decodeGitHubIssue(body)
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+		ie = &iep
 	}
 
-	return exist, existingIssue, ie
+	return &realWorldIssue, ie
 }
 
-func (rc *RealGitHubClient) Close(existIssue IssueData) *InfoError {
+func (rc *RealGitHubClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	return rc.getIssuesList(ctx, rc.issuesURL(), rc.repo)
+}
 
-	apiURL := getApiUrl(rc.repo) + fmt.Sprintf("/%d", existIssue.Number)
+func (rc *RealGitHubClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+
+	apiURL := rc.issuesURL() + fmt.Sprintf("/%d", existIssue.Number)
 	existIssue.State = "closed"
 	jsonData, _ := json.Marshal(&existIssue)
 
-	_, ie := rc.connect("PATCH", apiURL, jsonData, http.StatusOK, existIssue.Name)
+	_, ie := rc.connect(ctx, "PATCH", apiURL, jsonData, http.StatusOK, existIssue.Name)
 
 	return ie
 }
 
-func (rc *RealGitHubClient) getIssuesList(apiURL string, callerID string) ([]IssueData, *InfoError) {
-	query := "?state=all"
-	apiURL += query
+func (rc *RealGitHubClient) Comment(ctx context.Context, issue IssueData, body string) *InfoError {
+	apiURL := rc.issuesURL() + fmt.Sprintf("/%d/comments", issue.Number)
+	jsonData, _ := json.Marshal(map[string]string{"body": body})
 
-	ownerAndRepo := strings.Split(apiURL, "/")
+	_, ie := rc.connect(ctx, "POST", apiURL, jsonData, http.StatusCreated, issue.Name)
 
-	jsonData, _ := json.Marshal(struct {
-		Repo  string
-		Owner string
-	}{
-		Repo:  ownerAndRepo[0],
-		Owner: ownerAndRepo[1],
-	})
+	return ie
+}
 
+// getIssuesList follows the pages of the list until a page comes back short
+func (rc *RealGitHubClient) getIssuesList(ctx context.Context, apiURL string, callerID string) ([]IssueData, *InfoError) {
 	var issues []IssueData
 
-	body, ie := rc.connect("GET", apiURL, jsonData, http.StatusOK, callerID)
+	for page := 1; ; page++ {
+		pageURL := fmt.Sprintf("%s?state=all&per_page=%d&page=%d", apiURL, listPageSize, page)
+		body, ie := rc.connect(ctx, "GET", pageURL, nil, http.StatusOK, callerID)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
 
-	if requestSucceeded(ie.Err) {
-		json.Unmarshal(body, &issues)
-	}
+		var pageIssues []githubIssue
+		json.Unmarshal(body, &pageIssues)
+		for _, issue := range pageIssues {
+			issues = append(issues, issue.issueData())
+		}
 
-	return issues, ie
+		if len(pageIssues) < listPageSize {
+			return issues, ie
+		}
+	}
 }
 
-func (rc *RealGitHubClient) connect(method string, apiURL string, jsonData []byte, desireStatusCode int, callerID string) ([]byte, *InfoError) {
-	client := rc.httpClient
-	req, _ := http.NewRequest(method, apiURL, bytes.NewReader(jsonData))
-	req.Header.Set("Authorization", "token "+rc.token)
-	resp, err := client.Do(req)
-	var ie InfoError
-	var body []byte
+// githubIssue is the GitHub representation of an issue
+type githubIssue struct {
+	IssueData
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Assignees []struct {
+		Login string `json:"login"`
+	} `json:"assignees"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+}
 
-	if !requestSucceeded(err) {
-		ie = newInfoError(err, fmt.Sprintf("%s - failed to connect with %s method", callerID, method))
-	} else {
+func decodeGitHubIssue(body []byte) IssueData {
+	var issue githubIssue
+	json.Unmarshal(body, &issue)
+	return issue.issueData()
+}
 
-		defer resp.Body.Close()
+func (gi githubIssue) issueData() IssueData {
+	issue := gi.IssueData
+	for _, label := range gi.Labels {
+		issue.Labels = append(issue.Labels, label.Name)
+	}
+	for _, assignee := range gi.Assignees {
+		issue.Assignees = append(issue.Assignees, assignee.Login)
+	}
+	if gi.Milestone != nil {
+		issue.Milestone = gi.Milestone.Title
+	}
+	return issue
+}
 
-		if resp.StatusCode != desireStatusCode {
-			ie = newInfoError(err, fmt.Sprintf("%s - Actual status code: %d. \t Expected: %d", callerID, resp.StatusCode, desireStatusCode))
-		} else {
-			body, _ = ioutil.ReadAll(resp.Body)
+// issueRequest is the body of a create or edit of issue, GitHub refers to the milestone by its number
+func (rc *RealGitHubClient) issueRequest(ctx context.Context, issue IssueData) ([]byte, *InfoError) {
+	request := struct {
+		IssueData
+		Labels    []string `json:"labels,omitempty"`
+		Assignees []string `json:"assignees,omitempty"`
+		Milestone int      `json:"milestone,omitempty"`
+	}{IssueData: issue, Labels: issue.Labels, Assignees: issue.Assignees}
+
+	if !isEmpty(issue.Milestone) {
+		number, ie := rc.milestoneNumber(ctx, issue.Milestone, issue.Name)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
 		}
+		request.Milestone = number
 	}
 
-	return body, &ie
+	jsonData, _ := json.Marshal(&request)
+	return jsonData, &InfoError{}
 }
 
-func (rc *RealGitHubClient) DeleteIfNeeded(ghIssue examplev1alpha1.GitHubIssue, r *GitHubIssueReconciler, issueExist bool, ctx context.Context, existingIssue IssueData) (bool, *InfoError) {
-	needToReturn := false
-	ie := InfoError{}
-	finalizer := "example.training.redhat.com/finalizer"
+// milestoneNumber follows the pages of the milestones until title is found
+// or a page comes back short
+func (rc *RealGitHubClient) milestoneNumber(ctx context.Context, title string, callerID string) (int, *InfoError) {
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("%s/repos/%s/milestones?state=all&per_page=%d&page=%d", rc.apiURL, rc.repo, listPageSize, page)
+		body, ie := rc.connect(ctx, "GET", apiURL, nil, http.StatusOK, callerID)
+		if !requestSucceeded(ie.Err) {
+			return 0, ie
+		}
 
-	if ghIssue.ObjectMeta.DeletionTimestamp.IsZero() {
-		// The object is not being deleted, so if it does not have our finalizer,
-		// then lets add the finalizer and update the object.
-		// This is equivalent registering our finalizer.
-		if !containsString(ghIssue.GetFinalizers(), finalizer) {
-			controllerutil.AddFinalizer(&ghIssue, finalizer)
-			if err := r.Update(ctx, &ghIssue); err != nil {
-				ie = newInfoError(err, fmt.Sprintf("%s - failed to update the finalizer", ghIssue.Name))
-				needToReturn = true
-			}
+		var milestones []struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
 		}
-	} else {
-		// The object is being deleted
-		if containsString(ghIssue.GetFinalizers(), finalizer) {
-			// our finalizer is present, so lets handle any external dependency
-			// if the issue isn't on github, skip the external handle and just remove finalizer
-			if issueExist {
-				if ierr := rc.Close(existingIssue); ierr.Err != nil {
-					// if fail to delete the external dependency here, return with error
-					// so that it can be retried
-					ie = newInfoError(ierr.Err, fmt.Sprintf("%s - failed to delete the external dependency", ghIssue.Name))
-					needToReturn = true
-				}
-			}
-			if !needToReturn {
-				// remove our finalizer from the list and update it.
-				controllerutil.RemoveFinalizer(&ghIssue, finalizer)
-				if err := r.Update(ctx, &ghIssue); err != nil {
-					ie = newInfoError(err, fmt.Sprintf("%s - failed to update the list after removal our finalizer", ghIssue.Name))
-					needToReturn = true
-				}
+		json.Unmarshal(body, &milestones)
+		for _, milestone := range milestones {
+			if milestone.Title == title {
+				return milestone.Number, ie
 			}
 		}
-		// Stop reconciliation as the item is being deleted
-		needToReturn = true
-		ie = newInfoError(nil, fmt.Sprintf("%s - Issue was deleted successfully", ghIssue.Name))
+
+		if len(milestones) < listPageSize {
+			iep := newInfoError(fmt.Errorf("milestone %q not found in %s", title, rc.repo), fmt.Sprintf("%s - failed to find the milestone", callerID))
+			return 0, &iep
+		}
 	}
+}
+
+// apiError is a response of the issue tracker with an unexpected status code
+type apiError struct {
+	// Provider names the issue tracker, e.g. GitHub
+	Provider    string
+	StatusCode  int
+	Message     string
+	RateLimited bool
+}
+
+func newAPIError(provider string, resp *http.Response) *apiError {
+	var payload struct {
+		Message string `json:"message"`
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(body, &payload)
+
+	// GitHub answers 403 for both missing permissions and exhausted (or secondary) rate limits
+	rateLimited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && (resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""))
+
+	return &apiError{
+		Provider:    provider,
+		StatusCode:  resp.StatusCode,
+		Message:     payload.Message,
+		RateLimited: rateLimited,
+	}
+}
+
+func (e *apiError) Error() string {
+	provider := e.Provider
+	if isEmpty(provider) {
+		provider = "the issue tracker"
+	}
+	if isEmpty(e.Message) {
+		return fmt.Sprintf("%s responded with status code %d", provider, e.StatusCode)
+	}
+	return fmt.Sprintf("%s responded with status code %d: %s", provider, e.StatusCode, e.Message)
+}
 
-	return needToReturn, &ie
+func (e *apiError) isAuthFailure() bool {
+	return e.StatusCode == http.StatusUnauthorized || (e.StatusCode == http.StatusForbidden && !e.RateLimited)
 }
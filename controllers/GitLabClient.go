@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultGitLabURL = "https://gitlab.com/api/v4"
+
+// NewGitLabClientFactory returns a factory of clients talking to the GitLab
+// API at apiURL, e.g. https://gitlab.example.com/api/v4
+func NewGitLabClientFactory(apiURL string, requestTimeout time.Duration) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		gitLabClient := newGitLabClient(apiURL, repo, credentials.Token, requestTimeout)
+		return &gitLabClient, nil
+	}
+}
+
+// GitLabClient is the GitHubClient of a GitLab project, the issue numbers are
+// the project-scoped iids
+type GitLabClient struct {
+	restClient
+	apiURL string
+}
+
+func newGitLabClient(apiURL string, project string, token string, requestTimeout time.Duration) GitLabClient {
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	if isEmpty(apiURL) {
+		apiURL = defaultGitLabURL
+	}
+	return GitLabClient{
+		restClient: restClient{
+			provider:       "GitLab",
+			httpClient:     http.Client{},
+			repo:           project,
+			requestTimeout: requestTimeout,
+			authorize: func(req *http.Request) {
+				req.Header.Set("PRIVATE-TOKEN", token)
+			},
+		},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+	}
+}
+
+// projectURL addresses the project by its path, group/subgroup/name becomes group%2Fsubgroup%2Fname
+func (gc *GitLabClient) projectURL() string {
+	return gc.apiURL + "/projects/" + url.PathEscape(gc.repo)
+}
+
+func (gc *GitLabClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	var issues []IssueData
+
+	for page := 1; ; page++ {
+		pageURL := fmt.Sprintf("%s/issues?per_page=%d&page=%d", gc.projectURL(), listPageSize, page)
+		body, ie := gc.connect(ctx, "GET", pageURL, nil, http.StatusOK, gc.repo)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+
+		var pageIssues []gitlabIssue
+		json.Unmarshal(body, &pageIssues)
+		for _, issue := range pageIssues {
+			issues = append(issues, issue.issueData())
+		}
+
+		if len(pageIssues) < listPageSize {
+			return issues, ie
+		}
+	}
+}
+
+func (gc *GitLabClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	apiURL := fmt.Sprintf("%s/issues/%d", gc.projectURL(), number)
+	var realWorldIssue IssueData
+
+	body, ie := gc.connect(ctx, "GET", apiURL, nil, http.StatusOK, fmt.Sprintf("%s#%d", gc.repo, number))
+
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = decodeGitLabIssue(body)
+	}
+
+	return &realWorldIssue, ie
+}
+
+func (gc *GitLabClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	var realWorldIssue IssueData
+
+	jsonData, ie := gc.issueRequest(ctx, k8sBasedIssue, "")
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	body, ie := gc.connect(ctx, "POST", gc.projectURL()+"/issues", jsonData, http.StatusCreated, k8sBasedIssue.Name)
+
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = decodeGitLabIssue(body)
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
+		ie = &iep
+	}
+
+	return &realWorldIssue, ie
+}
+
+func (gc *GitLabClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	apiURL := fmt.Sprintf("%s/issues/%d", gc.projectURL(), existingIssue.Number)
+	var realWorldIssue IssueData
+
+	stateEvent := ""
+	switch existingIssue.State {
+	case "open":
+		stateEvent = "reopen"
+	case "closed":
+		stateEvent = "close"
+	}
+	jsonData, ie := gc.issueRequest(ctx, existingIssue, stateEvent)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	body, ie := gc.connect(ctx, "PUT", apiURL, jsonData, http.StatusOK, existingIssue.Name)
+
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = decodeGitLabIssue(body)
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+		ie = &iep
+	}
+
+	return &realWorldIssue, ie
+}
+
+func (gc *GitLabClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+	apiURL := fmt.Sprintf("%s/issues/%d", gc.projectURL(), existIssue.Number)
+	jsonData, _ := json.Marshal(map[string]string{"state_event": "close"})
+
+	_, ie := gc.connect(ctx, "PUT", apiURL, jsonData, http.StatusOK, existIssue.Name)
+
+	return ie
+}
+
+// Comment adds a note to the issue
+func (gc *GitLabClient) Comment(ctx context.Context, issue IssueData, body string) *InfoError {
+	apiURL := fmt.Sprintf("%s/issues/%d/notes", gc.projectURL(), issue.Number)
+	jsonData, _ := json.Marshal(map[string]string{"body": body})
+
+	_, ie := gc.connect(ctx, "POST", apiURL, jsonData, http.StatusCreated, issue.Name)
+
+	return ie
+}
+
+// gitlabIssue is the GitLab representation of an issue
+type gitlabIssue struct {
+	IID         int      `json:"iid"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	State       string   `json:"state"`
+	WebURL      string   `json:"web_url"`
+	UpdatedAt   string   `json:"updated_at"`
+	Labels      []string `json:"labels"`
+	Assignees   []struct {
+		Username string `json:"username"`
+	} `json:"assignees"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+}
+
+func decodeGitLabIssue(body []byte) IssueData {
+	var issue gitlabIssue
+	json.Unmarshal(body, &issue)
+	return issue.issueData()
+}
+
+func (gi gitlabIssue) issueData() IssueData {
+	issue := IssueData{
+		Title:                gi.Title,
+		Description:          gi.Description,
+		Number:               gi.IID,
+		State:                gi.State,
+		LastUpdatedTimeStamp: gi.UpdatedAt,
+		URL:                  gi.WebURL,
+		Labels:               gi.Labels,
+	}
+	// GitLab calls an open issue opened
+	if gi.State == "opened" {
+		issue.State = "open"
+	}
+	for _, assignee := range gi.Assignees {
+		issue.Assignees = append(issue.Assignees, assignee.Username)
+	}
+	if gi.Milestone != nil {
+		issue.Milestone = gi.Milestone.Title
+	}
+	return issue
+}
+
+// gitlabIssueRequest is the body of a create or edit, GitLab refers to
+// assignees and milestones by their ids
+type gitlabIssueRequest struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description"`
+	StateEvent  string `json:"state_event,omitempty"`
+	Labels      string `json:"labels,omitempty"`
+	AssigneeIDs []int  `json:"assignee_ids,omitempty"`
+	MilestoneID int    `json:"milestone_id,omitempty"`
+}
+
+func (gc *GitLabClient) issueRequest(ctx context.Context, issue IssueData, stateEvent string) ([]byte, *InfoError) {
+	request := gitlabIssueRequest{
+		Title:       issue.Title,
+		Description: issue.Description,
+		StateEvent:  stateEvent,
+		Labels:      strings.Join(issue.Labels, ","),
+	}
+
+	for _, username := range issue.Assignees {
+		id, ie := gc.lookupID(ctx, fmt.Sprintf("%s/users?username=%s", gc.apiURL, url.QueryEscape(username)), "user", username, issue.Name)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+		request.AssigneeIDs = append(request.AssigneeIDs, id)
+	}
+	if !isEmpty(issue.Milestone) {
+		id, ie := gc.lookupID(ctx, fmt.Sprintf("%s/milestones?title=%s", gc.projectURL(), url.QueryEscape(issue.Milestone)), "milestone", issue.Milestone, issue.Name)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+		request.MilestoneID = id
+	}
+
+	jsonData, _ := json.Marshal(&request)
+	return jsonData, &InfoError{}
+}
+
+// lookupID is the id of the first result of a search, kind and name only describe it for errors
+func (gc *GitLabClient) lookupID(ctx context.Context, searchURL string, kind string, name string, callerID string) (int, *InfoError) {
+	body, ie := gc.connect(ctx, "GET", searchURL, nil, http.StatusOK, callerID)
+	if !requestSucceeded(ie.Err) {
+		return 0, ie
+	}
+
+	var results []struct {
+		ID int `json:"id"`
+	}
+	json.Unmarshal(body, &results)
+	if len(results) == 0 {
+		iep := newInfoError(fmt.Errorf("%s %q not found in %s", kind, name, gc.repo), fmt.Sprintf("%s - failed to find the %s", callerID, kind))
+		return 0, &iep
+	}
+	return results[0].ID, ie
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// giteaPageSize is the default MAX_RESPONSE_ITEMS of a Gitea server
+const giteaPageSize = 50
+
+// NewGiteaClientFactory returns a factory of clients talking to the Gitea (or
+// Forgejo) API at apiURL, e.g. https://gitea.example.com/api/v1
+func NewGiteaClientFactory(apiURL string, requestTimeout time.Duration) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		giteaClient := newGiteaClient(apiURL, repo, credentials.Token, requestTimeout)
+		return &giteaClient, nil
+	}
+}
+
+// GiteaClient is the GitHubClient of a Gitea repo. The API follows GitHub's
+// except for the labels, which are sent by id, and the pagination.
+type GiteaClient struct {
+	restClient
+	apiURL string
+}
+
+func newGiteaClient(apiURL string, repo string, token string, requestTimeout time.Duration) GiteaClient {
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	return GiteaClient{
+		restClient: restClient{
+			provider:       "Gitea",
+			httpClient:     http.Client{},
+			repo:           repo,
+			requestTimeout: requestTimeout,
+			authorize: func(req *http.Request) {
+				req.Header.Set("Authorization", "token "+token)
+			},
+		},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+	}
+}
+
+func (gt *GiteaClient) repoURL() string {
+	return gt.apiURL + "/repos/" + gt.repo
+}
+
+func (gt *GiteaClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	var issues []IssueData
+
+	for page := 1; ; page++ {
+		// type=issues leaves out the pull requests, which share the numbering
+		pageURL := fmt.Sprintf("%s/issues?state=all&type=issues&limit=%d&page=%d", gt.repoURL(), giteaPageSize, page)
+		body, ie := gt.connect(ctx, "GET", pageURL, nil, http.StatusOK, gt.repo)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+
+		var pageIssues []githubIssue
+		json.Unmarshal(body, &pageIssues)
+		for _, issue := range pageIssues {
+			issues = append(issues, issue.issueData())
+		}
+
+		if len(pageIssues) < giteaPageSize {
+			return issues, ie
+		}
+	}
+}
+
+func (gt *GiteaClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	apiURL := fmt.Sprintf("%s/issues/%d", gt.repoURL(), number)
+	var realWorldIssue IssueData
+
+	body, ie := gt.connect(ctx, "GET", apiURL, nil, http.StatusOK, fmt.Sprintf("%s#%d", gt.repo, number))
+
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = decodeGitHubIssue(body)
+	}
+
+	return &realWorldIssue, ie
+}
+
+func (gt *GiteaClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	var realWorldIssue IssueData
+
+	request, ie := gt.issueRequest(ctx, k8sBasedIssue)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	request.Labels, ie = gt.labelIDs(ctx, k8sBasedIssue.Labels, k8sBasedIssue.Name)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	jsonData, _ := json.Marshal(&request)
+	body, ie := gt.connect(ctx, "POST", gt.repoURL()+"/issues", jsonData, http.StatusCreated, k8sBasedIssue.Name)
+
+	if requestSucceeded(ie.Err) {
+		realWorldIssue = decodeGitHubIssue(body)
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
+		ie = &iep
+	}
+
+	return &realWorldIssue, ie
+}
+
+// Update edits the issue, then replaces its labels when they are set since
+// Gitea doesn't take labels on an edit
+func (gt *GiteaClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	apiURL := fmt.Sprintf("%s/issues/%d", gt.repoURL(), existingIssue.Number)
+	var realWorldIssue IssueData
+
+	request, ie := gt.issueRequest(ctx, existingIssue)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	labelIDs, ie := gt.labelIDs(ctx, existingIssue.Labels, existingIssue.Name)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	jsonData, _ := json.Marshal(&request)
+	// Gitea answers an edit with 201
+	body, ie := gt.connect(ctx, "PATCH", apiURL, jsonData, http.StatusCreated, existingIssue.Name)
+	if !requestSucceeded(ie.Err) {
+		return &realWorldIssue, ie
+	}
+	realWorldIssue = decodeGitHubIssue(body)
+
+	if len(labelIDs) > 0 {
+		jsonData, _ = json.Marshal(map[string][]int{"labels": labelIDs})
+		if _, ie = gt.connect(ctx, "PUT", apiURL+"/labels", jsonData, http.StatusOK, existingIssue.Name); !requestSucceeded(ie.Err) {
+			return &realWorldIssue, ie
+		}
+		realWorldIssue.Labels = existingIssue.Labels
+	}
+
+	iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+	return &realWorldIssue, &iep
+}
+
+func (gt *GiteaClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+	apiURL := fmt.Sprintf("%s/issues/%d", gt.repoURL(), existIssue.Number)
+	jsonData, _ := json.Marshal(map[string]string{"state": "closed"})
+
+	_, ie := gt.connect(ctx, "PATCH", apiURL, jsonData, http.StatusCreated, existIssue.Name)
+
+	return ie
+}
+
+func (gt *GiteaClient) Comment(ctx context.Context, issue IssueData, body string) *InfoError {
+	apiURL := fmt.Sprintf("%s/issues/%d/comments", gt.repoURL(), issue.Number)
+	jsonData, _ := json.Marshal(map[string]string{"body": body})
+
+	_, ie := gt.connect(ctx, "POST", apiURL, jsonData, http.StatusCreated, issue.Name)
+
+	return ie
+}
+
+// giteaIssueRequest is the body of a create or edit, labels are only taken on a create
+type giteaIssueRequest struct {
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	State     string   `json:"state,omitempty"`
+	Labels    []int    `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Milestone int      `json:"milestone,omitempty"`
+}
+
+func (gt *GiteaClient) issueRequest(ctx context.Context, issue IssueData) (giteaIssueRequest, *InfoError) {
+	request := giteaIssueRequest{
+		Title:     issue.Title,
+		Body:      issue.Description,
+		State:     issue.State,
+		Assignees: issue.Assignees,
+	}
+	if isEmpty(issue.Milestone) {
+		return request, &InfoError{}
+	}
+
+	searchURL := fmt.Sprintf("%s/milestones?state=all&name=%s", gt.repoURL(), url.QueryEscape(issue.Milestone))
+	ids, ie := gt.resolveIDs(ctx, searchURL, "milestone", []string{issue.Milestone}, issue.Name)
+	if requestSucceeded(ie.Err) {
+		request.Milestone = ids[0]
+	}
+	return request, ie
+}
+
+// labelIDs resolves label names to the ids of the repo labels, Gitea doesn't create missing labels
+func (gt *GiteaClient) labelIDs(ctx context.Context, names []string, callerID string) ([]int, *InfoError) {
+	if len(names) == 0 {
+		return nil, &InfoError{}
+	}
+	searchURL := fmt.Sprintf("%s/labels?", gt.repoURL())
+	return gt.resolveIDs(ctx, searchURL, "label", names, callerID)
+}
+
+// resolveIDs finds the ids of names among the results of searchURL, which are
+// labels ({id, name}) or milestones ({id, title}). It follows the pages until
+// every name is found or a page comes back short.
+func (gt *GiteaClient) resolveIDs(ctx context.Context, searchURL string, kind string, names []string, callerID string) ([]int, *InfoError) {
+	found := map[string]int{}
+	for page := 1; len(found) < len(names); page++ {
+		pageURL := fmt.Sprintf("%s&limit=%d&page=%d", searchURL, giteaPageSize, page)
+		body, ie := gt.connect(ctx, "GET", pageURL, nil, http.StatusOK, callerID)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+
+		var results []struct {
+			ID    int    `json:"id"`
+			Name  string `json:"name"`
+			Title string `json:"title"`
+		}
+		json.Unmarshal(body, &results)
+		for _, result := range results {
+			for _, name := range names {
+				if result.Name == name || result.Title == name {
+					found[name] = result.ID
+				}
+			}
+		}
+
+		if len(results) < giteaPageSize {
+			break
+		}
+	}
+
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		id, ok := found[name]
+		if !ok {
+			iep := newInfoError(fmt.Errorf("%s %q not found in %s", kind, name, gt.repo), fmt.Sprintf("%s - failed to find the %s", callerID, kind))
+			return nil, &iep
+		}
+		ids = append(ids, id)
+	}
+	return ids, &InfoError{}
+}
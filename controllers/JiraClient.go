@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	jiraPageSize = 100
+	// jiraFields are the issue fields read back from Jira
+	jiraFields = "summary,description,status,labels,assignee,fixVersions,updated"
+	// jiraDone is the status category of the resolved statuses of every workflow
+	jiraDone = "done"
+)
+
+// NewJiraClientFactory returns a factory of clients talking to the Jira REST
+// API of the instance at baseURL, e.g. https://jira.example.com
+func NewJiraClientFactory(baseURL string, requestTimeout time.Duration) GitHubClientFactory {
+	return func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		jiraClient, err := newJiraClient(baseURL, repo, credentials, requestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &jiraClient, nil
+	}
+}
+
+// JiraClient is the GitHubClient of the issues of one type in a Jira project,
+// its repo is PROJECT/IssueType. The number of an issue is the one of its
+// key, 12 for OPS-12, and closing or reopening goes through the workflow.
+type JiraClient struct {
+	restClient
+	baseURL   string
+	project   string
+	issueType string
+}
+
+func newJiraClient(baseURL string, repo string, credentials Credentials, requestTimeout time.Duration) (JiraClient, error) {
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	projectAndType := strings.SplitN(repo, "/", 2)
+	if len(projectAndType) != 2 {
+		return JiraClient{}, fmt.Errorf("jira repo %q is not PROJECT/IssueType", repo)
+	}
+
+	return JiraClient{
+		restClient: restClient{
+			provider:       "Jira",
+			httpClient:     http.Client{},
+			repo:           repo,
+			requestTimeout: requestTimeout,
+			authorize: func(req *http.Request) {
+				// an API token goes with the account's username, a personal access token alone
+				if isEmpty(credentials.Username) {
+					req.Header.Set("Authorization", "Bearer "+credentials.Token)
+				} else {
+					req.SetBasicAuth(credentials.Username, credentials.Token)
+				}
+			},
+		},
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		project:   projectAndType[0],
+		issueType: projectAndType[1],
+	}, nil
+}
+
+func (jc *JiraClient) key(number int) string {
+	return fmt.Sprintf("%s-%d", jc.project, number)
+}
+
+func (jc *JiraClient) issueURL(key string) string {
+	return jc.baseURL + "/rest/api/2/issue/" + key
+}
+
+func (jc *JiraClient) List(ctx context.Context) ([]IssueData, *InfoError) {
+	var issues []IssueData
+	jql := fmt.Sprintf("project = %q AND issuetype = %q ORDER BY key ASC", jc.project, jc.issueType)
+
+	for startAt := 0; ; {
+		pageURL := fmt.Sprintf("%s/rest/api/2/search?jql=%s&startAt=%d&maxResults=%d&fields=%s",
+			jc.baseURL, url.QueryEscape(jql), startAt, jiraPageSize, jiraFields)
+		body, ie := jc.connect(ctx, "GET", pageURL, nil, http.StatusOK, jc.repo)
+		if !requestSucceeded(ie.Err) {
+			return nil, ie
+		}
+
+		var page struct {
+			Issues []jiraIssue `json:"issues"`
+			Total  int         `json:"total"`
+		}
+		json.Unmarshal(body, &page)
+		for _, issue := range page.Issues {
+			issues = append(issues, jc.issueData(issue))
+		}
+
+		startAt += len(page.Issues)
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			return issues, ie
+		}
+	}
+}
+
+func (jc *JiraClient) Get(ctx context.Context, number int) (*IssueData, *InfoError) {
+	return jc.get(ctx, jc.key(number), fmt.Sprintf("%s#%d", jc.repo, number))
+}
+
+func (jc *JiraClient) get(ctx context.Context, key string, callerID string) (*IssueData, *InfoError) {
+	var realWorldIssue IssueData
+
+	body, ie := jc.connect(ctx, "GET", jc.issueURL(key)+"?fields="+jiraFields, nil, http.StatusOK, callerID)
+
+	if requestSucceeded(ie.Err) {
+		var issue jiraIssue
+		json.Unmarshal(body, &issue)
+		realWorldIssue = jc.issueData(issue)
+	}
+
+	return &realWorldIssue, ie
+}
+
+// Create creates the issue in the initial status of the workflow, Jira only answers with its key
+func (jc *JiraClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	fields := jc.fields(k8sBasedIssue)
+	fields["project"] = map[string]string{"key": jc.project}
+	fields["issuetype"] = map[string]string{"name": jc.issueType}
+	jsonData, _ := json.Marshal(map[string]interface{}{"fields": fields})
+
+	body, ie := jc.connect(ctx, "POST", jc.baseURL+"/rest/api/2/issue", jsonData, http.StatusCreated, k8sBasedIssue.Name)
+	if !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	json.Unmarshal(body, &created)
+
+	realWorldIssue, ie := jc.get(ctx, created.Key, k8sBasedIssue.Name)
+	if requestSucceeded(ie.Err) {
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was post successfully", k8sBasedIssue.Name))
+		ie = &iep
+	}
+	return realWorldIssue, ie
+}
+
+// Update edits the fields, then transitions the issue when its state differs from existingIssue's
+func (jc *JiraClient) Update(ctx context.Context, existingIssue IssueData) (*IssueData, *InfoError) {
+	key := jc.key(existingIssue.Number)
+	jsonData, _ := json.Marshal(map[string]interface{}{"fields": jc.fields(existingIssue)})
+
+	if _, ie := jc.connect(ctx, "PUT", jc.issueURL(key), jsonData, http.StatusNoContent, existingIssue.Name); !requestSucceeded(ie.Err) {
+		return &IssueData{}, ie
+	}
+
+	realWorldIssue, ie := jc.get(ctx, key, existingIssue.Name)
+	if requestSucceeded(ie.Err) && !isEmpty(existingIssue.State) && realWorldIssue.State != existingIssue.State {
+		if ie = jc.transition(ctx, key, existingIssue.State == "closed", existingIssue.Name); requestSucceeded(ie.Err) {
+			realWorldIssue, ie = jc.get(ctx, key, existingIssue.Name)
+		}
+	}
+	if requestSucceeded(ie.Err) {
+		iep := newInfoError(nil, fmt.Sprintf("%s - Issue was edit successfully", existingIssue.Name))
+		ie = &iep
+	}
+	return realWorldIssue, ie
+}
+
+func (jc *JiraClient) Close(ctx context.Context, existIssue IssueData) *InfoError {
+	key := jc.key(existIssue.Number)
+	current, ie := jc.get(ctx, key, existIssue.Name)
+	if !requestSucceeded(ie.Err) || current.State == "closed" {
+		return ie
+	}
+	return jc.transition(ctx, key, true, existIssue.Name)
+}
+
+func (jc *JiraClient) Comment(ctx context.Context, issue IssueData, body string) *InfoError {
+	jsonData, _ := json.Marshal(map[string]string{"body": body})
+
+	_, ie := jc.connect(ctx, "POST", jc.issueURL(jc.key(issue.Number))+"/comment", jsonData, http.StatusCreated, issue.Name)
+
+	return ie
+}
+
+// transition moves the issue to the first status the workflow allows that
+// is resolved when toDone, or unresolved otherwise
+func (jc *JiraClient) transition(ctx context.Context, key string, toDone bool, callerID string) *InfoError {
+	body, ie := jc.connect(ctx, "GET", jc.issueURL(key)+"/transitions", nil, http.StatusOK, callerID)
+	if !requestSucceeded(ie.Err) {
+		return ie
+	}
+
+	var available struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	json.Unmarshal(body, &available)
+	for _, transition := range available.Transitions {
+		if (transition.To.StatusCategory.Key == jiraDone) == toDone {
+			jsonData, _ := json.Marshal(map[string]interface{}{"transition": map[string]string{"id": transition.ID}})
+			_, ie = jc.connect(ctx, "POST", jc.issueURL(key)+"/transitions", jsonData, http.StatusNoContent, callerID)
+			return ie
+		}
+	}
+
+	target := "an open"
+	if toDone {
+		target = "a done"
+	}
+	iep := newInfoError(fmt.Errorf("the workflow of %s has no transition to %s status", key, target), fmt.Sprintf("%s - failed to transition the issue", callerID))
+	return &iep
+}
+
+// jiraAssignee keeps the first assignee of issue, the only one a Jira issue can
+// have, and returns the ones it dropped
+func jiraAssignee(issue *IssueData) []string {
+	if len(issue.Assignees) <= 1 {
+		return nil
+	}
+	dropped := issue.Assignees[1:]
+	issue.Assignees = issue.Assignees[:1]
+	return dropped
+}
+
+// fields are the Jira fields of issue, Jira has a single assignee and the milestone is a fix version
+func (jc *JiraClient) fields(issue IssueData) map[string]interface{} {
+	fields := map[string]interface{}{
+		"summary":     issue.Title,
+		"description": issue.Description,
+	}
+	if len(issue.Labels) > 0 {
+		fields["labels"] = issue.Labels
+	}
+	if len(issue.Assignees) > 0 {
+		fields["assignee"] = map[string]string{"name": issue.Assignees[0]}
+	}
+	if !isEmpty(issue.Milestone) {
+		fields["fixVersions"] = []map[string]string{{"name": issue.Milestone}}
+	}
+	return fields
+}
+
+// jiraIssue is the Jira representation of an issue
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string   `json:"summary"`
+		Description string   `json:"description"`
+		Updated     string   `json:"updated"`
+		Labels      []string `json:"labels"`
+		Status      struct {
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+		Assignee *struct {
+			Name string `json:"name"`
+		} `json:"assignee"`
+		FixVersions []struct {
+			Name string `json:"name"`
+		} `json:"fixVersions"`
+	} `json:"fields"`
+}
+
+func (jc *JiraClient) issueData(ji jiraIssue) IssueData {
+	number, _ := strconv.Atoi(strings.TrimPrefix(ji.Key, jc.project+"-"))
+	issue := IssueData{
+		Title:                ji.Fields.Summary,
+		Description:          ji.Fields.Description,
+		Number:               number,
+		Key:                  ji.Key,
+		State:                "open",
+		LastUpdatedTimeStamp: ji.Fields.Updated,
+		URL:                  jc.baseURL + "/browse/" + ji.Key,
+		Labels:               ji.Fields.Labels,
+	}
+	if ji.Fields.Status.StatusCategory.Key == jiraDone {
+		issue.State = "closed"
+	}
+	if ji.Fields.Assignee != nil {
+		issue.Assignees = []string{ji.Fields.Assignee.Name}
+	}
+	if len(ji.Fields.FixVersions) > 0 {
+		issue.Milestone = ji.Fields.FixVersions[0].Name
+	}
+	return issue
+}
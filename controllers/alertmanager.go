@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// AlertmanagerPath is the path Alertmanager posts its notifications to
+	AlertmanagerPath = "/alertmanager"
+
+	alertGroupLabel         = "example.training.redhat.com/alert-group"
+	alertGroupKeyAnnotation = "example.training.redhat.com/alert-group-key"
+	alertStatusAnnotation   = "example.training.redhat.com/alert-status"
+	alertmanagerRoutesKey   = "routes.yaml"
+	alertStatusFiring       = "firing"
+	alertStatusResolved     = "resolved"
+	onResolveClose          = "close"
+	onResolveComment        = "comment"
+	maxWebhookPayload       = 1 << 20
+	maxAlertComments        = 20
+	webhookReadTimeout      = 30 * time.Second
+	webhookShutdownWait     = 5 * time.Second
+
+	defaultAlertTitleTemplate = `{{ .CommonLabels.alertname | default "Alert" }}{{ with .CommonAnnotations.summary }}: {{ . }}{{ end }}`
+	defaultAlertBodyTemplate  = `{{ with .CommonAnnotations.description }}{{ . }}
+
+{{ end }}{{ range .Alerts }}- **{{ .Labels.alertname }}** {{ .Status }} since {{ .StartsAt }}{{ with .Annotations.summary }}: {{ . }}{{ end }}
+{{ end }}{{ with .ExternalURL }}
+Alertmanager: {{ . }}
+{{ end }}`
+)
+
+// AlertmanagerReceiver is an Alertmanager webhook receiver turning each alert
+// group into a GitHubIssue. The GitHubIssue is named after the group key, so
+// that the notifications of a group always land on the same issue, and the
+// repo it is filed in comes from the first matching route of the routes ConfigMap.
+type AlertmanagerReceiver struct {
+	Client      client.Client
+	Log         logr.Logger
+	BindAddress string
+	// Routes is the ConfigMap holding the routes under routes.yaml
+	Routes types.NamespacedName
+	// Token is the bearer token Alertmanager has to send, when set
+	Token string
+}
+
+// alertmanagerRoute files the alert groups whose common labels hold all of
+// Match as GitHubIssues of Namespace
+type alertmanagerRoute struct {
+	Match     map[string]string `json:"match,omitempty"`
+	Namespace string            `json:"namespace"`
+	Provider  string            `json:"provider,omitempty"`
+	Repo      string            `json:"repo"`
+	Labels    []string          `json:"labels,omitempty"`
+	// OnResolve is close to close the issue when the group resolves, or comment to leave it open
+	OnResolve string `json:"onResolve,omitempty"`
+	// Title and Body are templates executed against the notification
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// alertmanagerNotification is the version 4 webhook payload of Alertmanager
+type alertmanagerNotification struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt"`
+	EndsAt       string            `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Start serves the webhook until ctx is done
+func (r *AlertmanagerReceiver) Start(ctx context.Context) error {
+	r.Log.Info("serving the Alertmanager webhook", "address", r.BindAddress, "path", AlertmanagerPath)
+	if r.Token == "" {
+		r.Log.Error(nil, "ALERTMANAGER_WEBHOOK_TOKEN is not set, anyone who can reach the webhook can file issues")
+	}
+	return serveWebhook(ctx, r.BindAddress, AlertmanagerPath, r)
+}
+
+// serveWebhook serves handler on path until ctx is done
+func serveWebhook(ctx context.Context, address string, path string, handler http.Handler) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	server := &http.Server{Addr: address, Handler: mux, ReadTimeout: webhookReadTimeout}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownWait)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection is false, every replica can take notifications as the
+// GitHubIssue of a group has a fixed name
+func (r *AlertmanagerReceiver) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP files a notification. A failure answers 500 so that Alertmanager
+// retries, a group no route matches is acknowledged and dropped.
+func (r *AlertmanagerReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Token != "" && subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+r.Token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var notification alertmanagerNotification
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxWebhookPayload)).Decode(&notification); err != nil {
+		http.Error(w, fmt.Sprintf("invalid notification: %v", err), http.StatusBadRequest)
+		return
+	}
+	if notification.GroupKey == "" {
+		http.Error(w, "invalid notification: no groupKey", http.StatusBadRequest)
+		return
+	}
+	log := r.Log.WithValues("groupKey", notification.GroupKey, "status", notification.Status)
+
+	routes, err := r.loadRoutes(req.Context())
+	if err != nil {
+		log.Error(err, "failed to load the Alertmanager routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	route := matchRoute(routes, notification.CommonLabels)
+	if route == nil {
+		log.Info("no route matches the alert group, it is dropped")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := r.fileAlertGroup(req.Context(), *route, notification); err != nil {
+		log.Error(err, "failed to file the alert group")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *AlertmanagerReceiver) loadRoutes(ctx context.Context) ([]alertmanagerRoute, error) {
+	var configMap corev1.ConfigMap
+	if err := r.Client.Get(ctx, r.Routes, &configMap); err != nil {
+		return nil, fmt.Errorf("failed to get the routes ConfigMap %s: %w", r.Routes, err)
+	}
+
+	var config struct {
+		Routes []alertmanagerRoute `json:"routes"`
+	}
+	if err := yaml.Unmarshal([]byte(configMap.Data[alertmanagerRoutesKey]), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s of %s: %w", alertmanagerRoutesKey, r.Routes, err)
+	}
+	for i, route := range config.Routes {
+		if route.Namespace == "" || route.Repo == "" {
+			return nil, fmt.Errorf("route %d of %s has no namespace or repo", i, r.Routes)
+		}
+		if route.OnResolve != "" && route.OnResolve != onResolveClose && route.OnResolve != onResolveComment {
+			return nil, fmt.Errorf("route %d of %s: onResolve is %q, want close or comment", i, r.Routes, route.OnResolve)
+		}
+	}
+	return config.Routes, nil
+}
+
+// matchRoute is the first route whose match labels are all common labels of the group
+func matchRoute(routes []alertmanagerRoute, commonLabels map[string]string) *alertmanagerRoute {
+	for i := range routes {
+		matches := true
+		for name, value := range routes[i].Match {
+			if labelValue, ok := commonLabels[name]; !ok || labelValue != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return &routes[i]
+		}
+	}
+	return nil
+}
+
+// fileAlertGroup creates the GitHubIssue of the group or brings it up to date
+// with the notification
+func (r *AlertmanagerReceiver) fileAlertGroup(ctx context.Context, route alertmanagerRoute, notification alertmanagerNotification) error {
+	title, err := executeAlertTemplate("title", route.Title, defaultAlertTitleTemplate, notification)
+	if err != nil {
+		return err
+	}
+	body, err := executeAlertTemplate("body", route.Body, defaultAlertBodyTemplate, notification)
+	if err != nil {
+		return err
+	}
+	fingerprint := sourceFingerprint(notification.GroupKey)
+	key := types.NamespacedName{Namespace: route.Namespace, Name: "alert-" + fingerprint}
+
+	// a group that resolved before it was ever filed has nothing to track
+	create := notification.Status != alertStatusResolved
+	return syncGeneratedIssue(ctx, r.Client, key, alertGroupLabel, fingerprint, create, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.Annotations = map[string]string{alertGroupKeyAnnotation: notification.GroupKey}
+			ghIssue.Spec = examplev1alpha1.GitHubIssueSpec{Provider: route.Provider, Repo: route.Repo, Labels: route.Labels}
+		}
+		applyNotification(ghIssue, route, notification, title, body)
+	})
+}
+
+// applyNotification sets the title and body of the GitHubIssue and, when the
+// status of the group changed, closes or reopens it or comments on it. A
+// flapping group gets at most maxAlertComments comments.
+func applyNotification(ghIssue *examplev1alpha1.GitHubIssue, route alertmanagerRoute, notification alertmanagerNotification, title string, body string) {
+	ghIssue.Spec.Title = title
+	ghIssue.Spec.Description = body
+
+	previous := ghIssue.Annotations[alertStatusAnnotation]
+	if ghIssue.Annotations == nil {
+		ghIssue.Annotations = map[string]string{}
+	}
+	ghIssue.Annotations[alertStatusAnnotation] = notification.Status
+
+	resolved := notification.Status == alertStatusResolved
+	if route.OnResolve == onResolveComment {
+		// the first notification is the issue itself, only the changes get a comment
+		if previous != "" && previous != notification.Status && len(ghIssue.Spec.Comments) < maxAlertComments {
+			comment := alertStatusComment(notification)
+			if len(ghIssue.Spec.Comments) == maxAlertComments-1 {
+				comment += " The group keeps flapping, its next status changes are not commented."
+			}
+			ghIssue.Spec.Comments = append(ghIssue.Spec.Comments, comment)
+		}
+		return
+	}
+	ghIssue.Spec.State = "open"
+	if resolved {
+		ghIssue.Spec.State = "closed"
+	}
+}
+
+func alertStatusComment(notification alertmanagerNotification) string {
+	if notification.Status == alertStatusResolved {
+		return fmt.Sprintf("The alert group resolved, %d alerts were part of it.", len(notification.Alerts))
+	}
+	return fmt.Sprintf("The alert group is firing again with %d alerts.", len(notification.Alerts))
+}
+
+func executeAlertTemplate(name string, text string, defaultText string, notification alertmanagerNotification) (string, error) {
+	if text == "" {
+		text = defaultText
+	}
+	tmpl, err := template.New(name).Funcs(safeFuncMap()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the %s template: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, notification); err != nil {
+		return "", fmt.Errorf("failed to execute the %s template: %w", name, err)
+	}
+	return truncate(out.String(), maxRenderedBodySize), nil
+}
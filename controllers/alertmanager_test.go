@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const testAlertRoutes = `routes:
+- match:
+    team: storage
+  namespace: storage
+  repo: AlmogLevii/storage
+  labels: [alert]
+  onResolve: comment
+- match:
+    severity: critical
+  namespace: default
+  repo: AlmogLevii/example-operator
+  title: '[{{ .CommonLabels.severity | upper }}] {{ .CommonLabels.alertname }}'
+`
+
+func newTestAlertmanagerReceiver(t *testing.T) *AlertmanagerReceiver {
+	routes := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "alert-routes", Namespace: "operator"},
+		Data:       map[string]string{alertmanagerRoutesKey: testAlertRoutes},
+	}
+
+	return &AlertmanagerReceiver{
+		Client: newTestClient(t, routes),
+		Log:    logr.Discard(),
+		Routes: types.NamespacedName{Namespace: "operator", Name: "alert-routes"},
+		Token:  "alertmanager-token",
+	}
+}
+
+func newTestNotification(status string, commonLabels map[string]string) alertmanagerNotification {
+	return alertmanagerNotification{
+		Version:           "4",
+		GroupKey:          `{}:{alertname="DiskFull"}`,
+		Status:            status,
+		Receiver:          "issues",
+		GroupLabels:       map[string]string{"alertname": "DiskFull"},
+		CommonLabels:      commonLabels,
+		CommonAnnotations: map[string]string{"summary": "the disk is full"},
+		ExternalURL:       "http://alertmanager:9093",
+		Alerts: []alertmanagerAlert{{
+			Status:      status,
+			Labels:      commonLabels,
+			StartsAt:    "2021-06-01T10:00:00Z",
+			Fingerprint: "c0ffee",
+		}},
+	}
+}
+
+func postNotification(t *testing.T, receiver *AlertmanagerReceiver, notification alertmanagerNotification) int {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, AlertmanagerPath, strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer alertmanager-token")
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func getAlertIssue(t *testing.T, receiver *AlertmanagerReceiver, namespace string) *examplev1alpha1.GitHubIssue {
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := receiver.Client.List(context.Background(), &ghIssues); err != nil {
+		t.Fatal(err)
+	}
+	if len(ghIssues.Items) != 1 || ghIssues.Items[0].Namespace != namespace {
+		t.Fatalf("GitHubIssues = %+v, want one in %s", ghIssues.Items, namespace)
+	}
+	return &ghIssues.Items[0]
+}
+
+func TestAlertmanagerClose(t *testing.T) {
+	receiver := newTestAlertmanagerReceiver(t)
+	labels := map[string]string{"alertname": "DiskFull", "severity": "critical"}
+
+	for i := 0; i < 2; i++ {
+		if code := postNotification(t, receiver, newTestNotification(alertStatusFiring, labels)); code != http.StatusOK {
+			t.Fatalf("firing notification answered %d", code)
+		}
+	}
+	ghIssue := getAlertIssue(t, receiver, "default")
+	if ghIssue.Spec.Title != "[CRITICAL] DiskFull" || ghIssue.Spec.State != "open" || ghIssue.Spec.Repo != testRepo {
+		t.Errorf("spec = %+v, want an open issue in %s rendered from the route title", ghIssue.Spec, testRepo)
+	}
+	if !strings.Contains(ghIssue.Spec.Description, "**DiskFull** firing since 2021-06-01T10:00:00Z\n") {
+		t.Errorf("description = %q, want the alerts listed", ghIssue.Spec.Description)
+	}
+	if ghIssue.Labels[alertGroupLabel] != sourceFingerprint(`{}:{alertname="DiskFull"}`) {
+		t.Errorf("labels = %v, want the group fingerprint", ghIssue.Labels)
+	}
+
+	postNotification(t, receiver, newTestNotification(alertStatusResolved, labels))
+	if ghIssue := getAlertIssue(t, receiver, "default"); ghIssue.Spec.State != "closed" {
+		t.Errorf("state after resolving = %q, want closed", ghIssue.Spec.State)
+	}
+	postNotification(t, receiver, newTestNotification(alertStatusFiring, labels))
+	if ghIssue := getAlertIssue(t, receiver, "default"); ghIssue.Spec.State != "open" {
+		t.Errorf("state after firing again = %q, want open", ghIssue.Spec.State)
+	}
+}
+
+func TestAlertmanagerComment(t *testing.T) {
+	receiver := newTestAlertmanagerReceiver(t)
+	labels := map[string]string{"alertname": "DiskFull", "severity": "critical", "team": "storage"}
+
+	postNotification(t, receiver, newTestNotification(alertStatusFiring, labels))
+	postNotification(t, receiver, newTestNotification(alertStatusResolved, labels))
+	postNotification(t, receiver, newTestNotification(alertStatusResolved, labels))
+
+	ghIssue := getAlertIssue(t, receiver, "storage")
+	if ghIssue.Spec.Title != "DiskFull: the disk is full" || ghIssue.Spec.State != "" || !sameStrings(ghIssue.Spec.Labels, []string{"alert"}) {
+		t.Errorf("spec = %+v, want the default title, the route labels and no state", ghIssue.Spec)
+	}
+	if len(ghIssue.Spec.Comments) != 1 || !strings.Contains(ghIssue.Spec.Comments[0], "resolved") {
+		t.Errorf("comments = %q, want one resolved comment", ghIssue.Spec.Comments)
+	}
+}
+
+func TestAlertmanagerFlapping(t *testing.T) {
+	receiver := newTestAlertmanagerReceiver(t)
+	labels := map[string]string{"alertname": "DiskFull", "team": "storage"}
+
+	for i := 0; i < 2*maxAlertComments; i++ {
+		postNotification(t, receiver, newTestNotification(alertStatusFiring, labels))
+		postNotification(t, receiver, newTestNotification(alertStatusResolved, labels))
+	}
+
+	ghIssue := getAlertIssue(t, receiver, "storage")
+	if len(ghIssue.Spec.Comments) != maxAlertComments {
+		t.Fatalf("comments = %d, want them capped at %d", len(ghIssue.Spec.Comments), maxAlertComments)
+	}
+	if last := ghIssue.Spec.Comments[maxAlertComments-1]; !strings.Contains(last, "keeps flapping") {
+		t.Errorf("last comment = %q, want it to say the next changes are not commented", last)
+	}
+	if ghIssue.Annotations[alertStatusAnnotation] != alertStatusResolved {
+		t.Errorf("status = %q, want the last status still tracked", ghIssue.Annotations[alertStatusAnnotation])
+	}
+}
+
+func TestAlertmanagerIgnored(t *testing.T) {
+	receiver := newTestAlertmanagerReceiver(t)
+
+	for _, notification := range []alertmanagerNotification{
+		newTestNotification(alertStatusFiring, map[string]string{"alertname": "DiskFull", "severity": "warning"}),
+		newTestNotification(alertStatusResolved, map[string]string{"alertname": "DiskFull", "severity": "critical"}),
+	} {
+		if code := postNotification(t, receiver, notification); code != http.StatusOK {
+			t.Errorf("notification answered %d, want 200", code)
+		}
+	}
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := receiver.Client.List(context.Background(), &ghIssues); err != nil {
+		t.Fatal(err)
+	}
+	if len(ghIssues.Items) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none for unrouted or already resolved groups", ghIssues.Items)
+	}
+}
+
+func TestAlertmanagerRequest(t *testing.T) {
+	receiver := newTestAlertmanagerReceiver(t)
+
+	cases := map[string]struct {
+		method string
+		token  string
+		body   string
+		want   int
+	}{
+		"no token":    {http.MethodPost, "", `{"groupKey":"{}"}`, http.StatusUnauthorized},
+		"wrong token": {http.MethodPost, "Bearer wrong", `{"groupKey":"{}"}`, http.StatusUnauthorized},
+		"get":         {http.MethodGet, "Bearer alertmanager-token", "", http.StatusMethodNotAllowed},
+		"not json":    {http.MethodPost, "Bearer alertmanager-token", "alerts", http.StatusBadRequest},
+		"no group":    {http.MethodPost, "Bearer alertmanager-token", `{"status":"firing"}`, http.StatusBadRequest},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, AlertmanagerPath, strings.NewReader(c.body))
+			if c.token != "" {
+				req.Header.Set("Authorization", c.token)
+			}
+			recorder := httptest.NewRecorder()
+			receiver.ServeHTTP(recorder, req)
+			if recorder.Code != c.want {
+				t.Errorf("answered %d, want %d", recorder.Code, c.want)
+			}
+		})
+	}
+}
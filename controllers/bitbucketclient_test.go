@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testBitbucketRepo = "OPS/example-operator/7"
+
+type fakeBitbucketTask struct {
+	ID          int    `json:"id"`
+	Version     int    `json:"version"`
+	Text        string `json:"text"`
+	Severity    string `json:"severity"`
+	State       string `json:"state"`
+	CreatedDate int64  `json:"createdDate"`
+	UpdatedDate int64  `json:"updatedDate"`
+}
+
+// fakeBitbucket serves the blocker comments of one pull request from memory,
+// comment ids start at 100 as they are shared with the other comments
+type fakeBitbucket struct {
+	*httptest.Server
+	token string
+
+	mu    sync.Mutex
+	tasks []*fakeBitbucketTask
+}
+
+func newFakeBitbucket(t *testing.T) *fakeBitbucket {
+	f := &fakeBitbucket{token: "bitbucket-token"}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeBitbucket) client(token string) *BitbucketClient {
+	bitbucketClient, err := newBitbucketClient(f.URL, testBitbucketRepo, token, 0)
+	if err != nil {
+		panic(err)
+	}
+	return &bitbucketClient
+}
+
+func writeBitbucketError(w http.ResponseWriter, status int, message string) {
+	writeFakeJSON(w, status, map[string][]map[string]string{"errors": {{"message": message}}})
+}
+
+func (f *fakeBitbucket) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.Header.Get("Authorization") != "Bearer "+f.token {
+		writeBitbucketError(w, http.StatusUnauthorized, "Authentication failed. Please check your credentials and try again.")
+		return
+	}
+
+	prefix := "/rest/api/1.0/projects/OPS/repos/example-operator/pull-requests/7/blocker-comments"
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		writeBitbucketError(w, http.StatusNotFound, "Pull request 7 does not exist in OPS/example-operator.")
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, prefix), "/")
+
+	switch {
+	case id == "" && req.Method == http.MethodGet:
+		f.list(w, req)
+	case id == "" && req.Method == http.MethodPost:
+		var request fakeBitbucketTask
+		body, _ := ioutil.ReadAll(req.Body)
+		if json.Unmarshal(body, &request) != nil || request.Text == "" {
+			writeBitbucketError(w, http.StatusBadRequest, "Please enter a non-empty value for text")
+			return
+		}
+		task := &fakeBitbucketTask{ID: 100 + len(f.tasks), Text: request.Text, Severity: "BLOCKER", State: bitbucketOpen}
+		task.CreatedDate, task.UpdatedDate = 1622541600000, 1622541600000
+		f.tasks = append(f.tasks, task)
+		writeFakeJSON(w, http.StatusCreated, task)
+	default:
+		number, _ := strconv.Atoi(id)
+		if number < 100 || number >= 100+len(f.tasks) {
+			writeBitbucketError(w, http.StatusNotFound, fmt.Sprintf("Comment %s does not exist.", id))
+			return
+		}
+		task := f.tasks[number-100]
+		switch req.Method {
+		case http.MethodGet:
+			writeFakeJSON(w, http.StatusOK, task)
+		case http.MethodPut:
+			f.update(w, req, task)
+		default:
+			writeBitbucketError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+func (f *fakeBitbucket) list(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	var matching []*fakeBitbucketTask
+	for _, task := range f.tasks {
+		for _, state := range query["state"] {
+			if task.State == state {
+				matching = append(matching, task)
+			}
+		}
+	}
+
+	start, _ := strconv.Atoi(query.Get("start"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 25
+	}
+	end := start + limit
+	if start > len(matching) {
+		start = len(matching)
+	}
+	if end > len(matching) {
+		end = len(matching)
+	}
+	page := map[string]interface{}{
+		"start":      start,
+		"limit":      limit,
+		"size":       end - start,
+		"isLastPage": end == len(matching),
+		"values":     append([]*fakeBitbucketTask{}, matching[start:end]...),
+	}
+	if end < len(matching) {
+		page["nextPageStart"] = end
+	}
+	writeFakeJSON(w, http.StatusOK, page)
+}
+
+// update applies an edit, like Bitbucket it refuses an edit of a stale version
+func (f *fakeBitbucket) update(w http.ResponseWriter, req *http.Request, task *fakeBitbucketTask) {
+	var request struct {
+		Text    *string `json:"text"`
+		State   string  `json:"state"`
+		Version *int    `json:"version"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if json.Unmarshal(body, &request) != nil || request.Version == nil {
+		writeBitbucketError(w, http.StatusBadRequest, "You must specify a version")
+		return
+	}
+	if *request.Version != task.Version {
+		writeBitbucketError(w, http.StatusConflict, "You are attempting to modify a comment based on out-of-date information.")
+		return
+	}
+
+	if request.Text != nil {
+		task.Text = *request.Text
+	}
+	if request.State != "" {
+		task.State = request.State
+	}
+	task.Version++
+	task.UpdatedDate += 60000
+	writeFakeJSON(w, http.StatusOK, task)
+}
+
+func TestBitbucketClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		f := newFakeBitbucket(t)
+		return f.client(f.token)
+	})
+}
+
+func TestBitbucketClientTask(t *testing.T) {
+	f := newFakeBitbucket(t)
+
+	created, ie := f.client(f.token).Create(context.Background(), IssueData{Name: "task", Title: "flaky test", Description: "it fails\n\non Mondays"})
+	mustSucceed(t, "Create", ie)
+	if f.tasks[0].Text != "flaky test\n\nit fails\n\non Mondays" {
+		t.Errorf("task text = %q, want the title and the description as paragraphs", f.tasks[0].Text)
+	}
+	wantURL := f.URL + "/projects/OPS/repos/example-operator/pull-requests/7/overview?commentId=100"
+	if created.Number != 100 || created.Description != "it fails\n\non Mondays" || created.URL != wantURL {
+		t.Errorf("Create() = %+v, want task 100 at %s", *created, wantURL)
+	}
+	if created.LastUpdatedTimeStamp != "2021-06-01T10:00:00Z" {
+		t.Errorf("Create() updated at %q, want 2021-06-01T10:00:00Z", created.LastUpdatedTimeStamp)
+	}
+}
+
+func TestBitbucketClientNotSupported(t *testing.T) {
+	f := newFakeBitbucket(t)
+
+	_, ie := f.client(f.token).Create(context.Background(), IssueData{Name: "labels", Title: "labels", Labels: []string{"bug"}})
+	if !errors.Is(ie.Err, errNotSupported) {
+		t.Errorf("Create() error = %v, want %v", ie.Err, errNotSupported)
+	}
+	if len(f.tasks) != 0 {
+		t.Errorf("a task was created without its labels")
+	}
+}
+
+func TestBitbucketClientRepo(t *testing.T) {
+	for _, repo := range []string{"OPS/example-operator", "OPS/example-operator/tasks"} {
+		if _, err := NewBitbucketClientFactory("https://bitbucket.example.com", 0)("bitbucket", repo, Credentials{}); err == nil {
+			t.Errorf("repo %q without a pull request was accepted", repo)
+		}
+	}
+}
+
+func TestBitbucketClientListPages(t *testing.T) {
+	f := newFakeBitbucket(t)
+	bitbucketClient := f.client(f.token)
+	for i := 0; i < listPageSize+5; i++ {
+		_, ie := bitbucketClient.Create(context.Background(), IssueData{Name: "pages", Title: fmt.Sprintf("task %d", i)})
+		mustSucceed(t, "Create", ie)
+	}
+
+	issues, ie := bitbucketClient.List(context.Background())
+	mustSucceed(t, "List", ie)
+	if len(issues) != listPageSize+5 {
+		t.Errorf("List() returned %d issues, want %d", len(issues), listPageSize+5)
+	}
+}
+
+func TestBitbucketClientBadToken(t *testing.T) {
+	f := newFakeBitbucket(t)
+
+	_, ie := f.client("wrong-token").List(context.Background())
+	var apiErr *apiError
+	if !errors.As(ie.Err, &apiErr) || !apiErr.isAuthFailure() {
+		t.Errorf("List() error = %v, want an authentication failure", ie.Err)
+	}
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AlmogLevii/example-operator/controllers/fakegithub"
+)
+
+// githubCassette is replayed by TestRealGitHubClientCassette once it's
+// committed, no session of the real API is recorded in the tree yet and the
+// test is skipped until then. Record it, and again after changing the GitHub
+// client, with:
+//
+//	make record-cassettes GITHUB_RECORD_REPO=<owner>/<scratch repo> GITOKEN=<token>
+//
+// the scratch repo needs a milestone named v1, the conformance run leaves a
+// few issues behind in it and tolerates the ones of the earlier runs.
+// TestCassetteRecordAndReplay covers the recorder and the replayer against the
+// fake GitHub API in the meantime.
+const githubCassette = "testdata/cassettes/github-issues.json"
+
+const scrubbedToken = "REDACTED"
+
+// recordedHeaders are the response headers kept in a cassette
+var recordedHeaders = []string{"Content-Type", "Link", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+// interaction is a request and the response it got
+type interaction struct {
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	RequestBody string      `json:"requestBody,omitempty"`
+	StatusCode  int         `json:"statusCode"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body"`
+}
+
+// cassette is a recorded session of a GitHubClient against Repo
+type cassette struct {
+	Repo         string        `json:"repo"`
+	Interactions []interaction `json:"interactions"`
+}
+
+func loadCassette(path string) (*cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &cassette{}
+	return c, json.Unmarshal(data, c)
+}
+
+func (c *cassette) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// recorder sends the requests with transport and records them, the
+// Authorization header is never recorded and token is scrubbed from the rest
+type recorder struct {
+	transport http.RoundTripper
+	token     string
+
+	mu       sync.Mutex
+	cassette cassette
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	for _, key := range recordedHeaders {
+		for _, value := range resp.Header.Values(key) {
+			header.Add(key, r.scrub(value))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction{
+		Method:      req.Method,
+		Path:        req.URL.RequestURI(),
+		RequestBody: r.scrub(string(requestBody)),
+		StatusCode:  resp.StatusCode,
+		Header:      header,
+		Body:        r.scrub(string(body)),
+	})
+	return resp, nil
+}
+
+func (r *recorder) scrub(s string) string {
+	if r.token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, r.token, scrubbedToken)
+}
+
+// replayer answers requests from a cassette without any network access. A
+// request gets the first unused interaction with the same method, path and
+// body, so a repeated request replays the responses in the recorded order.
+type replayer struct {
+	mu           sync.Mutex
+	interactions []interaction
+	used         []bool
+}
+
+func newReplayer(c *cassette) *replayer {
+	return &replayer{interactions: c.Interactions, used: make([]bool, len(c.Interactions))}
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, recorded := range r.interactions {
+		if r.used[i] || recorded.Method != req.Method || recorded.Path != req.URL.RequestURI() || !sameBody(recorded.RequestBody, string(requestBody)) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+			StatusCode:    recorded.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        recorded.Header.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction for %s %s %s", req.Method, req.URL.RequestURI(), requestBody)
+}
+
+// unused are the interactions that were recorded but not replayed
+func (r *replayer) unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []string
+	for i, recorded := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, recorded.Method+" "+recorded.Path)
+		}
+	}
+	return unused
+}
+
+// readBody reads body and puts back a copy so that it can still be sent or returned
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// sameBody compares JSON bodies regardless of their formatting
+func sameBody(recorded string, sent string) bool {
+	if recorded == sent {
+		return true
+	}
+	var recordedJSON, sentJSON interface{}
+	if json.Unmarshal([]byte(recorded), &recordedJSON) != nil || json.Unmarshal([]byte(sent), &sentJSON) != nil {
+		return false
+	}
+	recordedData, _ := json.Marshal(recordedJSON)
+	sentData, _ := json.Marshal(sentJSON)
+	return bytes.Equal(recordedData, sentData)
+}
+
+// runCassetteConformance records the conformance run into path when apiURL is
+// set, or else replays path offline
+func runCassetteConformance(t *testing.T, path string, apiURL string, repo string, token string) {
+	var transport http.RoundTripper
+	rec := &recorder{transport: http.DefaultTransport, token: token, cassette: cassette{Repo: repo}}
+	var rep *replayer
+
+	if apiURL != "" {
+		transport = rec
+	} else {
+		c, err := loadCassette(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep = newReplayer(c)
+		transport = rep
+		apiURL, repo, token = defaultAPIURL, c.Repo, scrubbedToken
+	}
+
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		realClient := newRealGitHubClient(apiURL, repo, token, 0)
+		realClient.httpClient.Transport = transport
+		return &realClient
+	})
+
+	if rep != nil {
+		if unused := rep.unused(); len(unused) > 0 {
+			t.Errorf("recorded interactions were not replayed: %v", unused)
+		}
+		return
+	}
+	if err := rec.cassette.save(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRealGitHubClientCassette(t *testing.T) {
+	if repo := os.Getenv("GITHUB_RECORD_REPO"); repo != "" {
+		runCassetteConformance(t, githubCassette, defaultAPIURL, repo, getToken())
+		return
+	}
+	if _, err := os.Stat(githubCassette); os.IsNotExist(err) {
+		t.Skipf("%s wasn't recorded yet, run make record-cassettes to record it", githubCassette)
+	}
+	runCassetteConformance(t, githubCassette, "", "", "")
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	server := fakegithub.NewServer()
+	server.Token = "secret-token"
+	server.AddMilestone(testRepo, conformanceMilestone)
+	// the leftovers of an earlier run in the scratch repo
+	server.AddIssue(testRepo, fakegithub.Issue{Title: "list open", State: "closed"})
+	server.AddIssue(testRepo, fakegithub.Issue{Title: "list closed"})
+	t.Run("record", func(t *testing.T) {
+		runCassetteConformance(t, path, server.URL, testRepo, server.Token)
+	})
+	server.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(server.Token)) {
+		t.Errorf("the cassette contains the token")
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		runCassetteConformance(t, path, "", "", "")
+	})
+}
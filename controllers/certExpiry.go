@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	certificateLabel      = "example.training.redhat.com/certificate"
+	defaultCertDaysBefore = 30
+	day                   = 24 * time.Hour
+)
+
+// CertExpiryReconciler opens a GitHubIssue for the certificates of the TLS
+// Secrets matching the rules of a ConfigMap some days before they expire,
+// and closes it once the Secret holds a renewed certificate. The TLS Secrets
+// are watched on their own rather than through the manager's cache, which
+// would hold every Secret of the cluster.
+type CertExpiryReconciler struct {
+	client.Client
+	// KubeClient lists and watches the TLS Secrets
+	KubeClient kubernetes.Interface
+	Log        logr.Logger
+	// Rules is the ConfigMap holding the rules under rules.yaml
+	Rules types.NamespacedName
+
+	// secrets holds the TLS Secrets of the cluster
+	secrets cache.Indexer
+	now     func() time.Time
+}
+
+// certExpiryRule files the certificates of the TLS Secrets of Namespaces, any
+// when empty, matching Selector DaysBefore days before they expire
+type certExpiryRule struct {
+	Namespaces []string              `json:"namespaces,omitempty"`
+	Selector   *metav1.LabelSelector `json:"selector,omitempty"`
+	DaysBefore int                   `json:"daysBefore,omitempty"`
+	Provider   string                `json:"provider,omitempty"`
+	Repo       string                `json:"repo"`
+	Labels     []string              `json:"labels,omitempty"`
+}
+
+// The Secrets access is granted by config/cert-expiry, it is not part of the
+// manager role since the watcher is opt-in.
+
+// Reconcile checks the certificate of a TLS Secret. The issue is refreshed
+// every day so that its body tells how many days are left.
+func (r *CertExpiryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("secret", req.NamespacedName)
+
+	stored, err := corelisters.NewSecretLister(r.secrets).Secrets(req.Namespace).Get(req.Name)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	secret := *stored
+	if secret.Type != corev1.SecretTypeTLS {
+		return ctrl.Result{}, nil
+	}
+	rules, err := r.loadRules(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	rule, err := matchCertExpiryRule(rules, secret)
+	if err != nil || rule == nil {
+		return ctrl.Result{}, err
+	}
+
+	cert, err := parseLeafCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		log.Info("the Secret holds no valid certificate", "error", err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	source := sourceFingerprint(secret.Namespace + "/" + secret.Name)
+	key := types.NamespacedName{Namespace: secret.Namespace, Name: "cert-" + source}
+	daysBefore := rule.DaysBefore
+	if daysBefore <= 0 {
+		daysBefore = defaultCertDaysBefore
+	}
+	left := cert.NotAfter.Sub(r.clock())
+	if due := left - time.Duration(daysBefore)*day; due > 0 {
+		// a renewed certificate closes the issue of the previous one
+		err := syncGeneratedIssue(ctx, r.Client, key, certificateLabel, source, false, func(ghIssue *examplev1alpha1.GitHubIssue) {
+			ghIssue.Spec.State = "closed"
+		})
+		return ctrl.Result{RequeueAfter: due}, err
+	}
+
+	log.Info("the certificate expires soon", "notAfter", cert.NotAfter)
+	err = syncGeneratedIssue(ctx, r.Client, key, certificateLabel, source, true, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.Spec = examplev1alpha1.GitHubIssueSpec{Provider: rule.Provider, Repo: rule.Repo, Labels: rule.Labels}
+		}
+		ghIssue.Spec.State = "open"
+		ghIssue.Spec.Title = fmt.Sprintf("Renew the certificate of Secret %s/%s, it expires on %s", secret.Namespace, secret.Name, cert.NotAfter.UTC().Format("2006-01-02"))
+		ghIssue.Spec.Description = certExpiryBody(secret, cert, left)
+	})
+	return ctrl.Result{RequeueAfter: day}, err
+}
+
+// parseLeafCertificate is the first certificate of a PEM chain, the one of the server
+func parseLeafCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate in %s", corev1.TLSCertKey)
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+func certExpiryBody(secret corev1.Secret, cert *x509.Certificate, left time.Duration) string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	expiry := fmt.Sprintf("expires in %d days", int(left/day))
+	if left <= 0 {
+		expiry = fmt.Sprintf("expired %d days ago", int(-left/day))
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "The certificate of Secret `%s` in namespace `%s` %s.\n\n", secret.Name, secret.Namespace, expiry)
+	fmt.Fprintf(&body, "- Subject: %s\n", cert.Subject)
+	if len(sans) > 0 {
+		fmt.Fprintf(&body, "- SANs: %s\n", strings.Join(sans, ", "))
+	}
+	fmt.Fprintf(&body, "- Issuer: %s\n- Expires: %s\n", cert.Issuer, cert.NotAfter.UTC().Format(time.RFC3339))
+	return body.String()
+}
+
+func (r *CertExpiryReconciler) loadRules(ctx context.Context) ([]certExpiryRule, error) {
+	var config struct {
+		Rules []certExpiryRule `json:"rules"`
+	}
+	if err := loadRules(ctx, r.Client, r.Rules, &config); err != nil {
+		return nil, err
+	}
+	for i, rule := range config.Rules {
+		if rule.Repo == "" {
+			return nil, fmt.Errorf("rule %d of %s has no repo", i, r.Rules)
+		}
+	}
+	return config.Rules, nil
+}
+
+func matchCertExpiryRule(rules []certExpiryRule, secret corev1.Secret) (*certExpiryRule, error) {
+	for i, rule := range rules {
+		matches, err := matchesSelector(rule.Namespaces, rule.Selector, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if matches {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *CertExpiryReconciler) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// SetupWithManager sets up the controller with the Manager. The Secrets are
+// listed and watched with a type=kubernetes.io/tls field selector.
+func (r *CertExpiryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	listWatch := cache.NewFilteredListWatchFromClient(r.KubeClient.CoreV1().RESTClient(), "secrets", metav1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("type", string(corev1.SecretTypeTLS)).String()
+	})
+	informer := cache.NewSharedIndexInformer(listWatch, &corev1.Secret{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	r.secrets = informer.GetIndexer()
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		informer.Run(ctx.Done())
+		return nil
+	})); err != nil {
+		return err
+	}
+
+	c, err := controller.New("certexpiry", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Informer{Informer: informer}, &handler.EnqueueRequestForObject{})
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testCertExpiryRules = `rules:
+- namespaces: [default]
+  daysBefore: 14
+  repo: AlmogLevii/example-operator
+  labels: [certificates]
+`
+
+var testCertNow = time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+// newTestCertExpiryReconciler is a reconciler watching secrets, the Secrets
+// are only in its own store as they are not read through the client
+func newTestCertExpiryReconciler(t *testing.T, secrets ...*corev1.Secret) *CertExpiryReconciler {
+	rules, key := newTestRules("cert-rules", testCertExpiryRules)
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, secret := range secrets {
+		if err := store.Add(secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &CertExpiryReconciler{
+		Client:  newTestClient(t, rules),
+		Log:     logr.Discard(),
+		Rules:   key,
+		secrets: store,
+		now:     func() time.Time { return testCertNow },
+	}
+}
+
+// newTestCertificate is the PEM of a self-signed certificate of www.example.com
+func newTestCertificate(t *testing.T, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com", Organization: []string{"Example"}},
+		DNSNames:     []string{"www.example.com", "example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTestTLSSecret(name string, cert []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: cert, corev1.TLSPrivateKeyKey: []byte("key")},
+	}
+}
+
+func TestCertExpiry(t *testing.T) {
+	secret := newTestTLSSecret("www-tls", newTestCertificate(t, testCertNow.AddDate(0, 0, 10)))
+	r := newTestCertExpiryReconciler(t, secret)
+
+	if result := reconcileRequest(t, r, "default", secret.Name); result.RequeueAfter != day {
+		t.Errorf("RequeueAfter = %v, want a day", result.RequeueAfter)
+	}
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want one for the expiring certificate", ghIssues)
+	}
+	spec := ghIssues[0].Spec
+	if spec.Title != "Renew the certificate of Secret default/www-tls, it expires on 2021-06-11" || spec.State != "open" || spec.Repo != testRepo {
+		t.Errorf("spec = %+v, want an open issue for www-tls", spec)
+	}
+	for _, want := range []string{
+		"The certificate of Secret `www-tls` in namespace `default` expires in 10 days.",
+		"- Subject: CN=www.example.com,O=Example",
+		"- SANs: www.example.com, example.com, 10.0.0.1",
+		"- Expires: 2021-06-11T10:00:00Z",
+	} {
+		if !strings.Contains(spec.Description, want) {
+			t.Errorf("description = %q, want %q", spec.Description, want)
+		}
+	}
+
+	// the body follows the days left
+	r.now = func() time.Time { return testCertNow.AddDate(0, 0, 12) }
+	reconcileRequest(t, r, "default", secret.Name)
+	if spec := listGitHubIssues(t, r.Client)[0].Spec; !strings.Contains(spec.Description, "expired 2 days ago") {
+		t.Errorf("description = %q, want the certificate expired", spec.Description)
+	}
+
+	secret.Data[corev1.TLSCertKey] = newTestCertificate(t, testCertNow.AddDate(1, 0, 0))
+	if err := r.secrets.Update(secret); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRequest(t, r, "default", secret.Name)
+	if spec := listGitHubIssues(t, r.Client)[0].Spec; spec.State != "closed" {
+		t.Errorf("state = %q, want closed once renewed", spec.State)
+	}
+}
+
+func TestCertExpiryIgnored(t *testing.T) {
+	notDue := newTestTLSSecret("not-due", newTestCertificate(t, testCertNow.AddDate(0, 0, 20)))
+	invalid := newTestTLSSecret("invalid", []byte("not a certificate"))
+	opaque := newTestTLSSecret("opaque", newTestCertificate(t, testCertNow.AddDate(0, 0, 1)))
+	opaque.Type = corev1.SecretTypeOpaque
+	r := newTestCertExpiryReconciler(t, notDue, invalid, opaque)
+
+	if result := reconcileRequest(t, r, "default", notDue.Name); result.RequeueAfter != 6*day {
+		t.Errorf("RequeueAfter = %v, want the time until the certificate is due", result.RequeueAfter)
+	}
+	for _, name := range []string{invalid.Name, opaque.Name, "deleted"} {
+		reconcileRequest(t, r, "default", name)
+	}
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none", ghIssues)
+	}
+}
@@ -0,0 +1,415 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CloudEventsPath is the path the CloudEvents are posted to
+	CloudEventsPath = "/cloudevents"
+
+	cloudEventSubjectLabel        = "example.training.redhat.com/cloudevent-subject"
+	cloudEventSourceAnnotation    = "example.training.redhat.com/cloudevent-source"
+	cloudEventSubjectAnnotation   = "example.training.redhat.com/cloudevent-subject"
+	cloudEventTimeAnnotation      = "example.training.redhat.com/cloudevent-time"
+	cloudEventIDAnnotation        = "example.training.redhat.com/cloudevent-id"
+	cloudEventsSpecVersion        = "1.0"
+	cloudEventsStructuredType     = "application/cloudevents+json"
+	cloudEventsBatchType          = "application/cloudevents-batch+json"
+	cloudEventsBinaryHeaderPrefix = "Ce-"
+
+	defaultCloudEventTitleTemplate = `{{ .Type }}: {{ .Subject }}`
+	defaultCloudEventBodyTemplate  = "`{{ .Source }}` sent `{{ .Type }}` about `{{ .Subject }}`{{ with .Time }} at {{ . }}{{ end }}.\n" +
+		"{{ with .DataJSON }}\n```\n{{ . }}\n```\n{{ end }}"
+)
+
+// CloudEventsReceiver files the CloudEvents posted to it, in binary or
+// structured mode, as GitHubIssues. The events of the same subject land on
+// the same issue, the first matching rule of the rules ConfigMap tells
+// where it is filed and whether the event opens or closes it.
+type CloudEventsReceiver struct {
+	Client      client.Client
+	Log         logr.Logger
+	BindAddress string
+	// Rules is the ConfigMap holding the rules under rules.yaml
+	Rules types.NamespacedName
+	// Token is the bearer token the senders have to send, when set
+	Token string
+}
+
+// cloudEventRule files the events of Types from Sources, any when empty, for
+// which When renders true as GitHubIssues of Namespace. When, State, Title and
+// Body are templates executed against the event.
+type cloudEventRule struct {
+	Types     []string `json:"types,omitempty"`
+	Sources   []string `json:"sources,omitempty"`
+	When      string   `json:"when,omitempty"`
+	Namespace string   `json:"namespace"`
+	Provider  string   `json:"provider,omitempty"`
+	Repo      string   `json:"repo"`
+	Labels    []string `json:"labels,omitempty"`
+	// State renders open or closed, an event that closes an issue never filed is dropped
+	State string `json:"state,omitempty"`
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	// PerSource files the events of the same subject from different sources on different issues
+	PerSource bool `json:"perSource,omitempty"`
+}
+
+// cloudEvent holds the context attributes and the data of a CloudEvent, the
+// data is decoded when it is JSON
+type cloudEvent struct {
+	SpecVersion     string
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            string
+	DataContentType string
+	DataSchema      string
+	Extensions      map[string]string
+	Data            interface{}
+}
+
+// DataJSON is the data of the event as indented JSON, or as it was sent when it isn't JSON
+func (e cloudEvent) DataJSON() string {
+	switch data := e.Data.(type) {
+	case nil:
+		return ""
+	case string:
+		return data
+	default:
+		out, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return fmt.Sprint(data)
+		}
+		return string(out)
+	}
+}
+
+// Start serves the endpoint until ctx is done
+func (r *CloudEventsReceiver) Start(ctx context.Context) error {
+	r.Log.Info("serving the CloudEvents endpoint", "address", r.BindAddress, "path", CloudEventsPath)
+	if r.Token == "" {
+		r.Log.Error(nil, "CLOUDEVENTS_WEBHOOK_TOKEN is not set, anyone who can reach the endpoint can file issues")
+	}
+	return serveWebhook(ctx, r.BindAddress, CloudEventsPath, r)
+}
+
+// NeedLeaderElection is false, every replica can take events as the
+// GitHubIssue of a subject has a fixed name
+func (r *CloudEventsReceiver) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP files an event. A failure answers 500 so that the sender retries,
+// an event no rule matches is acknowledged and dropped.
+func (r *CloudEventsReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Token != "" && subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+r.Token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid event: %v", err), http.StatusBadRequest)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == cloudEventsBatchType {
+		http.Error(w, "batched events are not supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	var event cloudEvent
+	if mediaType == cloudEventsStructuredType {
+		event, err = parseStructuredCloudEvent(body)
+	} else {
+		event, err = parseBinaryCloudEvent(req.Header, body)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid event: %v", err), http.StatusBadRequest)
+		return
+	}
+	log := r.Log.WithValues("id", event.ID, "source", event.Source, "type", event.Type, "subject", event.Subject)
+	if event.Subject == "" {
+		log.Info("the event has no subject to file it under, it is dropped")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rules, err := r.loadRules(req.Context())
+	if err != nil {
+		log.Error(err, "failed to load the CloudEvents rules")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rule, err := matchCloudEventRule(rules, event)
+	if err != nil {
+		log.Error(err, "failed to match the event")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rule == nil {
+		log.Info("no rule matches the event, it is dropped")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := r.fileCloudEvent(req.Context(), *rule, event); err != nil {
+		log.Error(err, "failed to file the event")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseBinaryCloudEvent reads the attributes from the ce- headers, the body is the data
+func parseBinaryCloudEvent(header http.Header, body []byte) (cloudEvent, error) {
+	event := cloudEvent{Extensions: map[string]string{}}
+	for name, values := range header {
+		if !strings.HasPrefix(name, cloudEventsBinaryHeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			value = values[0]
+		}
+		switch attribute := strings.ToLower(strings.TrimPrefix(name, cloudEventsBinaryHeaderPrefix)); attribute {
+		case "specversion":
+			event.SpecVersion = value
+		case "id":
+			event.ID = value
+		case "source":
+			event.Source = value
+		case "type":
+			event.Type = value
+		case "subject":
+			event.Subject = value
+		case "time":
+			event.Time = value
+		case "dataschema":
+			event.DataSchema = value
+		default:
+			event.Extensions[attribute] = value
+		}
+	}
+	event.DataContentType = header.Get("Content-Type")
+	event.Data = decodeCloudEventData(event.DataContentType, body)
+	return event, validateCloudEvent(event)
+}
+
+// parseStructuredCloudEvent reads the event from its JSON format
+func parseStructuredCloudEvent(body []byte) (cloudEvent, error) {
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(body, &attributes); err != nil {
+		return cloudEvent{}, err
+	}
+
+	event := cloudEvent{Extensions: map[string]string{}}
+	fields := map[string]*string{
+		"specversion":     &event.SpecVersion,
+		"id":              &event.ID,
+		"source":          &event.Source,
+		"type":            &event.Type,
+		"subject":         &event.Subject,
+		"time":            &event.Time,
+		"datacontenttype": &event.DataContentType,
+		"dataschema":      &event.DataSchema,
+	}
+	for name, raw := range attributes {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			// extensions may be booleans or integers
+			value = string(raw)
+		}
+		if field, ok := fields[name]; ok {
+			*field = value
+		} else {
+			event.Extensions[name] = value
+		}
+	}
+
+	if raw, ok := attributes["data_base64"]; ok {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return cloudEvent{}, fmt.Errorf("data_base64 is not a string: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return cloudEvent{}, fmt.Errorf("data_base64 is not base64: %w", err)
+		}
+		event.Data = decodeCloudEventData(event.DataContentType, data)
+	} else if raw, ok := attributes["data"]; ok {
+		if err := json.Unmarshal(raw, &event.Data); err != nil {
+			return cloudEvent{}, fmt.Errorf("invalid data: %w", err)
+		}
+	}
+	return event, validateCloudEvent(event)
+}
+
+// decodeCloudEventData decodes JSON data, any other data is kept as text
+func decodeCloudEventData(contentType string, data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err == nil {
+			return decoded
+		}
+	}
+	return string(data)
+}
+
+func validateCloudEvent(event cloudEvent) error {
+	if event.SpecVersion != cloudEventsSpecVersion {
+		return fmt.Errorf("specversion is %q, want %s", event.SpecVersion, cloudEventsSpecVersion)
+	}
+	if event.ID == "" || event.Source == "" || event.Type == "" {
+		return fmt.Errorf("id, source and type are required")
+	}
+	if event.Time != "" {
+		if _, err := time.Parse(time.RFC3339, event.Time); err != nil {
+			return fmt.Errorf("invalid time: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *CloudEventsReceiver) loadRules(ctx context.Context) ([]cloudEventRule, error) {
+	var config struct {
+		Rules []cloudEventRule `json:"rules"`
+	}
+	if err := loadRules(ctx, r.Client, r.Rules, &config); err != nil {
+		return nil, err
+	}
+	for i, rule := range config.Rules {
+		if rule.Namespace == "" || rule.Repo == "" {
+			return nil, fmt.Errorf("rule %d of %s has no namespace or repo", i, r.Rules)
+		}
+	}
+	return config.Rules, nil
+}
+
+// matchCloudEventRule is the first rule of the type and source of the event whose when renders true
+func matchCloudEventRule(rules []cloudEventRule, event cloudEvent) (*cloudEventRule, error) {
+	for i, rule := range rules {
+		if !matchesAny(rule.Types, event.Type) || !matchesAny(rule.Sources, event.Source) {
+			continue
+		}
+		if rule.When != "" {
+			when, err := executeCloudEventTemplate("when", rule.When, "", event)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			if strings.TrimSpace(when) != "true" {
+				continue
+			}
+		}
+		return &rules[i], nil
+	}
+	return nil, nil
+}
+
+// fileCloudEvent creates the GitHubIssue of the subject of the event or
+// brings it up to date with the event, an event older than the last one
+// filed changes nothing
+func (r *CloudEventsReceiver) fileCloudEvent(ctx context.Context, rule cloudEventRule, event cloudEvent) error {
+	state, err := executeCloudEventTemplate("state", rule.State, "open", event)
+	if err != nil {
+		return err
+	}
+	state = strings.TrimSpace(state)
+	if state != "open" && state != "closed" {
+		return fmt.Errorf("the state template rendered %q, want open or closed", state)
+	}
+	title, err := executeCloudEventTemplate("title", rule.Title, defaultCloudEventTitleTemplate, event)
+	if err != nil {
+		return err
+	}
+	body, err := executeCloudEventTemplate("body", rule.Body, defaultCloudEventBodyTemplate, event)
+	if err != nil {
+		return err
+	}
+
+	// subject is optional, the events without one are told apart by their source
+	subject := event.Subject
+	if rule.PerSource || subject == "" {
+		subject = event.Source + " " + event.Subject
+	}
+	fingerprint := sourceFingerprint(subject)
+	key := types.NamespacedName{Namespace: rule.Namespace, Name: "cloudevent-" + fingerprint}
+	return syncGeneratedIssue(ctx, r.Client, key, cloudEventSubjectLabel, fingerprint, state == "open", func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.Annotations = map[string]string{cloudEventSourceAnnotation: event.Source, cloudEventSubjectAnnotation: event.Subject}
+			ghIssue.Spec = examplev1alpha1.GitHubIssueSpec{Provider: rule.Provider, Repo: rule.Repo, Labels: rule.Labels}
+		}
+		if cloudEventBefore(event.Time, ghIssue.Annotations[cloudEventTimeAnnotation]) {
+			return
+		}
+		if ghIssue.Annotations == nil {
+			ghIssue.Annotations = map[string]string{}
+		}
+		ghIssue.Annotations[cloudEventIDAnnotation] = event.ID
+		if event.Time != "" {
+			ghIssue.Annotations[cloudEventTimeAnnotation] = event.Time
+		}
+		ghIssue.Spec.Title = title
+		ghIssue.Spec.Description = body
+		ghIssue.Spec.State = state
+	})
+}
+
+// cloudEventBefore is whether the event happened before the last one filed,
+// the events without a time are taken in the order they come
+func cloudEventBefore(eventTime string, lastTime string) bool {
+	if eventTime == "" || lastTime == "" {
+		return false
+	}
+	event, err := time.Parse(time.RFC3339, eventTime)
+	if err != nil {
+		return false
+	}
+	last, err := time.Parse(time.RFC3339, lastTime)
+	return err == nil && event.Before(last)
+}
+
+func executeCloudEventTemplate(name string, text string, defaultText string, event cloudEvent) (string, error) {
+	if text == "" {
+		text = defaultText
+	}
+	tmpl, err := template.New(name).Funcs(safeFuncMap()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the %s template: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, event); err != nil {
+		return "", fmt.Errorf("failed to execute the %s template: %w", name, err)
+	}
+	return truncate(out.String(), maxRenderedBodySize), nil
+}
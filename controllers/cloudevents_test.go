@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+const testCloudEventRules = `rules:
+- types: [dev.tekton.event.pipelinerun.failed.v1, dev.tekton.event.pipelinerun.successful.v1]
+  namespace: ci
+  repo: AlmogLevii/example-operator
+  labels: [ci]
+  state: '{{ if hasSuffix "failed.v1" .Type }}open{{ else }}closed{{ end }}'
+  title: 'Pipeline {{ .Subject }} failed'
+- sources: [/backup]
+  when: '{{ eq .Extensions.severity "critical" }}'
+  namespace: default
+  repo: AlmogLevii/example-operator
+- types: [dev.example.audit.v1]
+  perSource: true
+  namespace: default
+  repo: AlmogLevii/example-operator
+`
+
+func newTestCloudEventsReceiver(t *testing.T) *CloudEventsReceiver {
+	rules, key := newTestRules("cloudevent-rules", testCloudEventRules)
+	return &CloudEventsReceiver{
+		Client: newTestClient(t, rules),
+		Log:    logr.Discard(),
+		Rules:  key,
+		Token:  "cloudevents-token",
+	}
+}
+
+// postBinaryCloudEvent posts an event in binary mode, attributes are the ce- headers
+func postBinaryCloudEvent(t *testing.T, receiver *CloudEventsReceiver, attributes map[string]string, data string) int {
+	req := httptest.NewRequest(http.MethodPost, CloudEventsPath, strings.NewReader(data))
+	req.Header.Set("Authorization", "Bearer cloudevents-token")
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range attributes {
+		req.Header.Set("Ce-"+name, value)
+	}
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func postStructuredCloudEvent(t *testing.T, receiver *CloudEventsReceiver, event string) int {
+	req := httptest.NewRequest(http.MethodPost, CloudEventsPath, strings.NewReader(event))
+	req.Header.Set("Authorization", "Bearer cloudevents-token")
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func pipelineRunEvent(id string, eventType string, time string) map[string]string {
+	return map[string]string{
+		"specversion": "1.0",
+		"id":          id,
+		"source":      "/tekton/pipelines",
+		"type":        eventType,
+		"subject":     "build-main",
+		"time":        time,
+	}
+}
+
+func TestCloudEventsBinary(t *testing.T) {
+	receiver := newTestCloudEventsReceiver(t)
+
+	failed := pipelineRunEvent("1", "dev.tekton.event.pipelinerun.failed.v1", "2021-06-01T10:00:00Z")
+	if code := postBinaryCloudEvent(t, receiver, failed, `{"reason": "TaskRunFailed"}`); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	ghIssues := listGitHubIssues(t, receiver.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want one for the subject", ghIssues)
+	}
+	ghIssue := ghIssues[0]
+	if ghIssue.Namespace != "ci" || ghIssue.Spec.Title != "Pipeline build-main failed" || ghIssue.Spec.State != "open" || !sameStrings(ghIssue.Spec.Labels, []string{"ci"}) {
+		t.Errorf("GitHubIssue = %+v, want an open issue in ci", ghIssue)
+	}
+	if !strings.Contains(ghIssue.Spec.Description, `"reason": "TaskRunFailed"`) {
+		t.Errorf("description = %q, want the data of the event", ghIssue.Spec.Description)
+	}
+
+	// a late delivery of an older event changes nothing
+	succeeded := pipelineRunEvent("2", "dev.tekton.event.pipelinerun.successful.v1", "2021-06-01T11:00:00Z")
+	postBinaryCloudEvent(t, receiver, succeeded, "")
+	postBinaryCloudEvent(t, receiver, failed, `{"reason": "TaskRunFailed"}`)
+	ghIssues = listGitHubIssues(t, receiver.Client)
+	if len(ghIssues) != 1 || ghIssues[0].Spec.State != "closed" || ghIssues[0].Annotations[cloudEventIDAnnotation] != "2" {
+		t.Errorf("GitHubIssues = %+v, want the issue closed by the newest event", ghIssues)
+	}
+}
+
+func TestCloudEventsSubject(t *testing.T) {
+	receiver := newTestCloudEventsReceiver(t)
+
+	// the same pipeline reported by another source lands on the same issue
+	failed := pipelineRunEvent("1", "dev.tekton.event.pipelinerun.failed.v1", "2021-06-01T10:00:00Z")
+	postBinaryCloudEvent(t, receiver, failed, "")
+	failed["source"], failed["id"] = "/tekton/triggers", "2"
+	postBinaryCloudEvent(t, receiver, failed, "")
+	if ghIssues := listGitHubIssues(t, receiver.Client); len(ghIssues) != 1 {
+		t.Errorf("GitHubIssues = %d, want one for the subject", len(ghIssues))
+	}
+
+	audit := map[string]string{"specversion": "1.0", "id": "3", "source": "/audit/a", "type": "dev.example.audit.v1", "subject": "build-main"}
+	postBinaryCloudEvent(t, receiver, audit, "")
+	audit["source"], audit["id"] = "/audit/b", "4"
+	postBinaryCloudEvent(t, receiver, audit, "")
+	if ghIssues := listGitHubIssues(t, receiver.Client); len(ghIssues) != 3 {
+		t.Errorf("GitHubIssues = %d, want one per source of the perSource rule", len(ghIssues))
+	}
+}
+
+func TestCloudEventsStructured(t *testing.T) {
+	receiver := newTestCloudEventsReceiver(t)
+	event := `{
+		"specversion": "1.0",
+		"id": "42",
+		"source": "/backup",
+		"type": "com.example.backup.failed",
+		"subject": "postgres",
+		"severity": "critical",
+		"datacontenttype": "text/plain",
+		"data_base64": "ZGlzayBmdWxs"
+	}`
+
+	if code := postStructuredCloudEvent(t, receiver, event); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	ghIssues := listGitHubIssues(t, receiver.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want one for the critical backup", ghIssues)
+	}
+	spec := ghIssues[0].Spec
+	if spec.Title != "com.example.backup.failed: postgres" || !strings.Contains(spec.Description, "disk full") {
+		t.Errorf("spec = %+v, want the default title and the data in the body", spec)
+	}
+
+	// the when template doesn't match a warning
+	warning := strings.Replace(strings.Replace(event, `"critical"`, `"warning"`, 1), `"postgres"`, `"redis"`, 1)
+	if code := postStructuredCloudEvent(t, receiver, warning); code != http.StatusOK {
+		t.Errorf("status = %d, want 200", code)
+	}
+	if ghIssues := listGitHubIssues(t, receiver.Client); len(ghIssues) != 1 {
+		t.Errorf("GitHubIssues = %d, want the warning dropped", len(ghIssues))
+	}
+}
+
+func TestCloudEventsRejected(t *testing.T) {
+	receiver := newTestCloudEventsReceiver(t)
+
+	missingType := pipelineRunEvent("1", "", "")
+	if code := postBinaryCloudEvent(t, receiver, missingType, ""); code != http.StatusBadRequest {
+		t.Errorf("status without type = %d, want 400", code)
+	}
+	if code := postStructuredCloudEvent(t, receiver, `{"specversion": "0.3", "id": "1", "source": "/a", "type": "b"}`); code != http.StatusBadRequest {
+		t.Errorf("status of specversion 0.3 = %d, want 400", code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, CloudEventsPath, strings.NewReader("[]"))
+	req.Header.Set("Authorization", "Bearer cloudevents-token")
+	req.Header.Set("Content-Type", cloudEventsBatchType)
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status of a batch = %d, want 415", recorder.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, CloudEventsPath, strings.NewReader(""))
+	recorder = httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("status without token = %d, want 401", recorder.Code)
+	}
+	if ghIssues := listGitHubIssues(t, receiver.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none", ghIssues)
+	}
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// conformanceMilestone must exist in the repos of the conformance run
+const conformanceMilestone = "v1"
+
+// runGitHubClientConformance checks a GitHubClient backend against the
+// behaviour the reconciler relies on. newClient must return a client of a repo
+// with a milestone named conformanceMilestone every time it is called, the repo
+// may hold the issues of earlier runs so the checks only rely on the issues they create.
+// Backends without labels and milestones answer errNotSupported when asked for them,
+// comments are only checked on the backends implementing Commenter.
+func runGitHubClientConformance(t *testing.T, newClient func(t *testing.T) GitHubClient) {
+	ctx := context.Background()
+
+	create := func(t *testing.T, ghClient GitHubClient, title string) *IssueData {
+		created, ie := ghClient.Create(ctx, IssueData{Name: "conformance", Title: title, Description: title + " body"})
+		mustSucceed(t, "Create", ie)
+		return created
+	}
+
+	t.Run("create", func(t *testing.T) {
+		created := create(t, newClient(t), "create")
+		if created.Number == 0 {
+			t.Errorf("created issue has no number")
+		}
+		if created.Title != "create" || created.Description != "create body" || created.State != "open" {
+			t.Errorf("created issue = %+v, want an open issue with the sent title and body", *created)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		ghClient := newClient(t)
+		created := create(t, ghClient, "get")
+
+		got, ie := ghClient.Get(ctx, created.Number)
+		mustSucceed(t, "Get", ie)
+		if got.Number != created.Number || got.Title != "get" || got.Description != "get body" || got.State != "open" {
+			t.Errorf("Get() = %+v, want %+v", *got, *created)
+		}
+	})
+
+	t.Run("get a missing issue", func(t *testing.T) {
+		ghClient := newClient(t)
+		if _, ie := ghClient.Get(ctx, missingIssue(t, ghClient)); requestSucceeded(ie.Err) {
+			t.Errorf("Get() of a missing issue succeeded")
+		}
+	})
+
+	t.Run("list includes closed issues", func(t *testing.T) {
+		ghClient := newClient(t)
+		open := create(t, ghClient, "list open")
+		closed := create(t, ghClient, "list closed")
+		mustSucceed(t, "Close", ghClient.Close(ctx, *closed))
+
+		issues, ie := ghClient.List(ctx)
+		mustSucceed(t, "List", ie)
+		states := map[int]string{}
+		for _, issue := range issues {
+			states[issue.Number] = issue.State
+		}
+		if states[open.Number] != "open" || states[closed.Number] != "closed" {
+			t.Errorf("List() states = %v, want one open and one closed issue", states)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		ghClient := newClient(t)
+		created := create(t, ghClient, "update")
+		created.Description = "edited body"
+
+		updated, ie := ghClient.Update(ctx, *created)
+		mustSucceed(t, "Update", ie)
+		if updated.Description != "edited body" || updated.State != "open" {
+			t.Errorf("Update() = %+v, want the edited body", *updated)
+		}
+		got, ie := ghClient.Get(ctx, created.Number)
+		mustSucceed(t, "Get", ie)
+		if got.Description != "edited body" {
+			t.Errorf("Get() after Update() body = %q, want %q", got.Description, "edited body")
+		}
+	})
+
+	t.Run("close and reopen", func(t *testing.T) {
+		ghClient := newClient(t)
+		created := create(t, ghClient, "close")
+		mustSucceed(t, "Close", ghClient.Close(ctx, *created))
+
+		got, ie := ghClient.Get(ctx, created.Number)
+		mustSucceed(t, "Get", ie)
+		if got.State != "closed" {
+			t.Fatalf("state after Close() = %q, want closed", got.State)
+		}
+
+		got.State = "open"
+		reopened, ie := ghClient.Update(ctx, *got)
+		mustSucceed(t, "Update", ie)
+		if reopened.State != "open" {
+			t.Errorf("state after reopening = %q, want open", reopened.State)
+		}
+	})
+
+	t.Run("labels and milestone", func(t *testing.T) {
+		ghClient := newClient(t)
+		created, ie := ghClient.Create(ctx, IssueData{
+			Name:        "conformance",
+			Title:       "labels",
+			Description: "labels body",
+			Labels:      []string{"bug", "triage"},
+			Milestone:   conformanceMilestone,
+		})
+		if errors.Is(ie.Err, errNotSupported) {
+			t.Skip(ie.Err)
+		}
+		mustSucceed(t, "Create", ie)
+
+		got, ie := ghClient.Get(ctx, created.Number)
+		mustSucceed(t, "Get", ie)
+		if !sameStrings(got.Labels, []string{"bug", "triage"}) || got.Milestone != conformanceMilestone {
+			t.Fatalf("Get() labels = %v milestone = %q, want [bug triage] %q", got.Labels, got.Milestone, conformanceMilestone)
+		}
+
+		got.Labels = []string{"bug"}
+		_, ie = ghClient.Update(ctx, *got)
+		mustSucceed(t, "Update", ie)
+		got, ie = ghClient.Get(ctx, created.Number)
+		mustSucceed(t, "Get", ie)
+		if !sameStrings(got.Labels, []string{"bug"}) || got.Milestone != conformanceMilestone {
+			t.Errorf("Get() after Update() labels = %v milestone = %q, want [bug] %q", got.Labels, got.Milestone, conformanceMilestone)
+		}
+	})
+
+	t.Run("comment", func(t *testing.T) {
+		ghClient := newClient(t)
+		commenter, ok := ghClient.(Commenter)
+		if !ok {
+			t.Skip("the backend has no comments")
+		}
+		created := create(t, ghClient, "comment")
+
+		mustSucceed(t, "Comment", commenter.Comment(ctx, *created, "a comment"))
+		if ie := commenter.Comment(ctx, IssueData{Name: "conformance", Number: missingIssue(t, ghClient)}, "a comment"); requestSucceeded(ie.Err) {
+			t.Errorf("Comment() on a missing issue succeeded")
+		}
+	})
+}
+
+// missingIssue is a number that no issue of the repo has
+func missingIssue(t *testing.T, ghClient GitHubClient) int {
+	t.Helper()
+	issues, ie := ghClient.List(context.Background())
+	mustSucceed(t, "List", ie)
+	missing := 4242
+	for _, issue := range issues {
+		if issue.Number >= missing {
+			missing = issue.Number + 1000
+		}
+	}
+	return missing
+}
+
+func mustSucceed(t *testing.T, call string, ie *InfoError) {
+	t.Helper()
+	if !requestSucceeded(ie.Err) {
+		t.Fatalf("%s() error = %v (%s)", call, ie.Err, ie.Message)
+	}
+}
+
+func TestFakeGitHubClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		return NewFakeGitHubClient(testRepo)
+	})
+}
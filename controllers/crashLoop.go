@@ -0,0 +1,415 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	workloadLabel          = "example.training.redhat.com/workload"
+	healthySinceAnnotation = "example.training.redhat.com/healthy-since"
+	// crashesAnnotation holds the crashes last written to the issue body
+	crashesAnnotation = "example.training.redhat.com/crashes"
+	// workloadRefAnnotation is the kind/name of the workload of the issue
+	workloadRefAnnotation   = "example.training.redhat.com/workload-ref"
+	reasonCrashLoopBackOff  = "CrashLoopBackOff"
+	reasonOOMKilled         = "OOMKilled"
+	defaultRestartThreshold = 3
+	defaultLogLines         = 50
+	defaultHealthyWindow    = 30 * time.Minute
+)
+
+// CrashLoopReconciler opens a GitHubIssue for each workload whose pods crash
+// loop or get OOM killed, and closes it once the workload has been healthy
+// for HealthyWindow. The workload is the Deployment, StatefulSet, DaemonSet or
+// Job controlling the pod, or the pod itself when it has no controller.
+type CrashLoopReconciler struct {
+	client.Client
+	// KubeClient reads the logs of the crashed containers
+	KubeClient kubernetes.Interface
+	Log        logr.Logger
+	// Rules is the ConfigMap holding the rules under rules.yaml
+	Rules types.NamespacedName
+	// RestartThreshold is the number of restarts from which a container counts as crashing
+	RestartThreshold int32
+	// LogLines is the number of log lines of the crashed container put in the issue
+	LogLines int64
+	// HealthyWindow is how long a workload stays healthy before its issue is closed
+	HealthyWindow time.Duration
+
+	now func() time.Time
+}
+
+// crashLoopRule files the crashing workloads of Namespaces, any when empty,
+// whose pods match Selector
+type crashLoopRule struct {
+	Namespaces []string              `json:"namespaces,omitempty"`
+	Selector   *metav1.LabelSelector `json:"selector,omitempty"`
+	Provider   string                `json:"provider,omitempty"`
+	Repo       string                `json:"repo"`
+	Labels     []string              `json:"labels,omitempty"`
+}
+
+// workloadRef is the controller owning a crashing pod
+type workloadRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (w workloadRef) fingerprint() string {
+	return sourceFingerprint(strings.Join([]string{w.Kind, w.Namespace, w.Name}, "/"))
+}
+
+// issueKey is the GitHubIssue of the workload
+func (w workloadRef) issueKey() types.NamespacedName {
+	return types.NamespacedName{Namespace: w.Namespace, Name: "crashloop-" + w.fingerprint()}
+}
+
+// crashedContainer is a container of a pod that counts as crashing
+type crashedContainer struct {
+	pod       string
+	container string
+	restarts  int32
+	exitCode  int32
+	reason    string
+	state     string
+	logs      string
+}
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+
+// Reconcile checks the workload of the pod. A deleted pod closes the issues
+// of the workloads left without pods, the pods replacing it are reconciled too.
+func (r *CrashLoopReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("pod", req.NamespacedName)
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, r.closeGoneWorkloads(ctx, req.Namespace)
+		}
+		return ctrl.Result{}, err
+	}
+	rules, err := r.loadRules(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	rule, err := matchCrashLoopRule(rules, pod)
+	if err != nil || rule == nil {
+		return ctrl.Result{}, err
+	}
+
+	workload, err := r.workloadOf(ctx, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	workloadPods, err := r.podsByWorkload(ctx, pod.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var crashed []crashedContainer
+	for _, other := range workloadPods[workload] {
+		crashed = append(crashed, r.crashedContainers(other)...)
+	}
+
+	key := workload.issueKey()
+	if len(crashed) == 0 {
+		return r.closeWhenHealthy(ctx, key, workload)
+	}
+
+	// the logs change on every restart, the body is only rebuilt, and the
+	// logs only read, when the restarts or the exit reasons change
+	crashes := describeCrashes(crashed)
+	var current examplev1alpha1.GitHubIssue
+	if err := r.Get(ctx, key, &current); err == nil && current.Spec.State == "open" &&
+		current.Annotations[crashesAnnotation] == crashes && current.Annotations[healthySinceAnnotation] == "" {
+		return ctrl.Result{}, nil
+	}
+	for i := range crashed {
+		crashed[i].logs = r.previousLogs(ctx, pod.Namespace, crashed[i].pod, crashed[i].container)
+	}
+
+	log.Info("the workload is crashing", "kind", workload.Kind, "name", workload.Name, "containers", len(crashed))
+	return ctrl.Result{}, syncGeneratedIssue(ctx, r.Client, key, workloadLabel, workload.fingerprint(), true, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.Spec = examplev1alpha1.GitHubIssueSpec{Provider: rule.Provider, Repo: rule.Repo, Labels: rule.Labels}
+		}
+		if ghIssue.Annotations == nil {
+			ghIssue.Annotations = map[string]string{}
+		}
+		delete(ghIssue.Annotations, healthySinceAnnotation)
+		ghIssue.Annotations[crashesAnnotation] = crashes
+		ghIssue.Annotations[workloadRefAnnotation] = workload.Kind + "/" + workload.Name
+		ghIssue.Spec.State = "open"
+		ghIssue.Spec.Title = fmt.Sprintf("%s %s/%s is crash looping", workload.Kind, workload.Namespace, workload.Name)
+		ghIssue.Spec.Description = crashLoopBody(workload, crashed)
+	})
+}
+
+// podsByWorkload groups the pods of namespace by their workload
+func (r *CrashLoopReconciler) podsByWorkload(ctx context.Context, namespace string) (map[workloadRef][]corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	workloadPods := map[workloadRef][]corev1.Pod{}
+	for _, pod := range pods.Items {
+		workload, err := r.workloadOf(ctx, pod)
+		if err != nil {
+			return nil, err
+		}
+		workloadPods[workload] = append(workloadPods[workload], pod)
+	}
+	return workloadPods, nil
+}
+
+// closeGoneWorkloads closes the open issues of the workloads of namespace that
+// have no pods left, e.g. a deleted Deployment, as no pod reports them healthy
+func (r *CrashLoopReconciler) closeGoneWorkloads(ctx context.Context, namespace string) error {
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := r.List(ctx, &ghIssues, client.InNamespace(namespace), client.HasLabels{workloadLabel}); err != nil {
+		return err
+	}
+	workloadPods, err := r.podsByWorkload(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	for _, ghIssue := range ghIssues.Items {
+		kindName := strings.SplitN(ghIssue.Annotations[workloadRefAnnotation], "/", 2)
+		if ghIssue.Spec.State == "closed" || len(kindName) != 2 {
+			continue
+		}
+		workload := workloadRef{Kind: kindName[0], Namespace: namespace, Name: kindName[1]}
+		if len(workloadPods[workload]) > 0 {
+			continue
+		}
+		r.Log.Info("the workload has no pods left, closing its issue", "kind", workload.Kind, "name", workload.Name)
+		err := syncGeneratedIssue(ctx, r.Client, workload.issueKey(), workloadLabel, workload.fingerprint(), false, func(ghIssue *examplev1alpha1.GitHubIssue) {
+			delete(ghIssue.Annotations, healthySinceAnnotation)
+			ghIssue.Spec.State = "closed"
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeWhenHealthy records when the workload was first seen healthy and closes
+// its issue once it stayed so for the healthy window
+func (r *CrashLoopReconciler) closeWhenHealthy(ctx context.Context, key types.NamespacedName, workload workloadRef) (ctrl.Result, error) {
+	now := r.clock()
+	requeueAfter := time.Duration(0)
+	err := syncGeneratedIssue(ctx, r.Client, key, workloadLabel, workload.fingerprint(), false, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.Spec.State == "closed" {
+			return
+		}
+		healthySince, err := time.Parse(time.RFC3339, ghIssue.Annotations[healthySinceAnnotation])
+		if err != nil {
+			if ghIssue.Annotations == nil {
+				ghIssue.Annotations = map[string]string{}
+			}
+			ghIssue.Annotations[healthySinceAnnotation] = now.UTC().Format(time.RFC3339)
+			healthySince = now
+		}
+		if left := r.healthyWindow() - now.Sub(healthySince); left > 0 {
+			requeueAfter = left
+			return
+		}
+		ghIssue.Spec.State = "closed"
+	})
+	return ctrl.Result{RequeueAfter: requeueAfter}, err
+}
+
+// crashedContainers are the containers of pod that restarted past the
+// threshold and are backing off or were OOM killed within the healthy window
+func (r *CrashLoopReconciler) crashedContainers(pod corev1.Pod) []crashedContainer {
+	var crashed []crashedContainer
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.RestartCount < r.restartThreshold() {
+			continue
+		}
+		backingOff := status.State.Waiting != nil && status.State.Waiting.Reason == reasonCrashLoopBackOff
+		terminated := status.LastTerminationState.Terminated
+		oomKilled := terminated != nil && terminated.Reason == reasonOOMKilled && r.clock().Sub(terminated.FinishedAt.Time) < r.healthyWindow()
+		if !backingOff && !oomKilled {
+			continue
+		}
+
+		container := crashedContainer{pod: pod.Name, container: status.Name, restarts: status.RestartCount, state: "Running"}
+		if terminated != nil {
+			container.exitCode, container.reason = terminated.ExitCode, terminated.Reason
+		}
+		if status.State.Waiting != nil {
+			container.state = status.State.Waiting.Reason
+		}
+		crashed = append(crashed, container)
+	}
+	return crashed
+}
+
+// previousLogs is the tail of the logs of the last run of the container
+func (r *CrashLoopReconciler) previousLogs(ctx context.Context, namespace string, pod string, container string) string {
+	if r.KubeClient == nil {
+		return ""
+	}
+	return tailLogs(ctx, r.KubeClient, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: pod}}, container, r.LogLines, true)
+}
+
+// describeCrashes is the restarts and exit reasons of the crashed containers
+// in the order of the issue body, without their logs
+func describeCrashes(crashed []crashedContainer) string {
+	sortCrashed(crashed)
+	crashes := make([]string, 0, len(crashed))
+	for _, container := range crashed {
+		crashes = append(crashes, fmt.Sprintf("%s/%s:%d:%d:%s", container.pod, container.container, container.restarts, container.exitCode, container.reason))
+	}
+	return sourceFingerprint(strings.Join(crashes, ","))
+}
+
+// tailLogs is the last lines of the logs of a container, or why they can't be read
+func tailLogs(ctx context.Context, kubeClient kubernetes.Interface, pod corev1.Pod, container string, lines int64, previous bool) string {
+	if lines <= 0 {
+		lines = defaultLogLines
+	}
+	stream, err := kubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: &lines,
+	}).Stream(ctx)
+	if err != nil {
+		return fmt.Sprintf("the logs are not available: %v", err)
+	}
+	defer stream.Close()
+	logs, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return fmt.Sprintf("the logs are not available: %v", err)
+	}
+	return string(logs)
+}
+
+// workloadOf follows the controller of pod, through its ReplicaSet for a Deployment
+func (r *CrashLoopReconciler) workloadOf(ctx context.Context, pod corev1.Pod) (workloadRef, error) {
+	owner := metav1.GetControllerOf(&pod)
+	if owner == nil {
+		return workloadRef{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}, nil
+	}
+	if owner.Kind != "ReplicaSet" {
+		return workloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}, nil
+	}
+
+	var replicaSet appsv1.ReplicaSet
+	err := r.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, &replicaSet)
+	if apierrors.IsNotFound(err) {
+		return workloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}, nil
+	}
+	if err != nil {
+		return workloadRef{}, err
+	}
+	if deployment := metav1.GetControllerOf(&replicaSet); deployment != nil {
+		return workloadRef{Kind: deployment.Kind, Namespace: pod.Namespace, Name: deployment.Name}, nil
+	}
+	return workloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}, nil
+}
+
+func (r *CrashLoopReconciler) loadRules(ctx context.Context) ([]crashLoopRule, error) {
+	var config struct {
+		Rules []crashLoopRule `json:"rules"`
+	}
+	if err := loadRules(ctx, r.Client, r.Rules, &config); err != nil {
+		return nil, err
+	}
+	for i, rule := range config.Rules {
+		if rule.Repo == "" {
+			return nil, fmt.Errorf("rule %d of %s has no repo", i, r.Rules)
+		}
+	}
+	return config.Rules, nil
+}
+
+func matchCrashLoopRule(rules []crashLoopRule, pod corev1.Pod) (*crashLoopRule, error) {
+	for i, rule := range rules {
+		matches, err := matchesSelector(rule.Namespaces, rule.Selector, &pod)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if matches {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// crashLoopBody lists the crashed containers sorted by pod, with the tail of their logs
+func crashLoopBody(workload workloadRef, crashed []crashedContainer) string {
+	sortCrashed(crashed)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "The containers of %s `%s/%s` keep crashing.\n", workload.Kind, workload.Namespace, workload.Name)
+	for _, container := range crashed {
+		fmt.Fprintf(&body, "\n### Pod %s, container %s\n\n", container.pod, container.container)
+		fmt.Fprintf(&body, "- Restarts: %d\n- Last exit code: %d (%s)\n- State: %s\n", container.restarts, container.exitCode, container.reason, container.state)
+		if container.logs != "" {
+			fmt.Fprintf(&body, "\n<details><summary>Logs of the last run</summary>\n\n```\n%s\n```\n</details>\n", strings.TrimRight(container.logs, "\n"))
+		}
+	}
+	return truncate(body.String(), maxRenderedBodySize)
+}
+
+func sortCrashed(crashed []crashedContainer) {
+	sort.Slice(crashed, func(i, j int) bool {
+		if crashed[i].pod != crashed[j].pod {
+			return crashed[i].pod < crashed[j].pod
+		}
+		return crashed[i].container < crashed[j].container
+	})
+}
+
+func (r *CrashLoopReconciler) restartThreshold() int32 {
+	if r.RestartThreshold <= 0 {
+		return defaultRestartThreshold
+	}
+	return r.RestartThreshold
+}
+
+func (r *CrashLoopReconciler) healthyWindow() time.Duration {
+	if r.HealthyWindow <= 0 {
+		return defaultHealthyWindow
+	}
+	return r.HealthyWindow
+}
+
+func (r *CrashLoopReconciler) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CrashLoopReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("crashloop").
+		For(&corev1.Pod{}).
+		Complete(r)
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const testCrashLoopRules = `rules:
+- namespaces: [default]
+  selector:
+    matchLabels:
+      app: web
+  repo: AlmogLevii/example-operator
+`
+
+var testCrashLoopNow = time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestCrashLoopReconciler(t *testing.T, objects ...client.Object) *CrashLoopReconciler {
+	rules, key := newTestRules("crashloop-rules", testCrashLoopRules)
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "web-5d4f",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{controllerRef("Deployment", "web")},
+	}}
+
+	return &CrashLoopReconciler{
+		Client:     newTestClient(t, append(objects, rules, replicaSet)...),
+		KubeClient: kubefake.NewSimpleClientset(),
+		Log:        logr.Discard(),
+		Rules:      key,
+		now:        func() time.Time { return testCrashLoopNow },
+	}
+}
+
+func controllerRef(kind string, name string) metav1.OwnerReference {
+	isController := true
+	return metav1.OwnerReference{APIVersion: "apps/v1", Kind: kind, Name: name, UID: types.UID(name), Controller: &isController}
+}
+
+func newTestPod(name string, status corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{controllerRef("ReplicaSet", "web-5d4f")},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{status}},
+	}
+}
+
+func crashLoopingStatus(restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:                 "app",
+		RestartCount:         restarts,
+		State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reasonCrashLoopBackOff}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+	}
+}
+
+func TestCrashLoop(t *testing.T) {
+	pod := newTestPod("web-5d4f-abcde", crashLoopingStatus(5))
+	r := newTestCrashLoopReconciler(t, pod)
+
+	reconcileRequest(t, r, "default", pod.Name)
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want one for the Deployment", ghIssues)
+	}
+	spec := ghIssues[0].Spec
+	if spec.Title != "Deployment default/web is crash looping" || spec.State != "open" || spec.Repo != testRepo {
+		t.Errorf("spec = %+v, want an open issue for Deployment web", spec)
+	}
+	for _, want := range []string{"### Pod web-5d4f-abcde, container app", "- Restarts: 5", "- Last exit code: 1 (Error)", "- State: CrashLoopBackOff", "fake logs"} {
+		if !strings.Contains(spec.Description, want) {
+			t.Errorf("description = %q, want %q", spec.Description, want)
+		}
+	}
+
+	// the pod recovers, the issue is closed once the window has passed
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	if result := reconcileRequest(t, r, "default", pod.Name); result.RequeueAfter != defaultHealthyWindow {
+		t.Errorf("RequeueAfter = %v, want the healthy window", result.RequeueAfter)
+	}
+	if ghIssue := listGitHubIssues(t, r.Client)[0]; ghIssue.Spec.State != "open" || ghIssue.Annotations[healthySinceAnnotation] != "2021-06-01T10:00:00Z" {
+		t.Errorf("GitHubIssue = %+v, want it open and healthy since now", ghIssue)
+	}
+
+	r.now = func() time.Time { return testCrashLoopNow.Add(defaultHealthyWindow) }
+	reconcileRequest(t, r, "default", pod.Name)
+	if ghIssue := listGitHubIssues(t, r.Client)[0]; ghIssue.Spec.State != "closed" {
+		t.Errorf("state = %q, want closed after the healthy window", ghIssue.Spec.State)
+	}
+}
+
+// logReads counts the log requests of the crash loop reconciler
+func logReads(r *CrashLoopReconciler) int {
+	reads := 0
+	for _, action := range r.KubeClient.(*kubefake.Clientset).Actions() {
+		if action.GetSubresource() == "log" {
+			reads++
+		}
+	}
+	return reads
+}
+
+func TestCrashLoopRestarts(t *testing.T) {
+	pod := newTestPod("web-5d4f-abcde", crashLoopingStatus(5))
+	r := newTestCrashLoopReconciler(t, pod)
+
+	reconcileRequest(t, r, "default", pod.Name)
+	filed := listGitHubIssues(t, r.Client)[0]
+	reconcileRequest(t, r, "default", pod.Name)
+	if logReads(r) != 1 || listGitHubIssues(t, r.Client)[0].ResourceVersion != filed.ResourceVersion {
+		t.Errorf("log reads = %d, want the logs read and the issue written once while nothing changed", logReads(r))
+	}
+
+	pod.Status.ContainerStatuses[0].RestartCount = 6
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRequest(t, r, "default", pod.Name)
+	if description := listGitHubIssues(t, r.Client)[0].Spec.Description; logReads(r) != 2 || !strings.Contains(description, "- Restarts: 6") {
+		t.Errorf("log reads = %d, description = %q, want the body rebuilt for the new restart", logReads(r), description)
+	}
+}
+
+func TestCrashLoopWorkloadGone(t *testing.T) {
+	pod := newTestPod("web-5d4f-abcde", crashLoopingStatus(5))
+	other := newTestPod("api-1", crashLoopingStatus(5))
+	other.OwnerReferences = nil
+	r := newTestCrashLoopReconciler(t, pod, other)
+	reconcileRequest(t, r, "default", pod.Name)
+	reconcileRequest(t, r, "default", other.Name)
+
+	// the Deployment is deleted with its pods
+	if err := r.Delete(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRequest(t, r, "default", pod.Name)
+
+	states := map[string]string{}
+	for _, ghIssue := range listGitHubIssues(t, r.Client) {
+		states[ghIssue.Annotations[workloadRefAnnotation]] = ghIssue.Spec.State
+	}
+	if states["Deployment/web"] != "closed" || states["Pod/api-1"] != "open" {
+		t.Errorf("states = %v, want only the issue of the workload without pods closed", states)
+	}
+}
+
+func TestCrashLoopOOMKilled(t *testing.T) {
+	oomKilled := func(finishedAt time.Time) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:                 "app",
+			RestartCount:         3,
+			State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: reasonOOMKilled, FinishedAt: metav1.NewTime(finishedAt)}},
+		}
+	}
+	recent := newTestPod("web-5d4f-recent", oomKilled(testCrashLoopNow.Add(-time.Minute)))
+	r := newTestCrashLoopReconciler(t, recent)
+
+	reconcileRequest(t, r, "default", recent.Name)
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 1 || !strings.Contains(ghIssues[0].Spec.Description, "- Last exit code: 137 (OOMKilled)") {
+		t.Fatalf("GitHubIssues = %+v, want one for the OOM kills", ghIssues)
+	}
+
+	old := newTestPod("web-5d4f-old", oomKilled(testCrashLoopNow.Add(-2*defaultHealthyWindow)))
+	r = newTestCrashLoopReconciler(t, old)
+	reconcileRequest(t, r, "default", old.Name)
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none for an old OOM kill", ghIssues)
+	}
+}
+
+func TestCrashLoopIgnored(t *testing.T) {
+	belowThreshold := newTestPod("web-5d4f-below", crashLoopingStatus(2))
+	otherApp := newTestPod("api-1", crashLoopingStatus(5))
+	otherApp.Labels["app"] = "api"
+	otherApp.OwnerReferences = nil
+	r := newTestCrashLoopReconciler(t, belowThreshold, otherApp)
+
+	for _, name := range []string{belowThreshold.Name, otherApp.Name, "deleted"} {
+		reconcileRequest(t, r, "default", name)
+	}
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none", ghIssues)
+	}
+}
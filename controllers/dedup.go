@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	occurrencesBegin  = "<!-- occurrences:begin dedup-key=%s -->"
+	occurrencesEnd    = "<!-- occurrences:end -->"
+	maxOccurrenceRows = 50
+)
+
+// occurrencesMarker opens the occurrences section of the issue of key, it
+// finds the issue whatever its title
+func occurrencesMarker(key string) string {
+	return fmt.Sprintf(occurrencesBegin, key)
+}
+
+// trackOccurrences counts a new generation of the GitHubIssue as a report of
+// its problem and puts the occurrences of every GitHubIssue reporting it in
+// k8sBasedIssue. An existing issue keeps its title and body, only its
+// occurrences section is replaced.
+func (r *GitHubIssueReconciler) trackOccurrences(ctx context.Context, ghIssue *examplev1alpha1.GitHubIssue, k8sBasedIssue *IssueData, existingIssue IssueData, issueExist bool) *InfoError {
+	ie := InfoError{}
+	if occurrences := ghIssue.Status.Occurrences; occurrences == nil || occurrences.ObservedGeneration != ghIssue.Generation {
+		patch := client.MergeFrom(ghIssue.DeepCopy())
+		now := metav1.Now()
+		if occurrences == nil {
+			occurrences = &examplev1alpha1.Occurrences{FirstSeen: now}
+		}
+		occurrences.Count++
+		occurrences.LastSeen = now
+		occurrences.ObservedGeneration = ghIssue.Generation
+		ghIssue.Status.Occurrences = occurrences
+		if err := r.Client.Status().Patch(ctx, ghIssue, patch); err != nil {
+			ie = newInfoError(err, fmt.Sprintf("%s - Falied to update status", ghIssue.Name))
+			return &ie
+		}
+	}
+
+	reports, err := r.dedupReports(ctx, *ghIssue)
+	if err != nil {
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to list the reports of %s", ghIssue.Name, ghIssue.Spec.DedupKey))
+		return &ie
+	}
+	section := occurrencesSection(ghIssue.Spec.DedupKey, append(reports, *ghIssue))
+	if !issueExist {
+		k8sBasedIssue.Description = strings.TrimRight(k8sBasedIssue.Description, "\n") + "\n\n" + section
+		return &ie
+	}
+	k8sBasedIssue.Title = existingIssue.Title
+	k8sBasedIssue.Description = replaceOccurrences(existingIssue.Description, ghIssue.Spec.DedupKey, section)
+	return &ie
+}
+
+// dedupReports are the other GitHubIssues reporting the problem of ghIssue
+// to the same repo, the ones being deleted aside
+func (r *GitHubIssueReconciler) dedupReports(ctx context.Context, ghIssue examplev1alpha1.GitHubIssue) ([]examplev1alpha1.GitHubIssue, error) {
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := r.List(ctx, &ghIssues); err != nil {
+		return nil, err
+	}
+
+	var reports []examplev1alpha1.GitHubIssue
+	for _, other := range ghIssues.Items {
+		if (other.Namespace == ghIssue.Namespace && other.Name == ghIssue.Name) || other.Spec.DedupKey != ghIssue.Spec.DedupKey || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if providerOf(other) == providerOf(ghIssue) && other.Spec.Repo == ghIssue.Spec.Repo {
+			reports = append(reports, other)
+		}
+	}
+	return reports, nil
+}
+
+// occurrencesSection is the Markdown table of the reports, the oldest first.
+// The reports that weren't counted yet are left out.
+func occurrencesSection(key string, ghIssues []examplev1alpha1.GitHubIssue) string {
+	var reports []examplev1alpha1.GitHubIssue
+	for _, ghIssue := range ghIssues {
+		if ghIssue.Status.Occurrences != nil {
+			reports = append(reports, ghIssue)
+		}
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Status.Occurrences.FirstSeen.Before(&reports[j].Status.Occurrences.FirstSeen)
+	})
+
+	total := 0
+	var first, last time.Time
+	var rows strings.Builder
+	for i, report := range reports {
+		occurrences := report.Status.Occurrences
+		total += occurrences.Count
+		if first.IsZero() || occurrences.FirstSeen.Time.Before(first) {
+			first = occurrences.FirstSeen.Time
+		}
+		if occurrences.LastSeen.Time.After(last) {
+			last = occurrences.LastSeen.Time
+		}
+		if i < maxOccurrenceRows {
+			fmt.Fprintf(&rows, "| `%s/%s` | %d | %s | %s |\n", report.Namespace, report.Name, occurrences.Count,
+				formatOccurrenceTime(occurrences.FirstSeen.Time), formatOccurrenceTime(occurrences.LastSeen.Time))
+		}
+	}
+	if len(reports) > maxOccurrenceRows {
+		fmt.Fprintf(&rows, "| %d more | | | |\n", len(reports)-maxOccurrenceRows)
+	}
+
+	var section strings.Builder
+	fmt.Fprintf(&section, "%s\n### Occurrences\n\n", occurrencesMarker(key))
+	fmt.Fprintf(&section, "Seen %d times from %d sources between %s and %s.\n\n", total, len(reports), formatOccurrenceTime(first), formatOccurrenceTime(last))
+	fmt.Fprintf(&section, "| Source | Occurrences | First seen | Last seen |\n| --- | --- | --- | --- |\n%s%s", rows.String(), occurrencesEnd)
+	return section.String()
+}
+
+// replaceOccurrences replaces the occurrences section of body, the edits
+// made around it are kept. It's appended when it was removed.
+func replaceOccurrences(body string, key string, section string) string {
+	begin := strings.Index(body, occurrencesMarker(key))
+	if begin < 0 {
+		return strings.TrimRight(body, "\n") + "\n\n" + section
+	}
+	end := strings.Index(body[begin:], occurrencesEnd)
+	if end < 0 {
+		return body[:begin] + section
+	}
+	return body[:begin] + section + body[begin+end+len(occurrencesEnd):]
+}
+
+func formatOccurrenceTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func withDedupKey(ghIssue *examplev1alpha1.GitHubIssue, name string, key string) *examplev1alpha1.GitHubIssue {
+	ghIssue.Name = name
+	ghIssue.Spec.DedupKey = key
+	return ghIssue
+}
+
+func reconcileDedup(t *testing.T, r *GitHubIssueReconciler, name string) examplev1alpha1.GitHubIssue {
+	reconcileRequest(t, r, "default", name)
+	got := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestReconcileDedup(t *testing.T) {
+	node1 := withDedupKey(newTestGitHubIssue("Disk full on node-1", "The disk of node-1 is full.", nil, false), "disk-full-node-1", "disk-full")
+	ghClient := NewFakeGitHubClient(testRepo)
+	r, _ := newTestReconciler(t, node1, ghClient)
+	node2 := withDedupKey(newTestGitHubIssue("Disk full on node-2", "The disk of node-2 is full.", nil, false), "disk-full-node-2", "disk-full")
+	if err := r.Create(context.Background(), node2); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := reconcileDedup(t, r, node1.Name); got.Status.Occurrences == nil || got.Status.Occurrences.Count != 1 {
+		t.Errorf("occurrences = %+v, want the first report counted", got.Status.Occurrences)
+	}
+	reconcileDedup(t, r, node2.Name)
+	issues := ghClient.Issues()
+	if len(issues) != 1 {
+		t.Fatalf("issues = %+v, want a single issue for the dedup key", issues)
+	}
+	if issues[0].Title != "Disk full on node-1" || !strings.HasPrefix(issues[0].Description, "The disk of node-1 is full.") {
+		t.Errorf("issue = %+v, want the title and body of the first report", issues[0])
+	}
+	if !strings.Contains(issues[0].Description, "Seen 2 times from 2 sources") || !strings.Contains(issues[0].Description, "| `default/disk-full-node-2` | 1 |") {
+		t.Errorf("description = %q, want both reports in the occurrences", issues[0].Description)
+	}
+
+	// the automation reports node-1 again
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: node1.Name}, node1); err != nil {
+		t.Fatal(err)
+	}
+	node1.Spec.Description = "The disk of node-1 is still full."
+	node1.Generation = 2
+	if err := r.Update(context.Background(), node1); err != nil {
+		t.Fatal(err)
+	}
+	if got := reconcileDedup(t, r, node1.Name); got.Status.Occurrences.Count != 2 {
+		t.Errorf("count = %d, want the new generation counted", got.Status.Occurrences.Count)
+	}
+	reconcileDedup(t, r, node1.Name)
+	description := ghClient.Issues()[0].Description
+	if !strings.HasPrefix(description, "The disk of node-1 is full.") || !strings.Contains(description, "Seen 3 times from 2 sources") {
+		t.Errorf("description = %q, want the body kept and 3 occurrences", description)
+	}
+	if strings.Count(description, occurrencesMarker("disk-full")) != 1 {
+		t.Errorf("description = %q, want a single occurrences section", description)
+	}
+}
+
+func TestReplaceOccurrences(t *testing.T) {
+	body := "Edited by hand.\n\n" + occurrencesMarker("k") + "\nold table\n" + occurrencesEnd + "\n\nA note below."
+	got := replaceOccurrences(body, "k", occurrencesMarker("k")+"\nnew table\n"+occurrencesEnd)
+	want := "Edited by hand.\n\n" + occurrencesMarker("k") + "\nnew table\n" + occurrencesEnd + "\n\nA note below."
+	if got != want {
+		t.Errorf("replaceOccurrences() = %q, want %q", got, want)
+	}
+
+	if got := replaceOccurrences("Removed by hand.", "k", "table"); got != "Removed by hand.\n\ntable" {
+		t.Errorf("replaceOccurrences() = %q, want the section appended", got)
+	}
+}
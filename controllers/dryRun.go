@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	dryRunAnnotation = "example.training.redhat.com/dry-run"
+	// plan values are cut so that a large body can't blow up the status
+	maxPlanValueSize = 2048
+
+	planCreate  = "create"
+	planEdit    = "edit"
+	planReopen  = "reopen"
+	planClose   = "close"
+	planComment = "comment"
+	planNone    = "none"
+)
+
+// isDryRun is true when the operator runs with --dry-run or the GitHubIssue
+// is annotated for it. The annotation can't turn off an operator-wide dry-run.
+func (r *GitHubIssueReconciler) isDryRun(ghIssue examplev1alpha1.GitHubIssue) bool {
+	if r.DryRun {
+		return true
+	}
+	dryRun, err := strconv.ParseBool(ghIssue.Annotations[dryRunAnnotation])
+	return err == nil && dryRun
+}
+
+// desiredState is the state the GitHubIssue asks for, open unless spec.state is closed
+func desiredState(issue IssueData) string {
+	if issue.State == "closed" {
+		return "closed"
+	}
+	return "open"
+}
+
+// planIssue computes what Create or EditIfNeeded would send for k8sBasedIssue,
+// a closed GitHubIssue without an issue has nothing to create
+func planIssue(k8sBasedIssue IssueData, existingIssue IssueData, issueExist bool) examplev1alpha1.IssuePlan {
+	plan := examplev1alpha1.IssuePlan{Action: planNone}
+	state := desiredState(k8sBasedIssue)
+
+	if !issueExist && state == "closed" {
+		return plan
+	}
+	if !issueExist {
+		plan.Action = planCreate
+		plan.Changes = append(plan.Changes,
+			fieldChange("title", "", k8sBasedIssue.Title),
+			fieldChange("body", "", k8sBasedIssue.Description))
+		plan.Changes = append(plan.Changes, managedFieldChanges(k8sBasedIssue, IssueData{})...)
+		return plan
+	}
+
+	if existingIssue.Title != k8sBasedIssue.Title {
+		plan.Action = planEdit
+		plan.Changes = append(plan.Changes, fieldChange("title", existingIssue.Title, k8sBasedIssue.Title))
+	}
+	if existingIssue.Description != k8sBasedIssue.Description {
+		plan.Action = planEdit
+		plan.Changes = append(plan.Changes, fieldChange("body", existingIssue.Description, k8sBasedIssue.Description))
+	}
+	if changes := managedFieldChanges(k8sBasedIssue, existingIssue); len(changes) > 0 {
+		plan.Action = planEdit
+		plan.Changes = append(plan.Changes, changes...)
+	}
+	if existingIssue.State != state {
+		plan.Action = planReopen
+		if state == "closed" {
+			plan.Action = planClose
+		}
+		plan.Changes = append(plan.Changes, fieldChange("state", existingIssue.State, state))
+	}
+
+	return plan
+}
+
+// planComments adds the comments that would be posted to plan, when the issue
+// exists or is about to be created
+func planComments(plan examplev1alpha1.IssuePlan, ghIssue examplev1alpha1.GitHubIssue, issueWillExist bool) examplev1alpha1.IssuePlan {
+	if !issueWillExist {
+		return plan
+	}
+	for i := ghIssue.Status.CommentsPosted; i < len(ghIssue.Spec.Comments); i++ {
+		plan.Changes = append(plan.Changes, fieldChange("comment", "", ghIssue.Spec.Comments[i]))
+		if plan.Action == planNone {
+			plan.Action = planComment
+		}
+	}
+	return plan
+}
+
+// managedFieldChanges are the differences of the labels, assignees and
+// milestone, they are only compared when the GitHubIssue sets them
+func managedFieldChanges(k8sBasedIssue IssueData, existingIssue IssueData) []examplev1alpha1.FieldChange {
+	var changes []examplev1alpha1.FieldChange
+	if len(k8sBasedIssue.Labels) > 0 && !sameStrings(k8sBasedIssue.Labels, existingIssue.Labels) {
+		changes = append(changes, fieldChange("labels", strings.Join(existingIssue.Labels, ","), strings.Join(k8sBasedIssue.Labels, ",")))
+	}
+	if len(k8sBasedIssue.Assignees) > 0 && !sameStrings(k8sBasedIssue.Assignees, existingIssue.Assignees) {
+		changes = append(changes, fieldChange("assignees", strings.Join(existingIssue.Assignees, ","), strings.Join(k8sBasedIssue.Assignees, ",")))
+	}
+	if !isEmpty(k8sBasedIssue.Milestone) && k8sBasedIssue.Milestone != existingIssue.Milestone {
+		changes = append(changes, fieldChange("milestone", existingIssue.Milestone, k8sBasedIssue.Milestone))
+	}
+	return changes
+}
+
+// sameStrings is true when a and b hold the same strings in any order
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s] == 0 {
+			return false
+		}
+		counts[s]--
+	}
+	return true
+}
+
+// planClosing computes what the finalizer would send for a deleted GitHubIssue
+func planClosing(existingIssue IssueData) examplev1alpha1.IssuePlan {
+	plan := examplev1alpha1.IssuePlan{Action: planNone}
+	if existingIssue.State != "closed" {
+		plan.Action = planClose
+		plan.Changes = []examplev1alpha1.FieldChange{fieldChange("state", existingIssue.State, "closed")}
+	}
+	return plan
+}
+
+func fieldChange(field string, from string, to string) examplev1alpha1.FieldChange {
+	return examplev1alpha1.FieldChange{Field: field, From: truncate(from, maxPlanValueSize), To: truncate(to, maxPlanValueSize)}
+}
+
+// truncate cuts s to at most size bytes, at a rune boundary so that it stays valid UTF-8
+func truncate(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+	return s[:size] + "..."
+}
+
+// describePlan is the one line summary of a plan used in events and logs
+func describePlan(title string, plan examplev1alpha1.IssuePlan) string {
+	if plan.Action == planNone {
+		return fmt.Sprintf("dry-run: issue %q is up to date", title)
+	}
+
+	fields := make([]string, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		if change.Field == "body" {
+			fields = append(fields, fmt.Sprintf("body (%d -> %d bytes)", len(change.From), len(change.To)))
+		} else {
+			fields = append(fields, fmt.Sprintf("%s %q -> %q", change.Field, change.From, change.To))
+		}
+	}
+	return fmt.Sprintf("dry-run: would %s issue %q: %s", plan.Action, title, strings.Join(fields, ", "))
+}
+
+// UpdatePlan records the plan on the GitHubIssue status and as an event instead of sending it to GitHub
+func (r *GitHubIssueReconciler) UpdatePlan(ghIssue examplev1alpha1.GitHubIssue, title string, plan examplev1alpha1.IssuePlan, ctx context.Context) *InfoError {
+	r.reportPlan(ghIssue, title, plan)
+
+	patch := client.MergeFrom(ghIssue.DeepCopy())
+	ghIssue.Status.Plan = &plan
+	err := r.Client.Status().Patch(ctx, &ghIssue, patch)
+
+	ie := newInfoError(nil, describePlan(title, plan))
+	if !requestSucceeded(err) {
+		ie = newInfoError(err, fmt.Sprintf("%s - Falied to update status", ghIssue.Name))
+	}
+
+	return &ie
+}
+
+// reportPlan emits the plan as an event, unless it is the plan already on the
+// status so that a GitHubIssue reconciled again doesn't repeat it
+func (r *GitHubIssueReconciler) reportPlan(ghIssue examplev1alpha1.GitHubIssue, title string, plan examplev1alpha1.IssuePlan) {
+	if samePlan(ghIssue.Status.Plan, plan) {
+		return
+	}
+	r.recordEvent(ghIssue, corev1.EventTypeNormal, "DryRun", describePlan(title, plan))
+}
+
+// samePlan is true when recorded is plan
+func samePlan(recorded *examplev1alpha1.IssuePlan, plan examplev1alpha1.IssuePlan) bool {
+	if recorded == nil || recorded.Action != plan.Action || len(recorded.Changes) != len(plan.Changes) {
+		return false
+	}
+	for i := range plan.Changes {
+		if recorded.Changes[i] != plan.Changes[i] {
+			return false
+		}
+	}
+	return true
+}
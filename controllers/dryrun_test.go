@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// describeChanges formats the changes of a plan as "field:from->to"
+func describeChanges(plan examplev1alpha1.IssuePlan) string {
+	changes := make([]string, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		changes = append(changes, change.Field+":"+change.From+"->"+change.To)
+	}
+	return strings.Join(changes, ",")
+}
+
+func TestPlanIssue(t *testing.T) {
+	existing := IssueData{Title: "issue1", Description: "body", State: "open", Labels: []string{"bug"}}
+	tests := []struct {
+		name        string
+		desired     IssueData
+		existing    IssueData
+		issueExist  bool
+		wantAction  string
+		wantChanges string
+	}{
+		{"create", IssueData{Title: "issue1", Description: "body", Labels: []string{"bug"}}, IssueData{}, false, planCreate, "title:->issue1,body:->body,labels:->bug"},
+		{"closed without an issue", IssueData{Title: "issue1", State: "closed"}, IssueData{}, false, planNone, ""},
+		{"up to date", IssueData{Title: "issue1", Description: "body"}, existing, true, planNone, ""},
+		{"unset labels are left alone", IssueData{Title: "issue1", Description: "body", State: "open"}, existing, true, planNone, ""},
+		{"labels in another order", IssueData{Title: "issue1", Description: "body", Labels: []string{"bug"}}, existing, true, planNone, ""},
+		{"title", IssueData{Title: "issue2", Description: "body"}, existing, true, planEdit, "title:issue1->issue2"},
+		{"body", IssueData{Title: "issue1", Description: "body2"}, existing, true, planEdit, "body:body->body2"},
+		{"labels", IssueData{Title: "issue1", Description: "body", Labels: []string{"bug", "p1"}}, existing, true, planEdit, "labels:bug->bug,p1"},
+		{"milestone", IssueData{Title: "issue1", Description: "body", Milestone: "v1"}, existing, true, planEdit, "milestone:->v1"},
+		{"close", IssueData{Title: "issue1", Description: "body", State: "closed"}, existing, true, planClose, "state:open->closed"},
+		{"reopen and edit", IssueData{Title: "issue1", Description: "body2"}, IssueData{Title: "issue1", Description: "body", State: "closed"}, true, planReopen, "body:body->body2,state:closed->open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planIssue(tt.desired, tt.existing, tt.issueExist)
+			if plan.Action != tt.wantAction || describeChanges(plan) != tt.wantChanges {
+				t.Errorf("planIssue() = %s %s, want %s %s", plan.Action, describeChanges(plan), tt.wantAction, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestPlanClosing(t *testing.T) {
+	if plan := planClosing(IssueData{State: "open"}); plan.Action != planClose || describeChanges(plan) != "state:open->closed" {
+		t.Errorf("planClosing(open) = %+v, want a close", plan)
+	}
+	if plan := planClosing(IssueData{State: "closed"}); plan.Action != planNone || len(plan.Changes) != 0 {
+		t.Errorf("planClosing(closed) = %+v, want nothing", plan)
+	}
+}
+
+func TestIsDryRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		operator   bool
+		annotation string
+		want       bool
+	}{
+		{"off", false, "", false},
+		{"annotated", false, "true", true},
+		{"annotated false", false, "false", false},
+		{"invalid annotation", false, "yes", false},
+		{"operator wide", true, "", true},
+		{"annotation can't turn it off", true, "false", true},
+	}
+
+	for _, tt := range tests {
+		ghIssue := newTestGitHubIssue("issue1", "test1", nil, false)
+		if !isEmpty(tt.annotation) {
+			ghIssue.Annotations = map[string]string{dryRunAnnotation: tt.annotation}
+		}
+		r := &GitHubIssueReconciler{DryRun: tt.operator}
+		if got := r.isDryRun(*ghIssue); got != tt.want {
+			t.Errorf("%s: isDryRun() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	ghIssue := newTestGitHubIssue("issue1", "test2", nil, false)
+	ghIssue.Spec.Comments = []string{"first"}
+	ghClient := NewFakeGitHubClient(testRepo, IssueData{Title: "issue1", Description: "test1", State: "open"})
+	r, recorder := newTestReconciler(t, ghIssue, ghClient)
+	r.DryRun = true
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if calls := ghClient.Calls(); len(calls) != 0 {
+		t.Errorf("GitHub calls = %v, want none", calls)
+	}
+	got := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Finalizers) != 0 {
+		t.Errorf("finalizers = %v, want none added in dry-run", got.Finalizers)
+	}
+	if plan := got.Status.Plan; plan == nil || plan.Action != planEdit || describeChanges(*plan) != "body:test1->test2,comment:->first" {
+		t.Errorf("plan = %+v, want the edit and the comment", plan)
+	}
+	if events := eventReasons(recorder); strings.Join(events, ",") != "Normal DryRun" {
+		t.Errorf("events = %v, want the plan only", events)
+	}
+
+	// the same plan isn't reported again, a new one is
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if events := eventReasons(recorder); len(events) != 0 {
+		t.Errorf("events = %v, want none for an unchanged plan", events)
+	}
+	ghClient.Update(context.Background(), IssueData{Number: 1, Title: "issue1", Description: "test3", State: "open"})
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if events := eventReasons(recorder); strings.Join(events, ",") != "Normal DryRun" {
+		t.Errorf("events = %v, want the new plan", events)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		size int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc..."},
+		{"héllo", 2, "h..."},
+		{"日本語", 4, "日..."},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.size); got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.size, got, tt.want)
+		}
+	}
+}
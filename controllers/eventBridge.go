@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	eventSourceLabel = "example.training.redhat.com/event-source"
+	// eventCountsAnnotation holds the eventCounts of the GitHubIssue
+	eventCountsAnnotation = "example.training.redhat.com/event-counts"
+)
+
+// EventBridgeReconciler files the Kubernetes Events matching the rules of a
+// ConfigMap as GitHubIssues, one per involved object and reason, so that a
+// recurring warning becomes a single issue counting its occurrences.
+type EventBridgeReconciler struct {
+	client.Client
+	Log logr.Logger
+	// Rules is the ConfigMap holding the rules under rules.yaml
+	Rules types.NamespacedName
+}
+
+// eventBridgeRule files the Events matching all of its lists, an empty list
+// matches anything but Types, which defaults to Warning
+type eventBridgeRule struct {
+	Types      []string `json:"types,omitempty"`
+	Reasons    []string `json:"reasons,omitempty"`
+	Kinds      []string `json:"kinds,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Provider   string   `json:"provider,omitempty"`
+	Repo       string   `json:"repo"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+func (rule eventBridgeRule) matches(event corev1.Event) bool {
+	eventTypes := rule.Types
+	if len(eventTypes) == 0 {
+		eventTypes = []string{corev1.EventTypeWarning}
+	}
+	return matchesAny(eventTypes, event.Type) && matchesAny(rule.Reasons, event.Reason) &&
+		matchesAny(rule.Kinds, event.InvolvedObject.Kind) && matchesAny(rule.Namespaces, event.Namespace)
+}
+
+// eventOccurrences aggregates the Events of an involved object and reason
+type eventOccurrences struct {
+	// counts is the count of each Event by UID
+	counts    map[string]int
+	firstSeen string
+	lastSeen  string
+	message   string
+}
+
+// eventCounts is what a GitHubIssue remembers of the Events it counted: the
+// count of each live Event by UID and the total of the ones that expired
+type eventCounts struct {
+	Expired int            `json:"expired,omitempty"`
+	Events  map[string]int `json:"events,omitempty"`
+}
+
+//+kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch
+
+// Reconcile files the Event, a deleted Event leaves its GitHubIssue as it is
+// since Events expire long before the problem they report is fixed
+func (r *EventBridgeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("event", req.NamespacedName)
+
+	var event corev1.Event
+	if err := r.Get(ctx, req.NamespacedName, &event); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// the GitHubIssues' own warnings would file issues about filing issues
+	if event.InvolvedObject.Kind == "GitHubIssue" {
+		return ctrl.Result{}, nil
+	}
+
+	rules, err := r.loadRules(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var rule *eventBridgeRule
+	for i := range rules {
+		if rules[i].matches(event) {
+			rule = &rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return ctrl.Result{}, nil
+	}
+
+	var events corev1.EventList
+	if err := r.List(ctx, &events, client.InNamespace(event.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	occurrences := aggregateEvents(event, events.Items)
+
+	source := eventSource(event)
+	key := types.NamespacedName{Namespace: event.Namespace, Name: "event-" + source}
+	err = syncGeneratedIssue(ctx, r.Client, key, eventSourceLabel, source, true, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.Spec = examplev1alpha1.GitHubIssueSpec{Provider: rule.Provider, Repo: rule.Repo, Labels: rule.Labels}
+		}
+		applyEventOccurrences(log, ghIssue, event, occurrences)
+	})
+	if err != nil {
+		log.Error(err, "failed to file the event")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *EventBridgeReconciler) loadRules(ctx context.Context) ([]eventBridgeRule, error) {
+	var config struct {
+		Rules []eventBridgeRule `json:"rules"`
+	}
+	if err := loadRules(ctx, r.Client, r.Rules, &config); err != nil {
+		return nil, err
+	}
+	for i, rule := range config.Rules {
+		if rule.Repo == "" {
+			return nil, fmt.Errorf("rule %d of %s has no repo", i, r.Rules)
+		}
+	}
+	return config.Rules, nil
+}
+
+// eventSource identifies the involved object and reason of an Event, it fits a label value and an object name
+func eventSource(event corev1.Event) string {
+	object := event.InvolvedObject
+	return sourceFingerprint(strings.Join([]string{object.APIVersion, object.Kind, object.Namespace, object.Name, event.Reason}, "/"))
+}
+
+// aggregateEvents sums the Events of the involved object and reason of event,
+// the API server keeps one Event per distinct message
+func aggregateEvents(event corev1.Event, events []corev1.Event) eventOccurrences {
+	occurrences := eventOccurrences{counts: map[string]int{}}
+	source := eventSource(event)
+	for _, other := range events {
+		if other.Reason != event.Reason || eventSource(other) != source {
+			continue
+		}
+		count, firstSeen, lastSeen := eventSeries(other)
+		occurrences.counts[eventUID(other)] = count
+		if occurrences.firstSeen == "" || firstSeen < occurrences.firstSeen {
+			occurrences.firstSeen = firstSeen
+		}
+		if lastSeen >= occurrences.lastSeen {
+			occurrences.lastSeen = lastSeen
+			occurrences.message = other.Message
+		}
+	}
+	return occurrences
+}
+
+// eventUID identifies an Event, and so its series, across updates
+func eventUID(event corev1.Event) string {
+	if event.UID == "" {
+		return event.Name
+	}
+	return string(event.UID)
+}
+
+// eventSeries is the count and first and last times of an Event, set by the
+// core API or by the events.k8s.io API
+func eventSeries(event corev1.Event) (int, string, string) {
+	count := int(event.Count)
+	firstSeen, lastSeen := event.FirstTimestamp.Time, event.LastTimestamp.Time
+	if firstSeen.IsZero() {
+		firstSeen = event.EventTime.Time
+	}
+	if event.Series != nil {
+		count = int(event.Series.Count)
+		lastSeen = event.Series.LastObservedTime.Time
+	}
+	if lastSeen.IsZero() {
+		lastSeen = firstSeen
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count, firstSeen.UTC().Format(time.RFC3339), lastSeen.UTC().Format(time.RFC3339)
+}
+
+// applyEventOccurrences merges occurrences into the ones already on the
+// GitHubIssue. Events expire after an hour, so the counts of the Events that
+// are gone are kept as expired and the first time seen is the oldest ever seen.
+func applyEventOccurrences(log logr.Logger, ghIssue *examplev1alpha1.GitHubIssue, event corev1.Event, occurrences eventOccurrences) {
+	values := ghIssue.Spec.Values
+	if values == nil {
+		values = map[string]string{}
+	}
+	counts := mergeEventCounts(log, ghIssue, occurrences.counts)
+	total := counts.Expired
+	for _, count := range counts.Events {
+		total += count
+	}
+	if values["firstSeen"] != "" && values["firstSeen"] < occurrences.firstSeen {
+		occurrences.firstSeen = values["firstSeen"]
+	}
+	if values["lastSeen"] > occurrences.lastSeen {
+		occurrences.lastSeen, occurrences.message = values["lastSeen"], values["message"]
+	}
+
+	object := event.InvolvedObject
+	values["kind"] = object.Kind
+	values["name"] = object.Name
+	values["reason"] = event.Reason
+	values["count"] = strconv.Itoa(total)
+	values["firstSeen"] = occurrences.firstSeen
+	values["lastSeen"] = occurrences.lastSeen
+	values["message"] = occurrences.message
+	ghIssue.Spec.Values = values
+
+	ghIssue.Spec.Title = fmt.Sprintf("%s: %s %s/%s", event.Reason, object.Kind, event.Namespace, object.Name)
+	ghIssue.Spec.Description = fmt.Sprintf("Kubernetes reported **%s** for %s `%s/%s` %d times.\n\n"+
+		"| First seen | Last seen |\n| --- | --- |\n| %s | %s |\n\nLatest message:\n\n```\n%s\n```\n",
+		event.Reason, object.Kind, event.Namespace, object.Name, total,
+		occurrences.firstSeen, occurrences.lastSeen, occurrences.message)
+}
+
+// mergeEventCounts records the live counts on the GitHubIssue, the Events it
+// counted before that are no longer live expired. A series only grows, so a
+// live Event counts at least what it counted before.
+func mergeEventCounts(log logr.Logger, ghIssue *examplev1alpha1.GitHubIssue, live map[string]int) eventCounts {
+	var counts eventCounts
+	if stored, ok := ghIssue.Annotations[eventCountsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(stored), &counts); err != nil {
+			log.Error(err, "the Event counts of the GitHubIssue are corrupt, counting again from the live Events", "annotation", eventCountsAnnotation)
+			counts = eventCounts{}
+		}
+	}
+
+	for uid, count := range counts.Events {
+		if liveCount, ok := live[uid]; !ok {
+			counts.Expired += count
+		} else if liveCount < count {
+			live[uid] = count
+		}
+	}
+	counts.Events = live
+
+	data, _ := json.Marshal(counts)
+	if ghIssue.Annotations == nil {
+		ghIssue.Annotations = map[string]string{}
+	}
+	ghIssue.Annotations[eventCountsAnnotation] = string(data)
+	return counts
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EventBridgeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("eventbridge").
+		For(&corev1.Event{}).
+		Complete(r)
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// the same warning for the same object is emitted at most once per window
+	eventDedupWindow = 10 * time.Minute
+	// past this many remembered events the expired ones are dropped
+	eventDedupSweepSize = 1024
+
+	reasonCreated          = "Created"
+	reasonEdited           = "Edited"
+	reasonReopened         = "Reopened"
+	reasonClosed           = "Closed"
+	reasonCommented        = "Commented"
+	reasonFinalizerAdded   = "FinalizerAdded"
+	reasonFinalizerRemoved = "FinalizerRemoved"
+	reasonAuthFailed       = "AuthenticationFailed"
+	reasonRateLimited      = "RateLimited"
+	reasonRequestFailed    = "GitHubRequestFailed"
+	reasonSynced           = "Synced"
+	reasonAssigneesDropped = "AssigneesDropped"
+
+	// conditionSynced is whether the last sync of the GitHubIssue with its tracker
+	// succeeded, a failed one has the reason of its warning event
+	conditionSynced = "Synced"
+)
+
+// dedupRecorder is an EventRecorder that drops a warning when the same
+// object already got the same reason and message within the window, so that
+// a resource stuck in a failing reconcile doesn't flood the API server.
+// Normal events report changes that really happened, they are never dropped.
+type dedupRecorder struct {
+	record.EventRecorder
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newDedupRecorder(recorder record.EventRecorder, window time.Duration) *dedupRecorder {
+	return &dedupRecorder{
+		EventRecorder: recorder,
+		window:        window,
+		now:           time.Now,
+		seen:          map[string]time.Time{},
+	}
+}
+
+func (d *dedupRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if d.shouldEmit(object, eventtype, reason, message) {
+		d.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (d *dedupRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	d.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (d *dedupRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if d.shouldEmit(object, eventtype, reason, message) {
+		d.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+func (d *dedupRecorder) shouldEmit(object runtime.Object, eventtype, reason, message string) bool {
+	if eventtype != corev1.EventTypeWarning {
+		return true
+	}
+	key := eventtype + "/" + reason + "/" + message
+	if accessor, err := meta.Accessor(object); err == nil {
+		key = string(accessor.GetUID()) + "/" + key
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if last, found := d.seen[key]; found && now.Sub(last) < d.window {
+		return false
+	}
+	if len(d.seen) >= eventDedupSweepSize {
+		for k, last := range d.seen {
+			if now.Sub(last) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+	}
+	d.seen[key] = now
+
+	return true
+}
+
+func (r *GitHubIssueReconciler) recordEvent(ghIssue examplev1alpha1.GitHubIssue, eventtype, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(&ghIssue, eventtype, reason, message)
+	}
+}
+
+// recordIssueEvent reports a change made to the issue on GitHub
+func (r *GitHubIssueReconciler) recordIssueEvent(ghIssue examplev1alpha1.GitHubIssue, reason string, issue IssueData) {
+	message := fmt.Sprintf("%s issue #%d %q", reason, issue.Number, issue.Title)
+	if !isEmpty(issue.URL) {
+		message += " " + issue.URL
+	}
+	r.recordEvent(ghIssue, corev1.EventTypeNormal, reason, message)
+}
+
+// recordFailure reports a failed GitHub request with a warning event and the
+// Synced condition of the status, auth failures and rate limiting get their own reasons
+func (r *GitHubIssueReconciler) recordFailure(ctx context.Context, ghIssue *examplev1alpha1.GitHubIssue, ie InfoError, url string) {
+	if requestSucceeded(ie.Err) {
+		return
+	}
+
+	message := fmt.Sprintf("%s: %v", ie.Message, ie.Err)
+	if !isEmpty(url) {
+		message += " " + url
+	}
+	r.recordEvent(*ghIssue, corev1.EventTypeWarning, failureReason(ie.Err), message)
+
+	patch := client.MergeFrom(ghIssue.DeepCopy())
+	setSyncedCondition(ghIssue, ie)
+	if err := r.Client.Status().Patch(ctx, ghIssue, patch); err != nil {
+		ctrllog.FromContext(ctx).Error(err, "failed to record the failure on the status")
+	}
+}
+
+// failureReason is the event and condition reason of a failed GitHub request
+func failureReason(err error) string {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		if apiErr.RateLimited {
+			return reasonRateLimited
+		} else if apiErr.isAuthFailure() {
+			return reasonAuthFailed
+		}
+	}
+	return reasonRequestFailed
+}
+
+func setSyncedCondition(ghIssue *examplev1alpha1.GitHubIssue, ie InfoError) {
+	condition := metav1.Condition{
+		Type:               conditionSynced,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonSynced,
+		Message:            "The issue matches the GitHubIssue",
+		ObservedGeneration: ghIssue.Generation,
+	}
+	if !requestSucceeded(ie.Err) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = failureReason(ie.Err)
+		condition.Message = fmt.Sprintf("%s: %v", ie.Message, ie.Err)
+	}
+	meta.SetStatusCondition(&ghIssue.Status.Conditions, condition)
+}
+
+// mutationReason maps a planned action to the event reason reported once it was sent
+func mutationReason(action string) string {
+	switch action {
+	case planCreate:
+		return reasonCreated
+	case planEdit:
+		return reasonEdited
+	case planReopen:
+		return reasonReopened
+	case planClose:
+		return reasonClosed
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const testEventBridgeRules = `rules:
+- reasons: [BackOff, FailedMount]
+  namespaces: [default]
+  repo: AlmogLevii/example-operator
+  labels: [kubernetes]
+`
+
+func newTestEventBridge(t *testing.T, objects ...client.Object) *EventBridgeReconciler {
+	rules, key := newTestRules("event-rules", testEventBridgeRules)
+	return &EventBridgeReconciler{
+		Client: newTestClient(t, append(objects, rules)...),
+		Log:    logr.Discard(),
+		Rules:  key,
+	}
+}
+
+func newTestEvent(name string, kind string, eventType string, reason string, count int32, first time.Time, last time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+		InvolvedObject: corev1.ObjectReference{APIVersion: "v1", Kind: kind, Namespace: "default", Name: "web-1"},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        name + " message",
+		Count:          count,
+		FirstTimestamp: metav1.NewTime(first),
+		LastTimestamp:  metav1.NewTime(last),
+	}
+}
+
+func listGitHubIssues(t *testing.T, c client.Client) []examplev1alpha1.GitHubIssue {
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := c.List(context.Background(), &ghIssues); err != nil {
+		t.Fatal(err)
+	}
+	return ghIssues.Items
+}
+
+func TestEventBridge(t *testing.T) {
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	bridge := newTestEventBridge(t,
+		newTestEvent("web-1.a", "Pod", corev1.EventTypeWarning, "BackOff", 3, start, start.Add(time.Minute)),
+		newTestEvent("web-1.b", "Pod", corev1.EventTypeWarning, "BackOff", 2, start.Add(-time.Minute), start.Add(2*time.Minute)),
+		newTestEvent("web-1.c", "Pod", corev1.EventTypeWarning, "FailedMount", 1, start, start))
+
+	reconcileRequest(t, bridge, "default", "web-1.a")
+	reconcileRequest(t, bridge, "default", "web-1.b")
+	ghIssues := listGitHubIssues(t, bridge.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want one for the BackOff of web-1", ghIssues)
+	}
+	spec := ghIssues[0].Spec
+	if spec.Title != "BackOff: Pod default/web-1" || spec.Repo != testRepo || !sameStrings(spec.Labels, []string{"kubernetes"}) {
+		t.Errorf("spec = %+v, want the rule's repo and labels", spec)
+	}
+	want := map[string]string{"count": "5", "firstSeen": "2021-06-01T09:59:00Z", "lastSeen": "2021-06-01T10:02:00Z", "message": "web-1.b message"}
+	for key, value := range want {
+		if spec.Values[key] != value {
+			t.Errorf("values[%s] = %q, want %q", key, spec.Values[key], value)
+		}
+	}
+
+	reconcileRequest(t, bridge, "default", "web-1.c")
+	if ghIssues := listGitHubIssues(t, bridge.Client); len(ghIssues) != 2 {
+		t.Errorf("GitHubIssues = %d, want another one for FailedMount", len(ghIssues))
+	}
+}
+
+func TestEventBridgeExpiredEvents(t *testing.T) {
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	event := newTestEvent("web-1.a", "Pod", corev1.EventTypeWarning, "BackOff", 4, start, start)
+	bridge := newTestEventBridge(t, event)
+	reconcileRequest(t, bridge, "default", "web-1.a")
+
+	// the Event occurs again before the API server drops it
+	event.Count = 6
+	if err := bridge.Update(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRequest(t, bridge, "default", "web-1.a")
+
+	// the next Event starts counting again
+	if err := bridge.Delete(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if err := bridge.Create(context.Background(), newTestEvent("web-1.d", "Pod", corev1.EventTypeWarning, "BackOff", 1, start.Add(2*time.Hour), start.Add(2*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRequest(t, bridge, "default", "web-1.d")
+
+	ghIssues := listGitHubIssues(t, bridge.Client)
+	if len(ghIssues) != 1 || ghIssues[0].Spec.Values["count"] != "7" || ghIssues[0].Spec.Values["firstSeen"] != "2021-06-01T10:00:00Z" {
+		t.Errorf("values = %v, want the expired count added and the first time kept", ghIssues[0].Spec.Values)
+	}
+	if ghIssues[0].Spec.Values["lastSeen"] != "2021-06-01T12:00:00Z" {
+		t.Errorf("lastSeen = %q, want the new Event's", ghIssues[0].Spec.Values["lastSeen"])
+	}
+
+	// the new Event occurs again, reconciling it twice counts it once
+	next := newTestEvent("web-1.d", "Pod", corev1.EventTypeWarning, "BackOff", 3, start.Add(2*time.Hour), start.Add(3*time.Hour))
+	if err := bridge.Delete(context.Background(), next); err != nil {
+		t.Fatal(err)
+	}
+	if err := bridge.Create(context.Background(), next); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRequest(t, bridge, "default", "web-1.d")
+	reconcileRequest(t, bridge, "default", "web-1.d")
+	if count := listGitHubIssues(t, bridge.Client)[0].Spec.Values["count"]; count != "9" {
+		t.Errorf("count = %s, want 9", count)
+	}
+}
+
+func TestEventBridgeCorruptCounts(t *testing.T) {
+	ghIssue := &examplev1alpha1.GitHubIssue{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{eventCountsAnnotation: "{"}}}
+	counts := mergeEventCounts(logr.Discard(), ghIssue, map[string]int{"uid-a": 4})
+	if counts.Expired != 0 || counts.Events["uid-a"] != 4 || ghIssue.Annotations[eventCountsAnnotation] != `{"events":{"uid-a":4}}` {
+		t.Errorf("counts = %+v, annotation = %s, want only the live Event counted", counts, ghIssue.Annotations[eventCountsAnnotation])
+	}
+}
+
+func TestEventBridgeIgnored(t *testing.T) {
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	bridge := newTestEventBridge(t,
+		newTestEvent("normal", "Pod", corev1.EventTypeNormal, "BackOff", 1, now, now),
+		newTestEvent("other-reason", "Pod", corev1.EventTypeWarning, "Unhealthy", 1, now, now),
+		newTestEvent("githubissue", "GitHubIssue", corev1.EventTypeWarning, "BackOff", 1, now, now))
+
+	for _, name := range []string{"normal", "other-reason", "githubissue", "deleted"} {
+		reconcileRequest(t, bridge, "default", name)
+	}
+	if ghIssues := listGitHubIssues(t, bridge.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none", ghIssues)
+	}
+}
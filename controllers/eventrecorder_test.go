@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestDedupRecorder(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(100)
+	recorder := newDedupRecorder(fakeRecorder, eventDedupWindow)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return now }
+	ghIssue := newTestGitHubIssue("issue1", "test1", nil, false)
+	ghIssue.UID = "uid-1"
+	other := newTestGitHubIssue("issue2", "test2", nil, false)
+	other.UID = "uid-2"
+
+	steps := []struct {
+		name      string
+		after     time.Duration
+		object    *examplev1alpha1.GitHubIssue
+		eventtype string
+		reason    string
+		message   string
+		wantEmit  bool
+	}{
+		{"first failure", 0, ghIssue, corev1.EventTypeWarning, reasonRateLimited, "rate limited", true},
+		{"same failure", time.Minute, ghIssue, corev1.EventTypeWarning, reasonRateLimited, "rate limited", false},
+		{"same failure of another object", 0, other, corev1.EventTypeWarning, reasonRateLimited, "rate limited", true},
+		{"another failure", 0, ghIssue, corev1.EventTypeWarning, reasonAuthFailed, "bad credentials", true},
+		{"first reopen", 0, ghIssue, corev1.EventTypeNormal, reasonReopened, "Reopened issue #1", true},
+		{"second reopen", time.Minute, ghIssue, corev1.EventTypeNormal, reasonReopened, "Reopened issue #1", true},
+		{"same failure in the window", 7 * time.Minute, ghIssue, corev1.EventTypeWarning, reasonRateLimited, "rate limited", false},
+		{"same failure past the window", time.Minute, ghIssue, corev1.EventTypeWarning, reasonRateLimited, "rate limited", true},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.after)
+		recorder.Eventf(step.object, step.eventtype, step.reason, "%s", step.message)
+		emitted := false
+		select {
+		case <-fakeRecorder.Events:
+			emitted = true
+		default:
+		}
+		if emitted != step.wantEmit {
+			t.Errorf("%s: emitted = %v, want %v", step.name, emitted, step.wantEmit)
+		}
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantReason string
+	}{
+		{"rate limited", &apiError{StatusCode: http.StatusForbidden, RateLimited: true}, reasonRateLimited},
+		{"too many requests", &apiError{StatusCode: http.StatusTooManyRequests, RateLimited: true}, reasonRateLimited},
+		{"bad credentials", &apiError{StatusCode: http.StatusUnauthorized, Message: "Bad credentials"}, reasonAuthFailed},
+		{"missing permissions", &apiError{StatusCode: http.StatusForbidden}, reasonAuthFailed},
+		{"wrapped", fmt.Errorf("listing issues: %w", &apiError{StatusCode: http.StatusUnauthorized}), reasonAuthFailed},
+		{"server error", &apiError{StatusCode: http.StatusBadGateway}, reasonRequestFailed},
+		{"network", errors.New("connection refused"), reasonRequestFailed},
+	}
+
+	for _, tt := range tests {
+		ghIssue := newTestGitHubIssue("issue1", "test1", nil, false)
+		r, recorder := newTestReconciler(t, ghIssue, NewFakeGitHubClient(testRepo))
+		r.recordFailure(context.Background(), ghIssue, newInfoError(tt.err, "sample1 - failed to sync"), "https://github.com/o/r/issues/1")
+
+		events := eventReasons(recorder)
+		if strings.Join(events, ",") != corev1.EventTypeWarning+" "+tt.wantReason {
+			t.Errorf("%s: events = %v, want a %s warning", tt.name, events, tt.wantReason)
+		}
+		if synced := syncedCondition(t, r, ghIssue); synced == nil || synced.Status != metav1.ConditionFalse || synced.Reason != tt.wantReason {
+			t.Errorf("%s: Synced condition = %+v, want False with reason %s", tt.name, synced, tt.wantReason)
+		}
+	}
+
+	ghIssue := newTestGitHubIssue("issue1", "test1", nil, false)
+	r, recorder := newTestReconciler(t, ghIssue, NewFakeGitHubClient(testRepo))
+	r.recordFailure(context.Background(), ghIssue, InfoError{Message: "sample1 - synced"}, "")
+	if events := eventReasons(recorder); len(events) != 0 {
+		t.Errorf("events = %v, want none without an error", events)
+	}
+	if synced := syncedCondition(t, r, ghIssue); synced != nil {
+		t.Errorf("Synced condition = %+v, want none without an error", synced)
+	}
+}
+
+// syncedCondition is the Synced condition of the stored GitHubIssue
+func syncedCondition(t *testing.T, r *GitHubIssueReconciler, ghIssue *examplev1alpha1.GitHubIssue) *metav1.Condition {
+	var stored examplev1alpha1.GitHubIssue
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}, &stored); err != nil {
+		t.Fatal(err)
+	}
+	return meta.FindStatusCondition(stored.Status.Conditions, conditionSynced)
+}
+
+func TestReconcileSyncedCondition(t *testing.T) {
+	ghIssue := newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false)
+	ghClient := NewFakeGitHubClient(testRepo)
+	ghClient.Err = &apiError{StatusCode: http.StatusUnauthorized, Message: "Bad credentials"}
+	r, _ := newTestReconciler(t, ghIssue, ghClient)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if synced := syncedCondition(t, r, ghIssue); synced == nil || synced.Status != metav1.ConditionFalse || synced.Reason != reasonAuthFailed {
+		t.Errorf("Synced condition = %+v, want False with reason %s", synced, reasonAuthFailed)
+	}
+
+	// the credentials were fixed
+	ghClient.Err = nil
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if synced := syncedCondition(t, r, ghIssue); synced == nil || synced.Status != metav1.ConditionTrue || synced.Reason != reasonSynced {
+		t.Errorf("Synced condition = %+v, want True once the issue was created", synced)
+	}
+}
@@ -0,0 +1,709 @@
+// Package fakegithub is an in-process fake of the GitHub REST issue endpoints
+// used by the operator. It keeps its state in memory, records every request
+// and can be scripted to fail, so tests don't need network access or a token.
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 100
+	// RateLimit is the number of requests allowed per window, like a GitHub token
+	RateLimit = 5000
+)
+
+// Label is the GitHub representation of an issue label
+type Label struct {
+	Name string `json:"name"`
+}
+
+// User is the GitHub representation of an assignee or author
+type User struct {
+	Login string `json:"login"`
+}
+
+// Milestone is the GitHub representation of a milestone
+type Milestone struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	State  string `json:"state"`
+}
+
+// Issue is the GitHub representation of an issue
+type Issue struct {
+	ID        int64      `json:"id"`
+	Number    int        `json:"number"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	State     string     `json:"state"`
+	HTMLURL   string     `json:"html_url"`
+	URL       string     `json:"url"`
+	Labels    []Label    `json:"labels"`
+	Assignees []User     `json:"assignees"`
+	Milestone *Milestone `json:"milestone"`
+	Comments  int        `json:"comments"`
+	User      User       `json:"user"`
+	CreatedAt string     `json:"created_at"`
+	UpdatedAt string     `json:"updated_at"`
+	ClosedAt  *string    `json:"closed_at"`
+}
+
+// Comment is the GitHub representation of an issue comment
+type Comment struct {
+	ID        int64  `json:"id"`
+	Body      string `json:"body"`
+	User      User   `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// Failure scripts the response of the requests matching Method and Path.
+// Path is matched as a prefix, an empty Method or Path matches everything.
+type Failure struct {
+	Method string
+	Path   string
+	// Times is how many requests fail, zero means every matching request
+	Times int
+	// Status and Message are the error response
+	Status  int
+	Message string
+	// Header is added to the error response, e.g. Retry-After
+	Header http.Header
+	// Hang holds the request until the client gives up, to simulate a timeout
+	Hang bool
+}
+
+// ServerError fails with a 5xx status
+func ServerError(method, path string, status int, times int) Failure {
+	return Failure{Method: method, Path: path, Times: times, Status: status, Message: "Server Error"}
+}
+
+// SecondaryRateLimit fails like GitHub's abuse detection does
+func SecondaryRateLimit(method, path string, times int) Failure {
+	return Failure{
+		Method:  method,
+		Path:    path,
+		Times:   times,
+		Status:  http.StatusForbidden,
+		Message: "You have exceeded a secondary rate limit. Please wait a few minutes before you try again.",
+		Header:  http.Header{"Retry-After": []string{"60"}},
+	}
+}
+
+// Timeout never answers the matching requests
+func Timeout(method, path string, times int) Failure {
+	return Failure{Method: method, Path: path, Times: times, Hang: true}
+}
+
+type repo struct {
+	issues     []*Issue
+	comments   map[int][]Comment
+	milestones []Milestone
+}
+
+// Server is the fake GitHub API, its URL replaces https://api.github.com
+type Server struct {
+	*httptest.Server
+	// Token, when set, is the only token accepted, any other gets 401
+	Token string
+
+	mu             sync.Mutex
+	repos          map[string]*repo
+	requests       []Request
+	failures       []*Failure
+	rateRemaining  int
+	nextID         int64
+	rateLimitReset time.Time
+}
+
+// NewServer starts a fake GitHub API, callers must Close it
+func NewServer() *Server {
+	s := &Server{
+		repos:          map[string]*repo{},
+		rateRemaining:  RateLimit,
+		rateLimitReset: time.Now().Add(time.Hour),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Fail scripts failures, they are matched in the order they were added
+func (s *Server) Fail(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range failures {
+		failure := failures[i]
+		s.failures = append(s.failures, &failure)
+	}
+}
+
+// ClearFailures drops the scripted failures that are still pending
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+// SetRateLimitRemaining sets the requests left in the window, at zero every request gets 403
+func (s *Server) SetRateLimitRemaining(remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateRemaining = remaining
+}
+
+// Reset drops all the issues, recorded requests and scripted failures
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repos = map[string]*repo{}
+	s.requests = nil
+	s.failures = nil
+	s.rateRemaining = RateLimit
+}
+
+// Requests are copies of the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Issues are copies of the issues of ownerRepo ordered by number
+func (s *Server) Issues(ownerRepo string) []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var issues []Issue
+	for _, issue := range s.repo(ownerRepo).issues {
+		issues = append(issues, *issue)
+	}
+	return issues
+}
+
+// Comments are copies of the comments of an issue
+func (s *Server) Comments(ownerRepo string, number int) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Comment(nil), s.repo(ownerRepo).comments[number]...)
+}
+
+// AddMilestone creates an open milestone and returns its number
+func (s *Server) AddMilestone(ownerRepo string, title string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(ownerRepo)
+	milestone := Milestone{Number: len(r.milestones) + 1, Title: title, State: "open"}
+	r.milestones = append(r.milestones, milestone)
+	return milestone.Number
+}
+
+// AddIssue stores an issue as if it was created by someone else and returns its number
+func (s *Server) AddIssue(ownerRepo string, issue Issue) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(ownerRepo, issue).Number
+}
+
+// SetIssueState changes the state of an issue as if it was done on github.com
+func (s *Server) SetIssueState(ownerRepo string, number int, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if issue := s.find(ownerRepo, number); issue != nil {
+		s.setState(issue, state)
+	}
+}
+
+// repo returns the state of ownerRepo, repos are created on first use. s.mu must be held.
+func (s *Server) repo(ownerRepo string) *repo {
+	r, found := s.repos[ownerRepo]
+	if !found {
+		r = &repo{comments: map[int][]Comment{}}
+		s.repos[ownerRepo] = r
+	}
+	return r
+}
+
+func (s *Server) find(ownerRepo string, number int) *Issue {
+	for _, issue := range s.repo(ownerRepo).issues {
+		if issue.Number == number {
+			return issue
+		}
+	}
+	return nil
+}
+
+func (s *Server) create(ownerRepo string, issue Issue) *Issue {
+	r := s.repo(ownerRepo)
+	now := timestamp()
+	s.nextID++
+	issue.ID = s.nextID
+	issue.Number = len(r.issues) + 1
+	issue.HTMLURL = fmt.Sprintf("https://github.com/%s/issues/%d", ownerRepo, issue.Number)
+	issue.URL = fmt.Sprintf("%s/repos/%s/issues/%d", s.URL, ownerRepo, issue.Number)
+	issue.CreatedAt = now
+	issue.UpdatedAt = now
+	if issue.User.Login == "" {
+		issue.User.Login = "fake-user"
+	}
+	if issue.Labels == nil {
+		issue.Labels = []Label{}
+	}
+	if issue.Assignees == nil {
+		issue.Assignees = []User{}
+	}
+	state := issue.State
+	issue.State = "open"
+	if state == "closed" {
+		s.setState(&issue, state)
+	}
+	r.issues = append(r.issues, &issue)
+	return &issue
+}
+
+func (s *Server) setState(issue *Issue, state string) {
+	issue.State = state
+	issue.UpdatedAt = timestamp()
+	issue.ClosedAt = nil
+	if state == "closed" {
+		closedAt := issue.UpdatedAt
+		issue.ClosedAt = &closedAt
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   string(body),
+	})
+	failure := s.scriptedFailure(req)
+	if s.rateRemaining > 0 {
+		s.rateRemaining--
+	}
+	s.writeRateLimitHeaders(w)
+	s.mu.Unlock()
+
+	if failure != nil {
+		if failure.Hang {
+			<-req.Context().Done()
+			return
+		}
+		for key, values := range failure.Header {
+			w.Header()[key] = values
+		}
+		writeError(w, failure.Status, failure.Message)
+		return
+	}
+
+	if s.Token != "" && !hasToken(req, s.Token) {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rateRemaining == 0 {
+		writeError(w, http.StatusForbidden, "API rate limit exceeded")
+		return
+	}
+
+	s.route(w, req, body)
+}
+
+// scriptedFailure pops the first failure matching req, s.mu must be held
+func (s *Server) scriptedFailure(req *http.Request) *Failure {
+	for i, failure := range s.failures {
+		if (failure.Method != "" && failure.Method != req.Method) || !strings.HasPrefix(req.URL.Path, failure.Path) {
+			continue
+		}
+		if failure.Times > 0 {
+			failure.Times--
+			if failure.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return failure
+	}
+	return nil
+}
+
+func (s *Server) writeRateLimitHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(RateLimit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.rateRemaining))
+	w.Header().Set("X-RateLimit-Used", strconv.Itoa(RateLimit-s.rateRemaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(s.rateLimitReset.Unix(), 10))
+	w.Header().Set("X-RateLimit-Resource", "core")
+}
+
+// route serves the issue endpoints, s.mu must be held
+func (s *Server) route(w http.ResponseWriter, req *http.Request, body []byte) {
+	if req.URL.Path == "/rate_limit" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"resources": map[string]interface{}{
+				"core": map[string]interface{}{"limit": RateLimit, "remaining": s.rateRemaining, "reset": s.rateLimitReset.Unix()},
+			},
+		})
+		return
+	}
+
+	// /repos/{owner}/{repo}/milestones and /repos/{owner}/{repo}/issues[/{number}[/comments|/labels[/{name}]]]
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) == 4 && parts[0] == "repos" && parts[3] == "milestones" && req.Method == http.MethodGet {
+		s.serveMilestones(w, req, parts[1]+"/"+parts[2])
+		return
+	}
+	if len(parts) < 4 || parts[0] != "repos" || parts[3] != "issues" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	ownerRepo := parts[1] + "/" + parts[2]
+
+	if len(parts) == 4 {
+		switch req.Method {
+		case http.MethodGet:
+			s.listIssues(w, req, ownerRepo)
+		case http.MethodPost:
+			s.createIssue(w, body, ownerRepo)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+		return
+	}
+
+	number, err := strconv.Atoi(parts[4])
+	issue := s.find(ownerRepo, number)
+	if err != nil || issue == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch {
+	case len(parts) == 5 && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, issue)
+	case len(parts) == 5 && req.Method == http.MethodPatch:
+		s.editIssue(w, body, ownerRepo, issue)
+	case len(parts) == 6 && parts[5] == "comments":
+		s.serveComments(w, req, body, ownerRepo, issue)
+	case len(parts) >= 6 && parts[5] == "labels":
+		s.serveLabels(w, req, body, parts[6:], issue)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+type issueRequest struct {
+	Title     *string   `json:"title"`
+	Body      *string   `json:"body"`
+	State     *string   `json:"state"`
+	Labels    *[]string `json:"labels"`
+	Assignees *[]string `json:"assignees"`
+	// Milestone is a number or null
+	Milestone json.RawMessage `json:"milestone"`
+}
+
+// milestone resolves the milestone of a request, it's false when the number is unknown
+func (s *Server) milestone(ownerRepo string, raw json.RawMessage) (*Milestone, bool) {
+	if string(raw) == "null" {
+		return nil, true
+	}
+	var number int
+	if err := json.Unmarshal(raw, &number); err != nil {
+		return nil, false
+	}
+	for _, milestone := range s.repo(ownerRepo).milestones {
+		if milestone.Number == number {
+			found := milestone
+			return &found, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) createIssue(w http.ResponseWriter, body []byte, ownerRepo string) {
+	request := issueRequest{}
+	if err := json.Unmarshal(body, &request); err != nil || request.Title == nil || *request.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	issue := Issue{Title: *request.Title}
+	if request.Body != nil {
+		issue.Body = *request.Body
+	}
+	if request.Labels != nil {
+		issue.Labels = labels(*request.Labels)
+	}
+	if request.Assignees != nil {
+		issue.Assignees = users(*request.Assignees)
+	}
+	if request.Milestone != nil {
+		milestone, found := s.milestone(ownerRepo, request.Milestone)
+		if !found {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		issue.Milestone = milestone
+	}
+	writeJSON(w, http.StatusCreated, s.create(ownerRepo, issue))
+}
+
+func (s *Server) editIssue(w http.ResponseWriter, body []byte, ownerRepo string, issue *Issue) {
+	request := issueRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+	if request.State != nil && *request.State != "open" && *request.State != "closed" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	if request.Milestone != nil {
+		milestone, found := s.milestone(ownerRepo, request.Milestone)
+		if !found {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		issue.Milestone = milestone
+	}
+
+	if request.Title != nil {
+		issue.Title = *request.Title
+	}
+	if request.Body != nil {
+		issue.Body = *request.Body
+	}
+	if request.Labels != nil {
+		issue.Labels = labels(*request.Labels)
+	}
+	if request.Assignees != nil {
+		issue.Assignees = users(*request.Assignees)
+	}
+	issue.UpdatedAt = timestamp()
+	if request.State != nil && *request.State != issue.State {
+		s.setState(issue, *request.State)
+	}
+	writeJSON(w, http.StatusOK, issue)
+}
+
+func (s *Server) listIssues(w http.ResponseWriter, req *http.Request, ownerRepo string) {
+	query := req.URL.Query()
+	state := query.Get("state")
+	if state == "" {
+		state = "open"
+	}
+
+	// GitHub lists the newest issues first
+	var matching []*Issue
+	issues := s.repo(ownerRepo).issues
+	for i := len(issues) - 1; i >= 0; i-- {
+		if state == "all" || issues[i].State == state {
+			matching = append(matching, issues[i])
+		}
+	}
+
+	page, perPage := pagination(query)
+	start := (page - 1) * perPage
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := start + perPage
+	if end > len(matching) {
+		end = len(matching)
+	}
+
+	lastPage := (len(matching) + perPage - 1) / perPage
+	if links := pageLinks(s.URL, req.URL, page, lastPage); links != "" {
+		w.Header().Set("Link", links)
+	}
+	writeJSON(w, http.StatusOK, append([]*Issue{}, matching[start:end]...))
+}
+
+// serveMilestones lists the milestones of the repo a page at a time
+func (s *Server) serveMilestones(w http.ResponseWriter, req *http.Request, ownerRepo string) {
+	milestones := s.repo(ownerRepo).milestones
+	page, perPage := pagination(req.URL.Query())
+	start := (page - 1) * perPage
+	if start > len(milestones) {
+		start = len(milestones)
+	}
+	end := start + perPage
+	if end > len(milestones) {
+		end = len(milestones)
+	}
+
+	lastPage := (len(milestones) + perPage - 1) / perPage
+	if links := pageLinks(s.URL, req.URL, page, lastPage); links != "" {
+		w.Header().Set("Link", links)
+	}
+	writeJSON(w, http.StatusOK, append([]Milestone{}, milestones[start:end]...))
+}
+
+func (s *Server) serveComments(w http.ResponseWriter, req *http.Request, body []byte, ownerRepo string, issue *Issue) {
+	r := s.repo(ownerRepo)
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, append([]Comment{}, r.comments[issue.Number]...))
+	case http.MethodPost:
+		request := struct {
+			Body string `json:"body"`
+		}{}
+		if err := json.Unmarshal(body, &request); err != nil || request.Body == "" {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		s.nextID++
+		comment := Comment{ID: s.nextID, Body: request.Body, User: User{Login: "fake-user"}, CreatedAt: timestamp()}
+		r.comments[issue.Number] = append(r.comments[issue.Number], comment)
+		issue.Comments++
+		writeJSON(w, http.StatusCreated, comment)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (s *Server) serveLabels(w http.ResponseWriter, req *http.Request, body []byte, name []string, issue *Issue) {
+	switch {
+	case req.Method == http.MethodGet && len(name) == 0:
+		writeJSON(w, http.StatusOK, issue.Labels)
+	case (req.Method == http.MethodPost || req.Method == http.MethodPut) && len(name) == 0:
+		request := struct {
+			Labels []string `json:"labels"`
+		}{}
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		if req.Method == http.MethodPut {
+			issue.Labels = labels(request.Labels)
+		} else {
+			issue.Labels = labels(append(labelNames(issue.Labels), request.Labels...))
+		}
+		issue.UpdatedAt = timestamp()
+		writeJSON(w, http.StatusOK, issue.Labels)
+	case req.Method == http.MethodDelete && len(name) == 1:
+		kept := []Label{}
+		for _, label := range issue.Labels {
+			if label.Name != name[0] {
+				kept = append(kept, label)
+			}
+		}
+		if len(kept) == len(issue.Labels) {
+			writeError(w, http.StatusNotFound, "Label does not exist")
+			return
+		}
+		issue.Labels = kept
+		issue.UpdatedAt = timestamp()
+		writeJSON(w, http.StatusOK, issue.Labels)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func pagination(query url.Values) (int, int) {
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage
+}
+
+// pageLinks builds the Link header GitHub sends with paginated lists
+func pageLinks(baseURL string, requestURL *url.URL, page int, lastPage int) string {
+	link := func(target int, rel string) string {
+		query := requestURL.Query()
+		query.Set("page", strconv.Itoa(target))
+		return fmt.Sprintf(`<%s%s?%s>; rel="%s"`, baseURL, requestURL.Path, query.Encode(), rel)
+	}
+
+	var links []string
+	if page < lastPage {
+		links = append(links, link(page+1, "next"), link(lastPage, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+	return strings.Join(links, ", ")
+}
+
+func labels(names []string) []Label {
+	unique := map[string]bool{}
+	result := []Label{}
+	for _, name := range names {
+		if !unique[name] {
+			unique[name] = true
+			result = append(result, Label{Name: name})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func labelNames(labels []Label) []string {
+	names := make([]string, 0, len(labels))
+	for _, label := range labels {
+		names = append(names, label.Name)
+	}
+	return names
+}
+
+func users(logins []string) []User {
+	result := []User{}
+	for _, login := range logins {
+		result = append(result, User{Login: login})
+	}
+	return result
+}
+
+func hasToken(req *http.Request, token string) bool {
+	authorization := req.Header.Get("Authorization")
+	return authorization == "token "+token || authorization == "Bearer "+token
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFileClient(t *testing.T, dir string) *FileClient {
+	fileClient, err := NewFileClientFactory(dir)("github", testRepo, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileClient.(*FileClient).now = func() time.Time { return time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC) }
+	return fileClient.(*FileClient)
+}
+
+func TestFileClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		return newTestFileClient(t, t.TempDir())
+	})
+}
+
+func TestFileClientFormat(t *testing.T) {
+	dir := t.TempDir()
+	fileClient := newTestFileClient(t, dir)
+
+	created, ie := fileClient.Create(context.Background(), IssueData{
+		Name:        "format",
+		Title:       "disk: full",
+		Description: "# Disk full\n\n---\n\nthe volume is at 100%",
+		Labels:      []string{"bug"},
+	})
+	mustSucceed(t, "Create", ie)
+
+	path := filepath.Join(dir, "github", filepath.FromSlash(testRepo), "0001.md")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+labels:
+- bug
+number: 1
+provider: github
+repo: AlmogLevii/example-operator
+state: open
+title: 'disk: full'
+updated_at: "2021-06-01T10:00:00Z"
+---
+
+# Disk full
+
+---
+
+the volume is at 100%`
+	if string(data) != want {
+		t.Errorf("issue file =\n%s\nwant\n%s", data, want)
+	}
+	if created.URL != "file://"+filepath.ToSlash(path) {
+		t.Errorf("Create() URL = %q, want the file", created.URL)
+	}
+
+	got, ie := fileClient.Get(context.Background(), 1)
+	mustSucceed(t, "Get", ie)
+	if got.Title != "disk: full" || got.Description != "# Disk full\n\n---\n\nthe volume is at 100%" {
+		t.Errorf("Get() = %+v, want the created issue", *got)
+	}
+}
+
+func TestFileClientComments(t *testing.T) {
+	dir := t.TempDir()
+	fileClient := newTestFileClient(t, dir)
+	created, ie := fileClient.Create(context.Background(), IssueData{Name: "comments", Title: "comments", Description: "body"})
+	mustSucceed(t, "Create", ie)
+
+	mustSucceed(t, "Comment", fileClient.Comment(context.Background(), *created, "first"))
+	mustSucceed(t, "Comment", fileClient.Comment(context.Background(), *created, "second\nline"))
+	// an edit keeps the comments
+	created.Description = "edited"
+	_, ie = fileClient.Update(context.Background(), *created)
+	mustSucceed(t, "Update", ie)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "github", filepath.FromSlash(testRepo), "0001.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+comments:
+- body: first
+  created_at: "2021-06-01T10:00:00Z"
+- body: |-
+    second
+    line
+  created_at: "2021-06-01T10:00:00Z"
+number: 1
+provider: github
+repo: AlmogLevii/example-operator
+state: open
+title: comments
+updated_at: "2021-06-01T10:00:00Z"
+---
+
+edited`
+	if string(data) != want {
+		t.Errorf("issue file =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestFileClientNumbers(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		_, ie := newTestFileClient(t, dir).Create(context.Background(), IssueData{Name: "numbers", Title: "numbers"})
+		mustSucceed(t, "Create", ie)
+	}
+	// files that are not issues are left alone
+	repoDir := filepath.Join(dir, "github", filepath.FromSlash(testRepo))
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "README.md"), []byte("not an issue"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	created, ie := newTestFileClient(t, dir).Create(context.Background(), IssueData{Name: "numbers", Title: "numbers"})
+	mustSucceed(t, "Create", ie)
+	if created.Number != 3 {
+		t.Errorf("Create() number = %d, want 3", created.Number)
+	}
+}
+
+func TestFileClientEditedOutOfBand(t *testing.T) {
+	dir := t.TempDir()
+	fileClient := newTestFileClient(t, dir)
+	_, ie := fileClient.Create(context.Background(), IssueData{Name: "edited", Title: "edited"})
+	mustSucceed(t, "Create", ie)
+
+	path := filepath.Join(dir, "github", filepath.FromSlash(testRepo), "0001.md")
+	closed := "---\nnumber: 1\ntitle: edited\nstate: closed\nupdated_at: \"2021-06-02T08:00:00Z\"\n---\n"
+	if err := ioutil.WriteFile(path, []byte(closed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, ie := fileClient.List(context.Background())
+	mustSucceed(t, "List", ie)
+	if len(issues) != 1 || issues[0].State != "closed" || issues[0].LastUpdatedTimeStamp != "2021-06-02T08:00:00Z" {
+		t.Errorf("List() = %+v, want the issue closed by the sync", issues)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("no front matter"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ie := fileClient.Get(context.Background(), 1); requestSucceeded(ie.Err) {
+		t.Errorf("Get() of a file without front matter succeeded")
+	}
+}
+
+func TestFileClientRepo(t *testing.T) {
+	for _, repo := range []string{"../etc", "owner/..", "owner/./name"} {
+		if _, err := NewFileClientFactory(t.TempDir())("github", repo, Credentials{}); err == nil {
+			t.Errorf("repo %q was accepted", repo)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// rulesKey is the key of the rules in the ConfigMaps of the issue sources
+const rulesKey = "rules.yaml"
+
+// sourceFingerprint identifies what a GitHubIssue was generated from, e.g. an
+// alert group key or a Secret, it fits a label value and an object name
+func sourceFingerprint(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// syncGeneratedIssue creates the GitHubIssue key, labeled sourceLabel=source,
+// or brings it up to date through mutate. A GitHubIssue of that name without
+// the label belongs to someone else and is never touched. When create is false
+// a missing GitHubIssue stays missing. Conflicts with another writer, e.g.
+// another replica, are retried.
+func syncGeneratedIssue(ctx context.Context, c client.Client, key types.NamespacedName, sourceLabel string, source string, create bool, mutate func(*examplev1alpha1.GitHubIssue)) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		var ghIssue examplev1alpha1.GitHubIssue
+		err := c.Get(ctx, key, &ghIssue)
+		if apierrors.IsNotFound(err) {
+			if !create {
+				return nil
+			}
+			ghIssue = examplev1alpha1.GitHubIssue{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: key.Namespace,
+					Labels:    map[string]string{sourceLabel: source},
+				},
+			}
+			mutate(&ghIssue)
+			return c.Create(ctx, &ghIssue)
+		}
+		if err != nil {
+			return err
+		}
+		if ghIssue.Labels[sourceLabel] != source {
+			return fmt.Errorf("GitHubIssue %s exists and wasn't generated from %s", key, source)
+		}
+
+		before := ghIssue.DeepCopy()
+		mutate(&ghIssue)
+		if reflect.DeepEqual(before.Spec, ghIssue.Spec) && reflect.DeepEqual(before.ObjectMeta, ghIssue.ObjectMeta) {
+			return nil
+		}
+		return c.Update(ctx, &ghIssue)
+	})
+}
+
+// loadRules decodes the rules of the ConfigMap key into rules, a missing
+// ConfigMap has no rules
+func loadRules(ctx context.Context, c client.Client, key types.NamespacedName, rules interface{}) error {
+	var configMap corev1.ConfigMap
+	if err := c.Get(ctx, key, &configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get the rules ConfigMap %s: %w", key, err)
+	}
+	if err := yaml.Unmarshal([]byte(configMap.Data[rulesKey]), rules); err != nil {
+		return fmt.Errorf("failed to parse %s of %s: %w", rulesKey, key, err)
+	}
+	return nil
+}
+
+// matchesSelector is true when object is in one of namespaces, any when
+// empty, and its labels match selector, everything when nil
+func matchesSelector(namespaces []string, selector *metav1.LabelSelector, object metav1.Object) (bool, error) {
+	if !matchesAny(namespaces, object.GetNamespace()) {
+		return false, nil
+	}
+	if selector == nil {
+		return true, nil
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid selector: %w", err)
+	}
+	return labelSelector.Matches(labels.Set(object.GetLabels())), nil
+}
+
+func matchesAny(values []string, value string) bool {
+	return len(values) == 0 || containsString(values, value)
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newTestClient is a fake client of the core and example kinds holding objects
+func newTestClient(t *testing.T, objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := examplev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+// reconcileRequest reconciles the object namespace/name with r, failing the test on an error
+func reconcileRequest(t *testing.T, r reconcile.Reconciler, namespace string, name string) ctrl.Result {
+	t.Helper()
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}})
+	if err != nil {
+		t.Fatalf("Reconcile(%s/%s) error = %v", namespace, name, err)
+	}
+	return result
+}
+
+// newTestRules is the rules ConfigMap name of the operator namespace
+func newTestRules(name string, rules string) (*corev1.ConfigMap, types.NamespacedName) {
+	key := types.NamespacedName{Namespace: "operator", Name: name}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Data:       map[string]string{rulesKey: rules},
+	}, key
+}
+
+// conflictingClient fails the first updates with a conflict, as when another
+// replica updated the object since it was read
+type conflictingClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return apierrors.NewConflict(schema.GroupResource{Resource: "githubissues"}, obj.GetName(), nil)
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func TestSyncGeneratedIssue(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "generated"}
+	setTitle := func(title string) func(*examplev1alpha1.GitHubIssue) {
+		return func(ghIssue *examplev1alpha1.GitHubIssue) {
+			ghIssue.Spec.Repo = testRepo
+			ghIssue.Spec.Title = title
+		}
+	}
+	get := func(c client.Client) examplev1alpha1.GitHubIssue {
+		var ghIssue examplev1alpha1.GitHubIssue
+		if err := c.Get(context.Background(), key, &ghIssue); err != nil {
+			t.Fatal(err)
+		}
+		return ghIssue
+	}
+
+	c := newTestClient(t)
+	if err := syncGeneratedIssue(context.Background(), c, key, alertGroupLabel, "a", false, setTitle("first")); err != nil {
+		t.Fatal(err)
+	}
+	if ghIssues := listGitHubIssues(t, c); len(ghIssues) != 0 {
+		t.Fatalf("GitHubIssues = %+v, want none created when create is false", ghIssues)
+	}
+
+	if err := syncGeneratedIssue(context.Background(), c, key, alertGroupLabel, "a", true, setTitle("first")); err != nil {
+		t.Fatal(err)
+	}
+	created := get(c)
+	if created.Labels[alertGroupLabel] != "a" || created.Spec.Title != "first" {
+		t.Errorf("GitHubIssue = %+v, want it labeled with its source", created)
+	}
+
+	// another replica updated it in between
+	racing := &conflictingClient{Client: c, conflicts: 2}
+	if err := syncGeneratedIssue(context.Background(), racing, key, alertGroupLabel, "a", true, setTitle("second")); err != nil {
+		t.Fatalf("sync after conflicts error = %v", err)
+	}
+	if racing.conflicts != 0 || get(c).Spec.Title != "second" {
+		t.Errorf("title = %q, want the update retried past the conflicts", get(c).Spec.Title)
+	}
+
+	// a sync that changes nothing doesn't write
+	unchanged := get(c)
+	if err := syncGeneratedIssue(context.Background(), c, key, alertGroupLabel, "a", true, setTitle("second")); err != nil {
+		t.Fatal(err)
+	}
+	if get(c).ResourceVersion != unchanged.ResourceVersion {
+		t.Error("an unchanged GitHubIssue was updated")
+	}
+
+	// a GitHubIssue of that name from another source is left alone
+	err := syncGeneratedIssue(context.Background(), c, key, alertGroupLabel, "b", true, setTitle("third"))
+	if err == nil || !strings.Contains(err.Error(), "wasn't generated from b") {
+		t.Errorf("sync of another source error = %v, want it refused", err)
+	}
+	if get(c).Spec.Title != "second" {
+		t.Errorf("title = %q, want the other source's GitHubIssue untouched", get(c).Spec.Title)
+	}
+}
+
+// racingCreateClient lets another replica create the object first
+type racingCreateClient struct {
+	client.Client
+	raced bool
+}
+
+func (c *racingCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if !c.raced {
+		c.raced = true
+		other := obj.DeepCopyObject().(client.Object)
+		if err := c.Client.Create(ctx, other, opts...); err != nil {
+			return err
+		}
+		return apierrors.NewAlreadyExists(schema.GroupResource{Resource: "githubissues"}, obj.GetName())
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestSyncGeneratedIssueCreateRace(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "generated"}
+	c := &racingCreateClient{Client: newTestClient(t)}
+	calls := 0
+	err := syncGeneratedIssue(context.Background(), c, key, alertGroupLabel, "a", true, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		calls++
+		ghIssue.Spec.Repo = testRepo
+		ghIssue.Spec.Comments = append(ghIssue.Spec.Comments, "firing")
+	})
+	if err != nil {
+		t.Fatalf("sync error = %v", err)
+	}
+	ghIssues := listGitHubIssues(t, c)
+	if calls != 2 || len(ghIssues) != 1 || len(ghIssues[0].Spec.Comments) != 2 {
+		t.Errorf("mutate calls = %d, GitHubIssues = %+v, want the other replica's GitHubIssue updated", calls, ghIssues)
+	}
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeGiteaLabel struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type fakeGiteaMilestone struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type fakeGiteaIssue struct {
+	Number    int                 `json:"number"`
+	Title     string              `json:"title"`
+	Body      string              `json:"body"`
+	State     string              `json:"state"`
+	HTMLURL   string              `json:"html_url"`
+	UpdatedAt string              `json:"updated_at"`
+	Labels    []fakeGiteaLabel    `json:"labels"`
+	Assignees []map[string]string `json:"assignees"`
+	Milestone *fakeGiteaMilestone `json:"milestone"`
+}
+
+// fakeGitea serves the Gitea v1 issue endpoints used by GiteaClient from memory, like
+// Gitea it refuses pages larger than giteaPageSize and answers edits with 201
+type fakeGitea struct {
+	*httptest.Server
+	token      string
+	labels     []fakeGiteaLabel
+	milestones []fakeGiteaMilestone
+
+	mu     sync.Mutex
+	issues []*fakeGiteaIssue
+}
+
+func newFakeGitea(t *testing.T) *fakeGitea {
+	f := &fakeGitea{
+		token:      "gitea-token",
+		labels:     []fakeGiteaLabel{{ID: 1, Name: "bug"}, {ID: 2, Name: "triage"}},
+		milestones: []fakeGiteaMilestone{{ID: 7, Title: conformanceMilestone}},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeGitea) client(token string) *GiteaClient {
+	giteaClient := newGiteaClient(f.URL+"/api/v1", testRepo, token, 0)
+	return &giteaClient
+}
+
+// giteaPage is the slice of total items served for the limit and page of
+// query, Gitea caps the limit at MAX_RESPONSE_ITEMS
+func giteaPage(total int, query url.Values) (int, int) {
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit > giteaPageSize {
+		limit = giteaPageSize
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	start, end := (page-1)*limit, page*limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+func (f *fakeGitea) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.Header.Get("Authorization") != "token "+f.token {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"message": "token is required"})
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/api/v1/repos/"+testRepo)
+	query := req.URL.Query()
+	switch {
+	case path == "/labels" && req.Method == http.MethodGet:
+		start, end := giteaPage(len(f.labels), query)
+		writeFakeJSON(w, http.StatusOK, append([]fakeGiteaLabel{}, f.labels[start:end]...))
+	case path == "/milestones" && req.Method == http.MethodGet:
+		var found []fakeGiteaMilestone
+		for _, milestone := range f.milestones {
+			if strings.Contains(milestone.Title, query.Get("name")) {
+				found = append(found, milestone)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, append([]fakeGiteaMilestone{}, found...))
+	case path == "/issues" && req.Method == http.MethodGet:
+		start, end := giteaPage(len(f.issues), query)
+		writeFakeJSON(w, http.StatusOK, append([]*fakeGiteaIssue{}, f.issues[start:end]...))
+	case path == "/issues" && req.Method == http.MethodPost:
+		issue := &fakeGiteaIssue{Number: len(f.issues) + 1, State: "open", Labels: []fakeGiteaLabel{}}
+		issue.HTMLURL = fmt.Sprintf("https://gitea.example.com/%s/issues/%d", testRepo, issue.Number)
+		if !f.apply(w, req, issue, true) {
+			return
+		}
+		f.issues = append(f.issues, issue)
+		writeFakeJSON(w, http.StatusCreated, issue)
+	case strings.HasPrefix(path, "/issues/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/issues/"), "/")
+		number, _ := strconv.Atoi(parts[0])
+		if number < 1 || number > len(f.issues) {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "issue does not exist"})
+			return
+		}
+		issue := f.issues[number-1]
+		switch {
+		case len(parts) == 1 && req.Method == http.MethodGet:
+			writeFakeJSON(w, http.StatusOK, issue)
+		case len(parts) == 1 && req.Method == http.MethodPatch:
+			if f.apply(w, req, issue, false) {
+				writeFakeJSON(w, http.StatusCreated, issue)
+			}
+		case len(parts) == 2 && parts[1] == "comments" && req.Method == http.MethodPost:
+			var comment map[string]string
+			json.NewDecoder(req.Body).Decode(&comment)
+			writeFakeJSON(w, http.StatusCreated, map[string]interface{}{"id": 1, "body": comment["body"]})
+		case len(parts) == 2 && parts[1] == "labels" && req.Method == http.MethodPut:
+			if f.apply(w, req, issue, true) {
+				writeFakeJSON(w, http.StatusOK, issue.Labels)
+			}
+		default:
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "not found"})
+		}
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "not found"})
+	}
+}
+
+// apply sets the fields of a request on issue, labels are ids and only taken when withLabels
+func (f *fakeGitea) apply(w http.ResponseWriter, req *http.Request, issue *fakeGiteaIssue, withLabels bool) bool {
+	var request struct {
+		Title     *string   `json:"title"`
+		Body      *string   `json:"body"`
+		State     *string   `json:"state"`
+		Labels    []int     `json:"labels"`
+		Assignees *[]string `json:"assignees"`
+		Milestone int       `json:"milestone"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+		return false
+	}
+
+	if request.Title != nil {
+		issue.Title = *request.Title
+	}
+	if request.Body != nil {
+		issue.Body = *request.Body
+	}
+	if request.State != nil {
+		issue.State = *request.State
+	}
+	if withLabels && request.Labels != nil {
+		issue.Labels = []fakeGiteaLabel{}
+		for _, id := range request.Labels {
+			for _, label := range f.labels {
+				if label.ID == id {
+					issue.Labels = append(issue.Labels, label)
+				}
+			}
+		}
+	}
+	if request.Assignees != nil {
+		issue.Assignees = nil
+		for _, login := range *request.Assignees {
+			issue.Assignees = append(issue.Assignees, map[string]string{"login": login})
+		}
+	}
+	for _, milestone := range f.milestones {
+		if milestone.ID == request.Milestone {
+			found := milestone
+			issue.Milestone = &found
+		}
+	}
+	issue.UpdatedAt = "2021-06-01T10:00:00Z"
+	return true
+}
+
+func TestGiteaClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		f := newFakeGitea(t)
+		return f.client(f.token)
+	})
+}
+
+func TestGiteaClientListPages(t *testing.T) {
+	f := newFakeGitea(t)
+	giteaClient := f.client(f.token)
+	for i := 0; i < giteaPageSize+5; i++ {
+		_, ie := giteaClient.Create(context.Background(), IssueData{Name: "pages", Title: fmt.Sprintf("issue %d", i)})
+		mustSucceed(t, "Create", ie)
+	}
+
+	issues, ie := giteaClient.List(context.Background())
+	mustSucceed(t, "List", ie)
+	if len(issues) != giteaPageSize+5 {
+		t.Errorf("List() returned %d issues, want %d", len(issues), giteaPageSize+5)
+	}
+}
+
+func TestGiteaClientUnknownLabel(t *testing.T) {
+	f := newFakeGitea(t)
+
+	_, ie := f.client(f.token).Create(context.Background(), IssueData{Name: "labels", Title: "labels", Labels: []string{"bug", "wontfix"}})
+	if requestSucceeded(ie.Err) || !strings.Contains(ie.Err.Error(), `label "wontfix" not found`) {
+		t.Errorf("Create() error = %v, want the missing label", ie.Err)
+	}
+	if len(f.issues) != 0 {
+		t.Errorf("an issue was created with an unknown label")
+	}
+}
+
+func TestGiteaClientLabelPages(t *testing.T) {
+	f := newFakeGitea(t)
+	for i := 0; i < giteaPageSize; i++ {
+		f.labels = append(f.labels, fakeGiteaLabel{ID: 10 + i, Name: fmt.Sprintf("area/%d", i)})
+	}
+
+	created, ie := f.client(f.token).Create(context.Background(), IssueData{Name: "labels", Title: "labels", Labels: []string{"bug", "area/49"}})
+	mustSucceed(t, "Create", ie)
+	if !sameStrings(created.Labels, []string{"bug", "area/49"}) {
+		t.Errorf("labels = %v, want the label of the second page too", created.Labels)
+	}
+}
+
+func TestGiteaClientBadToken(t *testing.T) {
+	f := newFakeGitea(t)
+
+	_, ie := f.client("wrong-token").List(context.Background())
+	var apiErr *apiError
+	if !errors.As(ie.Err, &apiErr) || !apiErr.isAuthFailure() {
+		t.Errorf("List() error = %v, want an authentication failure", ie.Err)
+	}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlmogLevii/example-operator/controllers/fakegithub"
+)
+
+const testToken = "test-token"
+
+// newTestServer starts a fake GitHub API that only accepts testToken
+func newTestServer(t *testing.T) *fakegithub.Server {
+	server := fakegithub.NewServer()
+	server.Token = testToken
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestRealGitHubClient(server *fakegithub.Server, requestTimeout time.Duration) GitHubClient {
+	realClient := newRealGitHubClient(server.URL, testRepo, testToken, requestTimeout)
+	return &realClient
+}
+
+func TestRealGitHubClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		server := newTestServer(t)
+		server.AddMilestone(testRepo, conformanceMilestone)
+		return newTestRealGitHubClient(server, 0)
+	})
+}
+
+func TestRealGitHubClientListPages(t *testing.T) {
+	server := newTestServer(t)
+	for i := 0; i < listPageSize+20; i++ {
+		server.AddIssue(testRepo, fakegithub.Issue{Title: fmt.Sprintf("issue %d", i)})
+	}
+
+	issues, ie := newTestRealGitHubClient(server, 0).List(context.Background())
+	mustSucceed(t, "List", ie)
+	if len(issues) != listPageSize+20 {
+		t.Errorf("List() returned %d issues, want %d", len(issues), listPageSize+20)
+	}
+	if requests := server.Requests(); len(requests) != 2 {
+		t.Errorf("List() sent %d requests, want 2", len(requests))
+	}
+}
+
+func TestRealGitHubClientMilestonePages(t *testing.T) {
+	server := newTestServer(t)
+	for i := 0; i < listPageSize+20; i++ {
+		server.AddMilestone(testRepo, fmt.Sprintf("v%d", i))
+	}
+	realClient := newTestRealGitHubClient(server, 0)
+
+	created, ie := realClient.Create(context.Background(), IssueData{Name: "sample1", Title: "issue1", Milestone: fmt.Sprintf("v%d", listPageSize+10)})
+	mustSucceed(t, "Create", ie)
+	if created.Milestone != fmt.Sprintf("v%d", listPageSize+10) {
+		t.Errorf("milestone = %q, want the one of the second page", created.Milestone)
+	}
+
+	_, ie = realClient.Create(context.Background(), IssueData{Name: "sample1", Title: "issue2", Milestone: "v999"})
+	if ie.Err == nil || !strings.Contains(ie.Err.Error(), `milestone "v999" not found`) {
+		t.Errorf("Create() error = %v, want the milestone not found", ie.Err)
+	}
+}
+
+func TestRealGitHubClientFailures(t *testing.T) {
+	failure := func(f fakegithub.Failure) *fakegithub.Failure { return &f }
+	issuesPath := "/repos/" + testRepo + "/issues"
+
+	tests := []struct {
+		name            string
+		failure         *fakegithub.Failure
+		token           string
+		rateLimitLeft   int
+		wantStatus      int
+		wantRateLimited bool
+		wantAuthFailure bool
+	}{
+		{
+			name:       "server error",
+			failure:    failure(fakegithub.ServerError(http.MethodGet, issuesPath, http.StatusBadGateway, 1)),
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:            "secondary rate limit",
+			failure:         failure(fakegithub.SecondaryRateLimit(http.MethodGet, issuesPath, 1)),
+			wantStatus:      http.StatusForbidden,
+			wantRateLimited: true,
+		},
+		{
+			name:            "exhausted rate limit",
+			rateLimitLeft:   1,
+			wantStatus:      http.StatusForbidden,
+			wantRateLimited: true,
+		},
+		{
+			name:            "bad credentials",
+			token:           "wrong-token",
+			wantStatus:      http.StatusUnauthorized,
+			wantAuthFailure: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			if tt.failure != nil {
+				server.Fail(*tt.failure)
+			}
+			if tt.rateLimitLeft > 0 {
+				server.SetRateLimitRemaining(tt.rateLimitLeft)
+			}
+			token := testToken
+			if tt.token != "" {
+				token = tt.token
+			}
+			realClient := newRealGitHubClient(server.URL, testRepo, token, 0)
+
+			_, ie := realClient.List(context.Background())
+			var apiErr *apiError
+			if !errors.As(ie.Err, &apiErr) {
+				t.Fatalf("List() error = %v, want an apiError", ie.Err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || apiErr.RateLimited != tt.wantRateLimited || apiErr.isAuthFailure() != tt.wantAuthFailure {
+				t.Errorf("List() error = %+v, want status %d rate limited %v auth failure %v",
+					*apiErr, tt.wantStatus, tt.wantRateLimited, tt.wantAuthFailure)
+			}
+			if !strings.HasPrefix(apiErr.Error(), "GitHub responded") {
+				t.Errorf("List() error = %q, want it to name GitHub", apiErr)
+			}
+		})
+	}
+}
+
+func TestRealGitHubClientTimeout(t *testing.T) {
+	server := newTestServer(t)
+	server.Fail(fakegithub.Timeout(http.MethodGet, "", 1))
+
+	_, ie := newTestRealGitHubClient(server, 50*time.Millisecond).Get(context.Background(), 1)
+	if !errors.Is(ie.Err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want a deadline exceeded error", ie.Err)
+	}
+}
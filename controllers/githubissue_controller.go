@@ -16,30 +16,56 @@ TODO:
 V 1.add issue name (name of operator) for printing usingV
 V 2. fix isExist checking that if the issue is close - open it (or maybe fix the update?)
 3.watch the guided videos
-4. unitesting:
-	4.1 create fake client
-	4.2 testing
+V 4. unitesting:
+	V 4.1 create fake client
+	V 4.2 testing
 */
 
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // GitHubIssueReconciler reconciles a GitHubIssue object
 type GitHubIssueReconciler struct {
 	client.Client
-	Log          logr.Logger
-	Scheme       *runtime.Scheme
-	GitHubClient GitHubClient
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// NewGitHubClient resolves the GitHubClient of every reconciled repo,
+	// it defaults to clients of github.com and gitlab.com
+	NewGitHubClient GitHubClientFactory
+	Recorder        record.EventRecorder
+	// DryRun computes the GitHub changes for every GitHubIssue without sending them
+	DryRun bool
+	// SyncTimeout bounds all the GitHub requests of a single reconcile, the
+	// writes to the API server have their own deadline
+	SyncTimeout time.Duration
+
+	// controller watches the kinds of the targets as they are met
+	controller   controller.Controller
+	watchLock    sync.Mutex
+	watchedKinds map[schema.GroupVersionKind]bool
 }
+
+const defaultSyncTimeout = 2 * time.Minute
+
 type IssueData struct {
 	Name                 string
 	Title                string `json:"title"`
@@ -47,6 +73,14 @@ type IssueData struct {
 	Number               int    `json:"number,omitempty"`
 	State                string `json:"state,,omitempty"`
 	LastUpdatedTimeStamp string `json:"updated_at,omitempty"`
+	URL                  string `json:"html_url,omitempty"`
+	// Key identifies the issue on trackers that don't use numbers, e.g. OPS-12 on Jira
+	Key string `json:"-"`
+	// Labels, Assignees and Milestone are only managed when they are set, each
+	// backend maps them onto its own API
+	Labels    []string `json:"-"`
+	Assignees []string `json:"-"`
+	Milestone string   `json:"-"`
 }
 type OwnerDetails struct {
 	Repo  string
@@ -56,6 +90,8 @@ type OwnerDetails struct {
 //+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissues,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissues/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissues/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 // TODO(user): Modify the Reconcile function to compare the state specified by
@@ -66,6 +102,7 @@ type OwnerDetails struct {
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.2/pkg/reconcile
 func (r *GitHubIssueReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("githubissue", req.NamespacedName)
+	ctx = ctrllog.IntoContext(ctx, log)
 
 	//connect to k8s and get the ghIssue from the server
 	ghIssue := examplev1alpha1.GitHubIssue{}
@@ -81,41 +118,146 @@ func (r *GitHubIssueReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
-	realClient := newRealGitHubClient(ghIssue.Spec.Repo)
-	r.GitHubClient = &realClient
-	k8sBasedIssue := IssueData{Name: ghIssue.Name, Title: ghIssue.Spec.Title, Description: ghIssue.Spec.Description}
+	ghClient, err := r.gitHubClientFor(ghIssue)
+	if !requestSucceeded(err) {
+		log.Error(err, "failed to resolve the GitHub client")
+		return ctrl.Result{}, err
+	}
+
+	//the tracker requests of this reconcile share one deadline, the writes to
+	//the API server aren't bound by it so that a slow tracker can't fail them
+	syncTimeout := r.SyncTimeout
+	if syncTimeout <= 0 {
+		syncTimeout = defaultSyncTimeout
+	}
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+
+	//render the title and body, a GitHubIssue being deleted with a broken template closes the issue of its status
+	k8sBasedIssue, ie := r.renderIssue(ctx, ghIssue)
+	r.logMessage(*ie, log)
+	renderFailed := !requestSucceeded(ie.Err)
+	if renderFailed && ghIssue.ObjectMeta.DeletionTimestamp.IsZero() {
+		observeReconcile(outcomeError)
+		ie = r.UpdateRenderFailure(ghIssue, *ie, ctx)
+		r.logMessage(*ie, log)
+		return ctrl.Result{}, nil
+	}
+	if providerOf(ghIssue) == examplev1alpha1.ProviderJira {
+		if dropped := jiraAssignee(&k8sBasedIssue); len(dropped) > 0 {
+			r.recordEvent(ghIssue, corev1.EventTypeWarning, reasonAssigneesDropped,
+				fmt.Sprintf("Jira issues have a single assignee, %s are not assigned", strings.Join(dropped, ", ")))
+		}
+	}
+
+	//a target overrides the state, the issue is open until the target is ready
+	if ghIssue.Spec.TargetRef != nil && ghIssue.ObjectMeta.DeletionTimestamp.IsZero() {
+		ready, ie := r.checkTarget(ctx, &ghIssue)
+		r.logMessage(*ie, log)
+		if !requestSucceeded(ie.Err) {
+			observeReconcile(outcomeError)
+			return ctrl.Result{}, ie.Err
+		}
+		if ready && ghIssue.Spec.TargetRef.OnReady == onReadyDelete && !r.isDryRun(ghIssue) {
+			//the finalizer closes the issue
+			log.Info("the target is ready, deleting the GitHubIssue")
+			return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, &ghIssue))
+		}
+		k8sBasedIssue.State = "open"
+		if ready {
+			k8sBasedIssue.State = "closed"
+		}
+	}
+	hash := renderedHash(k8sBasedIssue)
 
 	//find issue if exist
-	issueExist, existingIssue, ie := r.GitHubClient.IsExist(k8sBasedIssue)
+	issueExist, existingIssue, ie := false, &k8sBasedIssue, &InfoError{}
+	if renderFailed {
+		issueExist, existingIssue, ie = r.recordedIssue(syncCtx, ghClient, ghIssue)
+		r.logMessage(*ie, log)
+		if !requestSucceeded(ie.Err) {
+			//keep the finalizer until the issue can be found
+			r.recordFailure(ctx, &ghIssue, *ie, ghIssue.Status.URL)
+			observeReconcile(outcomeError)
+			return ctrl.Result{}, ie.Err
+		}
+	} else {
+		issueExist, existingIssue, ie = r.findIssue(syncCtx, ghClient, ghIssue, k8sBasedIssue)
+	}
 	r.logMessage(*ie, log)
 	if !requestSucceeded(ie.Err) {
+		r.recordFailure(ctx, &ghIssue, *ie, "")
+		observeReconcile(outcomeError)
 		//log.Info(ie.Message)
 		//ntc - which err need to be returned
 		return ctrl.Result{}, nil
 	}
 
 	//delete issue if needed
-	needToReturn, ie := r.GitHubClient.DeleteIfNeeded(ghIssue, r, issueExist, ctx, *existingIssue)
+	needToReturn, ie := r.handleFinalizer(ctx, syncCtx, ghClient, ghIssue, issueExist, *existingIssue)
 	r.logMessage(*ie, log)
 	if needToReturn {
+		observeReconcile(deletionOutcome(*ie, issueExist, r.isDryRun(ghIssue)))
 		return ctrl.Result{}, ie.Err
 	}
 
+	//a problem reported again only updates the occurrences section of its issue
+	if !isEmpty(ghIssue.Spec.DedupKey) {
+		ie = r.trackOccurrences(ctx, &ghIssue, &k8sBasedIssue, *existingIssue, issueExist)
+		r.logMessage(*ie, log)
+		if !requestSucceeded(ie.Err) {
+			observeReconcile(outcomeError)
+			return ctrl.Result{}, ie.Err
+		}
+		hash = renderedHash(k8sBasedIssue)
+	}
+
+	//in dry-run mode only report what would be created or edited
+	if r.isDryRun(ghIssue) {
+		observeReconcile(outcomePlanned)
+		plan := planIssue(k8sBasedIssue, *existingIssue, issueExist)
+		plan = planComments(plan, ghIssue, issueExist || desiredState(k8sBasedIssue) == "open")
+		ie = r.UpdatePlan(ghIssue, k8sBasedIssue.Title, plan, ctx)
+		r.logMessage(*ie, log)
+		return ctrl.Result{}, nil
+	}
+
 	//create or edit if needed
 	var realWorldIssue *IssueData
-	if issueExist {
-		realWorldIssue, ie = r.GitHubClient.EditIfNeeded(k8sBasedIssue, *existingIssue) //editExistingIssueIfNeeded(k8sBasedIssue, *existingIssue, ownerDetails)
+	action := planIssue(k8sBasedIssue, *existingIssue, issueExist).Action
+	if issueExist && action == planNone {
+		//the issue already matches the GitHubIssue, skip the PATCH
+		realWorldIssue, ie = existingIssue, &InfoError{}
+		action = planNone
+	} else if !issueExist && action == planNone {
+		//a closed GitHubIssue doesn't create its issue
+		realWorldIssue, ie = &IssueData{Name: k8sBasedIssue.Name}, &InfoError{}
+	} else if issueExist {
+		realWorldIssue, ie = r.editIfNeeded(syncCtx, ghClient, k8sBasedIssue, *existingIssue) //editExistingIssueIfNeeded(k8sBasedIssue, *existingIssue, ownerDetails)
 	} else {
-		realWorldIssue, ie = r.GitHubClient.Create(k8sBasedIssue) //createNewIssue(k8sBasedIssue, ownerDetails) //r.GitHubClient.create(k8sBasedIssue)
+		realWorldIssue, ie = ghClient.Create(syncCtx, k8sBasedIssue) //createNewIssue(k8sBasedIssue, ownerDetails) //r.GitHubClient.create(k8sBasedIssue)
 	}
 	r.logMessage(*ie, log)
 	if !requestSucceeded(ie.Err) {
+		r.recordFailure(ctx, &ghIssue, *ie, existingIssue.URL)
+		observeReconcile(outcomeError)
 		//ntc - which err need to be returned
 		return ctrl.Result{}, nil
 	}
+	if reason := mutationReason(action); !isEmpty(reason) {
+		r.recordIssueEvent(ghIssue, reason, *realWorldIssue)
+	}
+	observeReconcile(reconcileOutcome(action))
 
-	//update status
-	ie = r.UpdateStatus(ghIssue, *realWorldIssue, ctx)
+	//post the new comments, the ones posted before a failure are still counted
+	commentsPosted, commentsIe := r.postComments(syncCtx, ghClient, ghIssue, *realWorldIssue)
+	r.logMessage(*commentsIe, log)
+	if !requestSucceeded(commentsIe.Err) {
+		r.recordFailure(ctx, &ghIssue, *commentsIe, realWorldIssue.URL)
+	}
+
+	//update status, the issue isn't synced until all the comments were posted
+	ie = r.UpdateStatus(ghIssue, *realWorldIssue, hash, commentsPosted, *commentsIe, ctx)
 	r.logMessage(*ie, log)
 	if !requestSucceeded(ie.Err) {
 		//ntc - which err need to be returned
@@ -127,9 +269,58 @@ func (r *GitHubIssueReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GitHubIssueReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("githubissue-controller")
+	}
+	r.Recorder = newDedupRecorder(r.Recorder, eventDedupWindow)
+	if err := registerManagedIssuesCollector(mgr.GetClient()); err != nil {
+		return err
+	}
+
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&examplev1alpha1.GitHubIssue{}).
-		Complete(r)
+		Build(r)
+	r.controller = c
+	return err
+}
+
+func (r *GitHubIssueReconciler) gitHubClientFor(ghIssue examplev1alpha1.GitHubIssue) (GitHubClient, error) {
+	newGitHubClient := r.NewGitHubClient
+	if newGitHubClient == nil {
+		newGitHubClient = NewProviderClientFactory(map[string]GitHubClientFactory{
+			examplev1alpha1.ProviderGitHub: NewRealGitHubClientFactory(defaultAPIURL, defaultRequestTimeout),
+			examplev1alpha1.ProviderGitLab: NewGitLabClientFactory(defaultGitLabURL, defaultRequestTimeout),
+		})
+	}
+	return newGitHubClient(providerOf(ghIssue), ghIssue.Spec.Repo, r.credentials(ghIssue))
+}
+
+// providerOf is the issue tracker of the GitHubIssue, GitHub unless the spec says otherwise
+func providerOf(ghIssue examplev1alpha1.GitHubIssue) string {
+	if isEmpty(ghIssue.Spec.Provider) {
+		return examplev1alpha1.ProviderGitHub
+	}
+	return ghIssue.Spec.Provider
+}
+
+// providerTokenEnv are the environment variables holding the operator's token of each provider
+var providerTokenEnv = map[string]string{
+	examplev1alpha1.ProviderGitHub:    "GITOKEN",
+	examplev1alpha1.ProviderGitLab:    "GITLAB_TOKEN",
+	examplev1alpha1.ProviderGitea:     "GITEA_TOKEN",
+	examplev1alpha1.ProviderJira:      "JIRA_TOKEN",
+	examplev1alpha1.ProviderBitbucket: "BITBUCKET_TOKEN",
+}
+
+// providerUserEnv are the environment variables holding the operator's username of the providers that need one
+var providerUserEnv = map[string]string{
+	examplev1alpha1.ProviderJira: "JIRA_USER",
+}
+
+// credentials of the GitHubIssue, for now the operator's token of the provider is used for every repo
+func (r *GitHubIssueReconciler) credentials(ghIssue examplev1alpha1.GitHubIssue) Credentials {
+	provider := providerOf(ghIssue)
+	return Credentials{Token: os.Getenv(providerTokenEnv[provider]), Username: os.Getenv(providerUserEnv[provider])}
 }
 
 func (r *GitHubIssueReconciler) logMessage(ie InfoError, log logr.Logger) {
@@ -143,10 +334,22 @@ func isEmpty(s string) bool {
 	return s == ""
 }
 
-func (r *GitHubIssueReconciler) UpdateStatus(ghIssue examplev1alpha1.GitHubIssue, realWorldIssue IssueData, ctx context.Context) *InfoError {
+func (r *GitHubIssueReconciler) UpdateStatus(ghIssue examplev1alpha1.GitHubIssue, realWorldIssue IssueData, hash string, commentsPosted int, syncIe InfoError, ctx context.Context) *InfoError {
 	patch := client.MergeFrom(ghIssue.DeepCopy())
 	ghIssue.Status.State = realWorldIssue.State
 	ghIssue.Status.LastUpdatedTimeStamp = realWorldIssue.LastUpdatedTimeStamp
+	ghIssue.Status.Number = realWorldIssue.Number
+	ghIssue.Status.URL = realWorldIssue.URL
+	ghIssue.Status.Key = realWorldIssue.Key
+	ghIssue.Status.RenderedHash = hash
+	ghIssue.Status.CommentsPosted = commentsPosted
+	ghIssue.Status.Plan = nil
+	setSyncedCondition(&ghIssue, syncIe)
+	if ghIssue.Spec.BodyTemplate != nil {
+		setTemplateCondition(&ghIssue, InfoError{})
+	} else if meta.FindStatusCondition(ghIssue.Status.Conditions, conditionTemplateRendered) != nil {
+		meta.RemoveStatusCondition(&ghIssue.Status.Conditions, conditionTemplateRendered)
+	}
 	err := r.Client.Status().Patch(ctx, &ghIssue, patch)
 
 	ie := InfoError{}
@@ -156,3 +359,17 @@ func (r *GitHubIssueReconciler) UpdateStatus(ghIssue examplev1alpha1.GitHubIssue
 
 	return &ie
 }
+
+// UpdateRenderFailure records a template rendering error on the GitHubIssue status
+func (r *GitHubIssueReconciler) UpdateRenderFailure(ghIssue examplev1alpha1.GitHubIssue, renderErr InfoError, ctx context.Context) *InfoError {
+	patch := client.MergeFrom(ghIssue.DeepCopy())
+	setTemplateCondition(&ghIssue, renderErr)
+	err := r.Client.Status().Patch(ctx, &ghIssue, patch)
+
+	ie := InfoError{}
+	if !requestSucceeded(err) {
+		ie = newInfoError(err, fmt.Sprintf("%s - Falied to update status", ghIssue.Name))
+	}
+
+	return &ie
+}
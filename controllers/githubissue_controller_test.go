@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const testRepo = "AlmogLevii/example-operator"
+
+func newTestGitHubIssue(title string, description string, finalizers []string, deleted bool) *examplev1alpha1.GitHubIssue {
+	ghIssue := &examplev1alpha1.GitHubIssue{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "sample1",
+			Namespace:  "default",
+			Finalizers: finalizers,
+		},
+		Spec: examplev1alpha1.GitHubIssueSpec{
+			Repo:        testRepo,
+			Title:       title,
+			Description: description,
+		},
+	}
+	if deleted {
+		now := metav1.Now()
+		ghIssue.DeletionTimestamp = &now
+	}
+	return ghIssue
+}
+
+// withIssueStatus records the GitHub issue number on the GitHubIssue status as a previous sync would
+func withIssueStatus(ghIssue *examplev1alpha1.GitHubIssue, number int) *examplev1alpha1.GitHubIssue {
+	ghIssue.Status.Number = number
+	ghIssue.Status.URL = fmt.Sprintf("https://github.com/%s/issues/%d", testRepo, number)
+	return ghIssue
+}
+
+func withSpecState(ghIssue *examplev1alpha1.GitHubIssue, state string) *examplev1alpha1.GitHubIssue {
+	ghIssue.Spec.State = state
+	return ghIssue
+}
+
+func newTestReconciler(t *testing.T, ghIssue *examplev1alpha1.GitHubIssue, ghClient *FakeGitHubClient) (*GitHubIssueReconciler, *record.FakeRecorder) {
+	c := newTestClient(t, ghIssue)
+	recorder := record.NewFakeRecorder(100)
+	return &GitHubIssueReconciler{
+		Client:          c,
+		Log:             logr.Discard(),
+		Scheme:          c.Scheme(),
+		NewGitHubClient: NewFakeGitHubClientFactory(ghClient),
+		Recorder:        recorder,
+	}, recorder
+}
+
+// eventReasons drains the recorder, each event is formatted as "<type> <reason> <message>"
+func eventReasons(recorder *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			reasons = append(reasons, strings.Join(strings.SplitN(event, " ", 3)[:2], " "))
+		default:
+			return reasons
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name          string
+		ghIssue       *examplev1alpha1.GitHubIssue
+		existing      []IssueData
+		wantCalls     []string
+		wantState     string
+		wantBody      string
+		wantFinalizer bool
+		wantEvents    []string
+	}{
+		{
+			name:          "create",
+			ghIssue:       newTestGitHubIssue("issue1", "test1", nil, false),
+			wantCalls:     []string{"create #1"},
+			wantState:     "open",
+			wantBody:      "test1",
+			wantFinalizer: true,
+			wantEvents:    []string{"Normal " + reasonFinalizerAdded, "Normal " + reasonCreated},
+		},
+		{
+			name:          "edit",
+			ghIssue:       newTestGitHubIssue("issue1", "test2", []string{issueFinalizer}, false),
+			existing:      []IssueData{{Title: "issue1", Description: "test1", State: "open"}},
+			wantCalls:     []string{"update #1"},
+			wantState:     "open",
+			wantBody:      "test2",
+			wantFinalizer: true,
+			wantEvents:    []string{"Normal " + reasonEdited},
+		},
+		{
+			name:          "retitle",
+			ghIssue:       withIssueStatus(newTestGitHubIssue("issue2", "test1", []string{issueFinalizer}, false), 1),
+			existing:      []IssueData{{Title: "issue1", Description: "test1", State: "open"}},
+			wantCalls:     []string{"update #1"},
+			wantState:     "open",
+			wantBody:      "test1",
+			wantFinalizer: true,
+			wantEvents:    []string{"Normal " + reasonEdited},
+		},
+		{
+			name: "labels",
+			ghIssue: func() *examplev1alpha1.GitHubIssue {
+				ghIssue := newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false)
+				ghIssue.Spec.Labels = []string{"bug"}
+				return ghIssue
+			}(),
+			existing:      []IssueData{{Title: "issue1", Description: "test1", State: "open"}},
+			wantCalls:     []string{"update #1"},
+			wantState:     "open",
+			wantBody:      "test1",
+			wantFinalizer: true,
+			wantEvents:    []string{"Normal " + reasonEdited},
+		},
+		{
+			name:          "reopen",
+			ghIssue:       newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false),
+			existing:      []IssueData{{Title: "issue1", Description: "test1", State: "closed"}},
+			wantCalls:     []string{"update #1"},
+			wantState:     "open",
+			wantBody:      "test1",
+			wantFinalizer: true,
+			wantEvents:    []string{"Normal " + reasonReopened},
+		},
+		{
+			name:          "close",
+			ghIssue:       withSpecState(newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false), "closed"),
+			existing:      []IssueData{{Title: "issue1", Description: "test1", State: "open"}},
+			wantCalls:     []string{"update #1"},
+			wantState:     "closed",
+			wantBody:      "test1",
+			wantFinalizer: true,
+			wantEvents:    []string{"Normal " + reasonClosed},
+		},
+		{
+			name:          "closed without an issue",
+			ghIssue:       withSpecState(newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false), "closed"),
+			wantFinalizer: true,
+		},
+		{
+			name:          "up to date",
+			ghIssue:       newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false),
+			existing:      []IssueData{{Title: "issue1", Description: "test1", State: "open"}},
+			wantState:     "open",
+			wantBody:      "test1",
+			wantFinalizer: true,
+		},
+		{
+			name:       "close on deletion",
+			ghIssue:    newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, true),
+			existing:   []IssueData{{Title: "issue1", Description: "test1", State: "open"}},
+			wantCalls:  []string{"close #1"},
+			wantState:  "closed",
+			wantBody:   "test1",
+			wantEvents: []string{"Normal " + reasonClosed, "Normal " + reasonFinalizerRemoved},
+		},
+		{
+			name:       "finalizer removal without an issue",
+			ghIssue:    newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, true),
+			wantEvents: []string{"Normal " + reasonFinalizerRemoved},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghClient := NewFakeGitHubClient(testRepo, tt.existing...)
+			r, recorder := newTestReconciler(t, tt.ghIssue, ghClient)
+			key := types.NamespacedName{Namespace: tt.ghIssue.Namespace, Name: tt.ghIssue.Name}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if calls := ghClient.Calls(); strings.Join(calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("GitHub calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if issues := ghClient.Issues(); len(tt.wantState) > 0 {
+				if len(issues) != 1 {
+					t.Fatalf("GitHub issues = %v, want exactly one", issues)
+				}
+				if issues[0].State != tt.wantState || issues[0].Description != tt.wantBody {
+					t.Errorf("GitHub issue state = %q body = %q, want %q %q", issues[0].State, issues[0].Description, tt.wantState, tt.wantBody)
+				}
+			}
+
+			got := examplev1alpha1.GitHubIssue{}
+			if err := r.Get(context.Background(), key, &got); err != nil {
+				t.Fatal(err)
+			}
+			if hasFinalizer := containsString(got.Finalizers, issueFinalizer); hasFinalizer != tt.wantFinalizer {
+				t.Errorf("finalizer present = %v, want %v", hasFinalizer, tt.wantFinalizer)
+			}
+			if tt.ghIssue.DeletionTimestamp.IsZero() && got.Status.State != tt.wantState {
+				t.Errorf("status state = %q, want %q", got.Status.State, tt.wantState)
+			}
+
+			if events := eventReasons(recorder); strings.Join(events, ",") != strings.Join(tt.wantEvents, ",") {
+				t.Errorf("events = %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestReconcileComments(t *testing.T) {
+	ghIssue := withIssueStatus(newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false), 1)
+	ghIssue.Spec.Comments = []string{"firing", "resolved", "firing again"}
+	ghIssue.Status.CommentsPosted = 1
+	ghClient := NewFakeGitHubClient(testRepo, IssueData{Title: "issue1", Description: "test1", State: "open"})
+	r, recorder := newTestReconciler(t, ghIssue, ghClient)
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if comments := ghClient.Comments(1); strings.Join(comments, ",") != "resolved,firing again" {
+		t.Errorf("comments = %v, want the ones not posted yet", comments)
+	}
+	got := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.CommentsPosted != 3 {
+		t.Errorf("status commentsPosted = %d, want 3", got.Status.CommentsPosted)
+	}
+	if events := eventReasons(recorder); strings.Join(events, ",") != "Normal "+reasonCommented {
+		t.Errorf("events = %v, want a single %s", events, reasonCommented)
+	}
+
+	// every comment was posted, another sync posts nothing
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if comments := ghClient.Comments(1); len(comments) != 2 {
+		t.Errorf("comments after a second sync = %v, want no new comment", comments)
+	}
+}
+
+// slowGitHubClient only answers the creation once the sync deadline is reached
+type slowGitHubClient struct {
+	*FakeGitHubClient
+	hasDeadline bool
+}
+
+func (s *slowGitHubClient) Create(ctx context.Context, k8sBasedIssue IssueData) (*IssueData, *InfoError) {
+	_, s.hasDeadline = ctx.Deadline()
+	<-ctx.Done()
+	return s.FakeGitHubClient.Create(context.Background(), k8sBasedIssue)
+}
+
+// contextCheckingClient fails the writes made with a done context, like the client of the API server
+type contextCheckingClient struct {
+	client.Client
+}
+
+func (c contextCheckingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c contextCheckingClient) Status() client.StatusWriter {
+	return contextCheckingStatusWriter{c.Client.Status()}
+}
+
+type contextCheckingStatusWriter struct {
+	client.StatusWriter
+}
+
+func (w contextCheckingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func TestReconcileSyncTimeout(t *testing.T) {
+	ghIssue := newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false)
+	ghClient := &slowGitHubClient{FakeGitHubClient: NewFakeGitHubClient(testRepo)}
+	r, _ := newTestReconciler(t, ghIssue, ghClient.FakeGitHubClient)
+	r.Client = contextCheckingClient{r.Client}
+	r.NewGitHubClient = func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		return ghClient, nil
+	}
+	r.SyncTimeout = 10 * time.Millisecond
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if !ghClient.hasDeadline {
+		t.Error("the tracker request has no deadline, want the sync timeout")
+	}
+	// the tracker used up the sync timeout, the status is still written
+	got := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Number != 1 {
+		t.Errorf("status = %+v, want the created issue recorded", got.Status)
+	}
+}
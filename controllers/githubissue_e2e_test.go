@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/AlmogLevii/example-operator/controllers/fakegithub"
+)
+
+// These specs run the manager against envtest and the fake GitHub API, each
+// one uses its own repo so that they don't see each other's issues.
+var _ = Describe("GitHubIssue controller", func() {
+	const (
+		timeout  = 15 * time.Second
+		interval = 250 * time.Millisecond
+	)
+	ctx := context.Background()
+
+	newGitHubIssue := func(name string, repo string) *examplev1alpha1.GitHubIssue {
+		return &examplev1alpha1.GitHubIssue{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: examplev1alpha1.GitHubIssueSpec{
+				Repo:        repo,
+				Title:       name + " title",
+				Description: name + " body",
+			},
+		}
+	}
+
+	getGitHubIssue := func(key types.NamespacedName) func() examplev1alpha1.GitHubIssue {
+		return func() examplev1alpha1.GitHubIssue {
+			ghIssue := examplev1alpha1.GitHubIssue{}
+			Expect(k8sClient.Get(ctx, key, &ghIssue)).To(Succeed())
+			return ghIssue
+		}
+	}
+
+	remoteIssues := func(repo string) func() []fakegithub.Issue {
+		return func() []fakegithub.Issue {
+			return fakeGitHub.Issues(repo)
+		}
+	}
+
+	syncedReasonOf := func(key types.NamespacedName) func() string {
+		return func() string {
+			synced := meta.FindStatusCondition(getGitHubIssue(key)().Status.Conditions, conditionSynced)
+			if synced == nil {
+				return ""
+			}
+			return synced.Reason
+		}
+	}
+
+	eventReasonsOf := func(name string) func() []string {
+		return func() []string {
+			events := corev1.EventList{}
+			Expect(k8sClient.List(ctx, &events, client.InNamespace("default"))).To(Succeed())
+			var reasons []string
+			for _, event := range events.Items {
+				if event.InvolvedObject.Name == name {
+					reasons = append(reasons, event.Reason)
+				}
+			}
+			return reasons
+		}
+	}
+
+	It("creates the issue and follows edits of the title and body", func() {
+		const repo = "e2e/apply-edit"
+		ghIssue := newGitHubIssue("apply-edit", repo)
+		ghIssue.Spec.BodyTemplate = &examplev1alpha1.IssueTemplate{Inline: "{{ .Values.summary }} in {{ .Namespace }}"}
+		ghIssue.Spec.Values = map[string]string{"summary": "disk is full"}
+		key := types.NamespacedName{Name: ghIssue.Name, Namespace: ghIssue.Namespace}
+		Expect(k8sClient.Create(ctx, ghIssue)).To(Succeed())
+
+		By("creating the remote issue")
+		Eventually(remoteIssues(repo), timeout, interval).Should(HaveLen(1))
+		Expect(fakeGitHub.Issues(repo)[0].Title).To(Equal("apply-edit title"))
+		Expect(fakeGitHub.Issues(repo)[0].Body).To(Equal("disk is full in default"))
+
+		Eventually(func() int { return getGitHubIssue(key)().Status.Number }, timeout, interval).Should(Equal(1))
+		created := getGitHubIssue(key)()
+		Expect(created.Status.State).To(Equal("open"))
+		Expect(created.Status.URL).To(Equal(fakeGitHub.Issues(repo)[0].HTMLURL))
+		Expect(created.Finalizers).To(ContainElement(issueFinalizer))
+		Expect(meta.IsStatusConditionTrue(created.Status.Conditions, conditionTemplateRendered)).To(BeTrue())
+
+		By("editing the title and the body")
+		Eventually(func() error {
+			// the controller may have patched the status since the last get
+			edited := getGitHubIssue(key)()
+			edited.Spec.Title = "apply-edit new title"
+			edited.Spec.Values = map[string]string{"summary": "disk is almost full"}
+			return k8sClient.Update(ctx, &edited)
+		}, timeout, interval).Should(Succeed())
+
+		Eventually(func() string {
+			issues := fakeGitHub.Issues(repo)
+			return issues[0].Title + "|" + issues[0].Body
+		}, timeout, interval).Should(Equal("apply-edit new title|disk is almost full in default"))
+		Expect(fakeGitHub.Issues(repo)).To(HaveLen(1))
+		Eventually(eventReasonsOf(ghIssue.Name), timeout, interval).Should(ContainElement(reasonEdited))
+
+		Expect(k8sClient.Delete(ctx, &created)).To(Succeed())
+	})
+
+	It("reopens an issue closed on GitHub while the GitHubIssue is open", func() {
+		const repo = "e2e/reopen"
+		ghIssue := newGitHubIssue("reopen", repo)
+		key := types.NamespacedName{Name: ghIssue.Name, Namespace: ghIssue.Namespace}
+		Expect(k8sClient.Create(ctx, ghIssue)).To(Succeed())
+		Eventually(func() string { return getGitHubIssue(key)().Status.State }, timeout, interval).Should(Equal("open"))
+
+		By("closing the issue remotely")
+		fakeGitHub.SetIssueState(repo, 1, "closed")
+
+		Eventually(func() string { return fakeGitHub.Issues(repo)[0].State }, timeout, interval).Should(Equal("open"))
+		Expect(fakeGitHub.Issues(repo)).To(HaveLen(1))
+		Eventually(eventReasonsOf(ghIssue.Name), timeout, interval).Should(ContainElement(reasonReopened))
+		Expect(getGitHubIssue(key)().Status.State).To(Equal("open"))
+
+		Expect(k8sClient.Delete(ctx, ghIssue)).To(Succeed())
+	})
+
+	It("closes the issue and removes the finalizer on deletion", func() {
+		const repo = "e2e/delete"
+		ghIssue := newGitHubIssue("delete", repo)
+		key := types.NamespacedName{Name: ghIssue.Name, Namespace: ghIssue.Namespace}
+		Expect(k8sClient.Create(ctx, ghIssue)).To(Succeed())
+		Eventually(func() []string { return getGitHubIssue(key)().Finalizers }, timeout, interval).Should(ContainElement(issueFinalizer))
+		Eventually(func() string { return getGitHubIssue(key)().Status.State }, timeout, interval).Should(Equal("open"))
+
+		Expect(k8sClient.Delete(ctx, ghIssue)).To(Succeed())
+
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, key, &examplev1alpha1.GitHubIssue{})
+			return errors.IsNotFound(err)
+		}, timeout, interval).Should(BeTrue())
+		Expect(fakeGitHub.Issues(repo)).To(HaveLen(1))
+		Expect(fakeGitHub.Issues(repo)[0].State).To(Equal("closed"))
+		Eventually(eventReasonsOf(ghIssue.Name), timeout, interval).Should(ContainElements(reasonClosed, reasonFinalizerRemoved))
+	})
+
+	It("reports credential failures and recovers once they are fixed", func() {
+		const repo = "e2e/credentials"
+		fakeGitHub.Fail(fakegithub.Failure{Path: "/repos/" + repo, Status: http.StatusUnauthorized, Message: "Bad credentials"})
+		ghIssue := newGitHubIssue("credentials", repo)
+		key := types.NamespacedName{Name: ghIssue.Name, Namespace: ghIssue.Namespace}
+		Expect(k8sClient.Create(ctx, ghIssue)).To(Succeed())
+
+		Eventually(eventReasonsOf(ghIssue.Name), timeout, interval).Should(ContainElement(reasonAuthFailed))
+		Eventually(syncedReasonOf(key), timeout, interval).Should(Equal(reasonAuthFailed))
+		Expect(meta.IsStatusConditionFalse(getGitHubIssue(key)().Status.Conditions, conditionSynced)).To(BeTrue())
+		Consistently(remoteIssues(repo), 2*time.Second, interval).Should(BeEmpty())
+		Expect(getGitHubIssue(key)().Status.Number).To(BeZero())
+
+		By("fixing the credentials")
+		fakeGitHub.ClearFailures()
+
+		Eventually(func() int { return getGitHubIssue(key)().Status.Number }, timeout, interval).Should(Equal(1))
+		Eventually(syncedReasonOf(key), timeout, interval).Should(Equal(reasonSynced))
+		Expect(fakeGitHub.Issues(repo)).To(HaveLen(1))
+
+		Expect(k8sClient.Delete(ctx, ghIssue)).To(Succeed())
+	})
+})
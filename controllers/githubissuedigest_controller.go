@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const digestLabel = "example.training.redhat.com/digest"
+
+// GitHubIssueDigestReconciler reconciles a GitHubIssueDigest object. The
+// rollup issue is a GitHubIssue owned by the digest, so it is synced like any
+// other and closed when the digest is deleted.
+type GitHubIssueDigestReconciler struct {
+	client.Client
+	Log logr.Logger
+}
+
+//+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissuedigests,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissuedigests/status,verbs=get;update;patch
+
+// Reconcile renders the task list of the selected GitHubIssues into the
+// rollup GitHubIssue, which is closed once all of them are closed
+func (r *GitHubIssueDigestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("githubissuedigest", req.NamespacedName)
+
+	var digest examplev1alpha1.GitHubIssueDigest
+	if err := r.Get(ctx, req.NamespacedName, &digest); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !digest.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	children, err := r.children(ctx, digest)
+	if err != nil {
+		log.Error(err, "failed to list the GitHubIssues of the digest")
+		return ctrl.Result{}, err
+	}
+	closed := 0
+	for _, child := range children {
+		if child.Status.State == "closed" {
+			closed++
+		}
+	}
+	state := "open"
+	if len(children) > 0 && closed == len(children) {
+		state = "closed"
+	}
+
+	source := sourceFingerprint(digest.Namespace + "/" + digest.Name)
+	key := types.NamespacedName{Namespace: digest.Namespace, Name: "digest-" + source}
+	err = syncGeneratedIssue(ctx, r.Client, key, digestLabel, source, true, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(&digest, examplev1alpha1.GroupVersion.WithKind("GitHubIssueDigest"))}
+		}
+		ghIssue.Spec.Provider = digest.Spec.Provider
+		ghIssue.Spec.Repo = digest.Spec.Repo
+		ghIssue.Spec.Labels = digest.Spec.Labels
+		ghIssue.Spec.Title = digest.Spec.Title
+		ghIssue.Spec.Description = digestBody(digest, children, closed)
+		ghIssue.Spec.State = state
+	})
+	if err != nil {
+		log.Error(err, "failed to sync the rollup GitHubIssue")
+		return ctrl.Result{}, err
+	}
+
+	var rollup examplev1alpha1.GitHubIssue
+	if err := r.Get(ctx, key, &rollup); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	patch := client.MergeFrom(digest.DeepCopy())
+	digest.Status = examplev1alpha1.GitHubIssueDigestStatus{
+		IssueName: key.Name,
+		URL:       rollup.Status.URL,
+		State:     rollup.Status.State,
+		Total:     len(children),
+		Closed:    closed,
+	}
+	return ctrl.Result{}, r.Status().Patch(ctx, &digest, patch)
+}
+
+// children are the GitHubIssues selected by the digest, the oldest first.
+// Rollup issues are never children, so digests can't select each other.
+func (r *GitHubIssueDigestReconciler) children(ctx context.Context, digest examplev1alpha1.GitHubIssueDigest) ([]examplev1alpha1.GitHubIssue, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&digest.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := r.List(ctx, &ghIssues, client.InNamespace(digest.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	var children []examplev1alpha1.GitHubIssue
+	for _, ghIssue := range ghIssues.Items {
+		if _, ok := ghIssue.Labels[digestLabel]; !ok {
+			children = append(children, ghIssue)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		if children[i].CreationTimestamp.Equal(&children[j].CreationTimestamp) {
+			return children[i].Name < children[j].Name
+		}
+		return children[i].CreationTimestamp.Before(&children[j].CreationTimestamp)
+	})
+	return children, nil
+}
+
+// digestBody is the Markdown task list of the children, a closed child is checked
+func digestBody(digest examplev1alpha1.GitHubIssueDigest, children []examplev1alpha1.GitHubIssue, closed int) string {
+	var body strings.Builder
+	if !isEmpty(digest.Spec.Description) {
+		fmt.Fprintf(&body, "%s\n\n", strings.TrimRight(digest.Spec.Description, "\n"))
+	}
+	if len(children) == 0 {
+		body.WriteString("No issue is selected yet.\n")
+		return body.String()
+	}
+
+	fmt.Fprintf(&body, "%d of %d issues are closed.\n\n", closed, len(children))
+	for _, child := range children {
+		check := " "
+		if child.Status.State == "closed" {
+			check = "x"
+		}
+		title := child.Spec.Title
+		if !isEmpty(child.Status.URL) {
+			title = fmt.Sprintf("[%s](%s)", title, child.Status.URL)
+		}
+		state := child.Status.State
+		if isEmpty(state) {
+			state = "not filed yet"
+		}
+		fmt.Fprintf(&body, "- [%s] %s (%s)\n", check, title, state)
+	}
+	return truncate(body.String(), maxRenderedBodySize)
+}
+
+// digestRequests maps a GitHubIssue to the digests selecting it
+func (r *GitHubIssueDigestReconciler) digestRequests(object client.Object) []reconcile.Request {
+	if _, ok := object.GetLabels()[digestLabel]; ok {
+		return nil
+	}
+	var digests examplev1alpha1.GitHubIssueDigestList
+	if err := r.List(context.Background(), &digests, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list the digests of a GitHubIssue", "githubissue", object.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, digest := range digests.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&digest.Spec.Selector)
+		if err == nil && selector.Matches(labels.Set(object.GetLabels())) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: digest.Namespace, Name: digest.Name}})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GitHubIssueDigestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&examplev1alpha1.GitHubIssueDigest{}).
+		Owns(&examplev1alpha1.GitHubIssue{}).
+		Watches(&source.Kind{Type: &examplev1alpha1.GitHubIssue{}}, handler.EnqueueRequestsFromMapFunc(r.digestRequests)).
+		Complete(r)
+}
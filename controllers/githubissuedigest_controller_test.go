@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestDigestReconciler(t *testing.T, objects ...client.Object) *GitHubIssueDigestReconciler {
+	return &GitHubIssueDigestReconciler{
+		Client: newTestClient(t, objects...),
+		Log:    logr.Discard(),
+	}
+}
+
+// newTestChild is a GitHubIssue of release 1.2 synced to issue number in state
+func newTestChild(name string, title string, number int, state string) *examplev1alpha1.GitHubIssue {
+	ghIssue := newTestGitHubIssue(title, "", nil, false)
+	ghIssue.Name = name
+	ghIssue.Labels = map[string]string{"release": "1.2"}
+	if number != 0 {
+		withIssueStatus(ghIssue, number)
+		ghIssue.Status.State = state
+	}
+	return ghIssue
+}
+
+func reconcileDigest(t *testing.T, r *GitHubIssueDigestReconciler) (examplev1alpha1.GitHubIssueDigest, examplev1alpha1.GitHubIssue) {
+	reconcileRequest(t, r, "default", "release-1-2")
+	var digest examplev1alpha1.GitHubIssueDigest
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "release-1-2"}, &digest); err != nil {
+		t.Fatal(err)
+	}
+	var rollup examplev1alpha1.GitHubIssue
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: digest.Status.IssueName}, &rollup); err != nil {
+		t.Fatal(err)
+	}
+	return digest, rollup
+}
+
+func TestDigest(t *testing.T) {
+	digest := &examplev1alpha1.GitHubIssueDigest{
+		ObjectMeta: metav1.ObjectMeta{Name: "release-1-2", Namespace: "default", UID: "digest-uid"},
+		Spec: examplev1alpha1.GitHubIssueDigestSpec{
+			Selector:    metav1.LabelSelector{MatchLabels: map[string]string{"release": "1.2"}},
+			Repo:        testRepo,
+			Title:       "Release 1.2 readiness",
+			Description: "Ship it once everything is closed.",
+		},
+	}
+	other := newTestChild("other", "Another release", 9, "open")
+	other.Labels["release"] = "1.3"
+	r := newTestDigestReconciler(t, digest, other,
+		newTestChild("docs", "Update the docs", 1, "closed"),
+		newTestChild("migration", "Write the migration", 2, "open"),
+		newTestChild("changelog", "Write the changelog", 0, ""))
+
+	got, rollup := reconcileDigest(t, r)
+	if got.Status.Total != 3 || got.Status.Closed != 1 {
+		t.Errorf("status = %+v, want 1 of 3 closed", got.Status)
+	}
+	if rollup.Spec.Title != "Release 1.2 readiness" || rollup.Spec.State != "open" || rollup.Spec.Repo != testRepo {
+		t.Errorf("rollup spec = %+v, want an open rollup issue", rollup.Spec)
+	}
+	if owner := metav1.GetControllerOf(&rollup); owner == nil || owner.Name != "release-1-2" {
+		t.Errorf("owner = %+v, want the digest", owner)
+	}
+	for _, want := range []string{
+		"Ship it once everything is closed.\n\n1 of 3 issues are closed.",
+		"- [x] [Update the docs](https://github.com/AlmogLevii/example-operator/issues/1) (closed)",
+		"- [ ] [Write the migration](https://github.com/AlmogLevii/example-operator/issues/2) (open)",
+		"- [ ] Write the changelog (not filed yet)",
+	} {
+		if !strings.Contains(rollup.Spec.Description, want) {
+			t.Errorf("description = %q, want %q", rollup.Spec.Description, want)
+		}
+	}
+	if strings.Contains(rollup.Spec.Description, "Another release") {
+		t.Errorf("description = %q, want the other release left out", rollup.Spec.Description)
+	}
+
+	// the rollup issue is closed with the last child
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := r.List(context.Background(), &ghIssues, client.MatchingLabels{"release": "1.2"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range ghIssues.Items {
+		ghIssues.Items[i].Status.State = "closed"
+		if err := r.Status().Update(context.Background(), &ghIssues.Items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, rollup = reconcileDigest(t, r)
+	if got.Status.Closed != 3 || rollup.Spec.State != "closed" {
+		t.Errorf("status = %+v, state = %q, want the rollup issue closed", got.Status, rollup.Spec.State)
+	}
+	if requests := r.digestRequests(&rollup); len(requests) != 0 {
+		t.Errorf("requests of the rollup = %v, want none", requests)
+	}
+	if requests := r.digestRequests(&ghIssues.Items[0]); len(requests) != 1 {
+		t.Errorf("requests of a child = %v, want the digest", requests)
+	}
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	scheduledTimeAnnotation = "example.training.redhat.com/scheduled-at"
+	defaultScheduleDate     = "2006-01-02"
+
+	// conditionInvalidSchedule is true while the schedule files nothing because
+	// its schedule or time zone can't be parsed, the event has the same reason
+	conditionInvalidSchedule = "InvalidSchedule"
+)
+
+// GitHubIssueScheduleReconciler reconciles a GitHubIssueSchedule object
+type GitHubIssueScheduleReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+
+	now func() time.Time
+}
+
+//+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissueschedules,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=example.training.redhat.com,resources=githubissueschedules/status,verbs=get;update;patch
+
+// Reconcile files the GitHubIssue of the last tick not filed yet and
+// requeues for the next tick. Like a CronJob, a schedule that missed several
+// ticks only files the last one.
+func (r *GitHubIssueScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("githubissueschedule", req.NamespacedName)
+
+	var schedule examplev1alpha1.GitHubIssueSchedule
+	if err := r.Get(ctx, req.NamespacedName, &schedule); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	children, err := r.children(ctx, schedule)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var active, closed []examplev1alpha1.GitHubIssue
+	for _, child := range children {
+		if child.Spec.State == "closed" || child.Status.State == "closed" {
+			closed = append(closed, child)
+		} else {
+			active = append(active, child)
+		}
+	}
+	if err := r.pruneHistory(ctx, schedule, closed); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status := examplev1alpha1.GitHubIssueScheduleStatus{LastScheduleTime: schedule.Status.LastScheduleTime, Conditions: schedule.Status.DeepCopy().Conditions}
+	for _, child := range active {
+		status.Active = append(status.Active, child.Name)
+	}
+	if len(children) > 0 {
+		last := metav1.NewTime(scheduledTimeOf(children[len(children)-1]))
+		if status.LastScheduleTime == nil || status.LastScheduleTime.Before(&last) {
+			status.LastScheduleTime = &last
+		}
+	}
+	if schedule.Spec.Suspend != nil && *schedule.Spec.Suspend {
+		return ctrl.Result{}, r.updateStatus(ctx, schedule, status)
+	}
+
+	location, err := time.LoadLocation(schedule.Spec.TimeZone)
+	if err != nil {
+		log.Error(err, "invalid time zone", "timeZone", schedule.Spec.TimeZone)
+		r.recordInvalidSchedule(schedule, &status, "InvalidTimeZone", fmt.Sprintf("time zone %q: %v", schedule.Spec.TimeZone, err))
+		return ctrl.Result{}, r.updateStatus(ctx, schedule, status)
+	}
+	cronSchedule, err := cron.ParseStandard(schedule.Spec.Schedule)
+	if err != nil {
+		log.Error(err, "invalid schedule", "schedule", schedule.Spec.Schedule)
+		r.recordInvalidSchedule(schedule, &status, "InvalidCronSchedule", fmt.Sprintf("schedule %q: %v", schedule.Spec.Schedule, err))
+		return ctrl.Result{}, r.updateStatus(ctx, schedule, status)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionInvalidSchedule,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Parsed",
+		Message:            "The schedule and the time zone were parsed",
+		ObservedGeneration: schedule.Generation,
+	})
+
+	now := r.clock()
+	missed, next := missedTick(schedule, status.LastScheduleTime, cronSchedule, location, now)
+	result := ctrl.Result{RequeueAfter: next.Sub(now)}
+	if missed.IsZero() {
+		return result, r.updateStatus(ctx, schedule, status)
+	}
+
+	log.Info("filing the issue of a tick", "scheduledTime", missed)
+	child := newScheduledIssue(schedule, missed, location)
+	if err := r.Create(ctx, child); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+	scheduled := metav1.NewTime(missed)
+	status.LastScheduleTime = &scheduled
+
+	if schedule.Spec.ConcurrencyPolicy == examplev1alpha1.ClosePrevious {
+		for i := range active {
+			if active[i].Name == child.Name {
+				continue
+			}
+			active[i].Spec.State = "closed"
+			if err := r.Update(ctx, &active[i]); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		status.Active = nil
+	}
+	if !containsString(status.Active, child.Name) {
+		status.Active = append(status.Active, child.Name)
+	}
+	return result, r.updateStatus(ctx, schedule, status)
+}
+
+// recordInvalidSchedule reports why the schedule files nothing with a warning
+// event and the InvalidSchedule condition
+func (r *GitHubIssueScheduleReconciler) recordInvalidSchedule(schedule examplev1alpha1.GitHubIssueSchedule, status *examplev1alpha1.GitHubIssueScheduleStatus, reason string, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(&schedule, corev1.EventTypeWarning, conditionInvalidSchedule, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionInvalidSchedule,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: schedule.Generation,
+	})
+}
+
+// children are the GitHubIssues of the schedule, the oldest tick first
+func (r *GitHubIssueScheduleReconciler) children(ctx context.Context, schedule examplev1alpha1.GitHubIssueSchedule) ([]examplev1alpha1.GitHubIssue, error) {
+	var ghIssues examplev1alpha1.GitHubIssueList
+	if err := r.List(ctx, &ghIssues, client.InNamespace(schedule.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var children []examplev1alpha1.GitHubIssue
+	for _, ghIssue := range ghIssues.Items {
+		if owner := metav1.GetControllerOf(&ghIssue); owner != nil && owner.Kind == "GitHubIssueSchedule" && owner.Name == schedule.Name {
+			children = append(children, ghIssue)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return scheduledTimeOf(children[i]).Before(scheduledTimeOf(children[j]))
+	})
+	return children, nil
+}
+
+// pruneHistory deletes the oldest closed GitHubIssues beyond the history limit
+func (r *GitHubIssueScheduleReconciler) pruneHistory(ctx context.Context, schedule examplev1alpha1.GitHubIssueSchedule, closed []examplev1alpha1.GitHubIssue) error {
+	limit := schedule.Spec.ClosedHistoryLimit
+	if limit == nil {
+		return nil
+	}
+	for i := 0; i < len(closed)-int(*limit); i++ {
+		if err := r.Delete(ctx, &closed[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *GitHubIssueScheduleReconciler) updateStatus(ctx context.Context, schedule examplev1alpha1.GitHubIssueSchedule, status examplev1alpha1.GitHubIssueScheduleStatus) error {
+	patch := client.MergeFrom(schedule.DeepCopy())
+	schedule.Status = status
+	return r.Status().Patch(ctx, &schedule, patch)
+}
+
+// missedTick is the last tick since the last one filed, zero when there is
+// none, and the next one. Ticks older than the starting deadline are skipped.
+func missedTick(schedule examplev1alpha1.GitHubIssueSchedule, lastScheduleTime *metav1.Time, cronSchedule cron.Schedule, location *time.Location, now time.Time) (time.Time, time.Time) {
+	earliest := schedule.CreationTimestamp.Time
+	if lastScheduleTime != nil {
+		earliest = lastScheduleTime.Time
+	}
+	if deadline := schedule.Spec.StartingDeadlineSeconds; deadline != nil {
+		if start := now.Add(-time.Duration(*deadline) * time.Second); start.After(earliest) {
+			earliest = start
+		}
+	}
+
+	var missed time.Time
+	tick := cronSchedule.Next(earliest.In(location))
+	for ; !tick.After(now); tick = cronSchedule.Next(tick) {
+		missed = tick
+	}
+	return missed, tick
+}
+
+// newScheduledIssue is the GitHubIssue of the tick, its name is unique to the tick
+func newScheduledIssue(schedule examplev1alpha1.GitHubIssueSchedule, tick time.Time, location *time.Location) *examplev1alpha1.GitHubIssue {
+	layout := schedule.Spec.DateFormat
+	if isEmpty(layout) {
+		layout = defaultScheduleDate
+	}
+	date := tick.In(location).Format(layout)
+
+	template := schedule.Spec.IssueTemplate.DeepCopy()
+	ghIssue := &examplev1alpha1.GitHubIssue{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-%d", schedule.Name, tick.Unix()),
+			Namespace:       schedule.Namespace,
+			Labels:          template.Metadata.Labels,
+			Annotations:     template.Metadata.Annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&schedule, examplev1alpha1.GroupVersion.WithKind("GitHubIssueSchedule"))},
+		},
+		Spec: template.Spec,
+	}
+	if ghIssue.Annotations == nil {
+		ghIssue.Annotations = map[string]string{}
+	}
+	ghIssue.Annotations[scheduledTimeAnnotation] = tick.UTC().Format(time.RFC3339)
+	ghIssue.Spec.Title = strings.TrimSpace(ghIssue.Spec.Title + " " + date)
+	if ghIssue.Spec.Values == nil {
+		ghIssue.Spec.Values = map[string]string{}
+	}
+	ghIssue.Spec.Values["date"] = date
+	ghIssue.Spec.Values["scheduledTime"] = tick.In(location).Format(time.RFC3339)
+	return ghIssue
+}
+
+// scheduledTimeOf is the tick the GitHubIssue was filed for
+func scheduledTimeOf(ghIssue examplev1alpha1.GitHubIssue) time.Time {
+	scheduled, err := time.Parse(time.RFC3339, ghIssue.Annotations[scheduledTimeAnnotation])
+	if err != nil {
+		return ghIssue.CreationTimestamp.Time
+	}
+	return scheduled
+}
+
+func (r *GitHubIssueScheduleReconciler) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GitHubIssueScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&examplev1alpha1.GitHubIssueSchedule{}).
+		Owns(&examplev1alpha1.GitHubIssue{}).
+		Complete(r)
+}
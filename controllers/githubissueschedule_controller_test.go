@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var testScheduleCreated = time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+func newTestSchedule(policy examplev1alpha1.ConcurrencyPolicy) *examplev1alpha1.GitHubIssueSchedule {
+	historyLimit := int32(1)
+	return &examplev1alpha1.GitHubIssueSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "handoff", Namespace: "default", CreationTimestamp: metav1.NewTime(testScheduleCreated)},
+		Spec: examplev1alpha1.GitHubIssueScheduleSpec{
+			Schedule:           "0 9 * * *",
+			TimeZone:           "Europe/Paris",
+			ConcurrencyPolicy:  policy,
+			ClosedHistoryLimit: &historyLimit,
+			IssueTemplate: examplev1alpha1.GitHubIssueTemplateSpec{
+				Metadata: examplev1alpha1.TemplateMetadata{Labels: map[string]string{"team": "sre"}},
+				Spec:     examplev1alpha1.GitHubIssueSpec{Repo: testRepo, Title: "On-call handoff", Description: "Hand the pager over."},
+			},
+		},
+	}
+}
+
+func newTestScheduleReconciler(t *testing.T, schedule *examplev1alpha1.GitHubIssueSchedule) *GitHubIssueScheduleReconciler {
+	return &GitHubIssueScheduleReconciler{
+		Client: newTestClient(t, schedule),
+		Log:    logr.Discard(),
+	}
+}
+
+// reconcileSchedule reconciles the schedule at now
+func reconcileSchedule(t *testing.T, r *GitHubIssueScheduleReconciler, now time.Time) (ctrl.Result, examplev1alpha1.GitHubIssueSchedule) {
+	r.now = func() time.Time { return now }
+	result := reconcileRequest(t, r, "default", "handoff")
+	var schedule examplev1alpha1.GitHubIssueSchedule
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "handoff"}, &schedule); err != nil {
+		t.Fatal(err)
+	}
+	return result, schedule
+}
+
+func TestSchedule(t *testing.T) {
+	r := newTestScheduleReconciler(t, newTestSchedule(examplev1alpha1.KeepConcurrent))
+
+	// 10:30 in Paris, the tick of 9:00 is due
+	now := time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)
+	result, schedule := reconcileSchedule(t, r, now)
+	if result.RequeueAfter != 22*time.Hour+30*time.Minute {
+		t.Errorf("RequeueAfter = %v, want the next tick", result.RequeueAfter)
+	}
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want the one of the tick", ghIssues)
+	}
+	ghIssue := ghIssues[0]
+	if ghIssue.Name != "handoff-1792393200" || ghIssue.Spec.Title != "On-call handoff 2026-10-19" || ghIssue.Labels["team"] != "sre" {
+		t.Errorf("GitHubIssue = %+v, want the dated issue of the tick", ghIssue)
+	}
+	if ghIssue.Spec.Values["scheduledTime"] != "2026-10-19T09:00:00+02:00" {
+		t.Errorf("values = %v, want the tick in the time zone", ghIssue.Spec.Values)
+	}
+	if owner := metav1.GetControllerOf(&ghIssue); owner == nil || owner.Name != "handoff" {
+		t.Errorf("owner = %+v, want the schedule", owner)
+	}
+	if !sameStrings(schedule.Status.Active, []string{ghIssue.Name}) || !schedule.Status.LastScheduleTime.Time.Equal(time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("status = %+v, want the issue active", schedule.Status)
+	}
+
+	// the same tick is never filed twice
+	reconcileSchedule(t, r, now.Add(time.Hour))
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 1 {
+		t.Errorf("GitHubIssues = %d, want still one", len(ghIssues))
+	}
+
+	// the manager was down for two days, only the last tick is filed
+	_, schedule = reconcileSchedule(t, r, now.AddDate(0, 0, 2))
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 2 || ghIssues[1].Spec.Title != "On-call handoff 2026-10-21" {
+		t.Errorf("GitHubIssues = %+v, want the issue of the last missed tick", ghIssues)
+	}
+	if len(schedule.Status.Active) != 2 {
+		t.Errorf("active = %v, want both issues kept open", schedule.Status.Active)
+	}
+}
+
+func TestScheduleClosePrevious(t *testing.T) {
+	r := newTestScheduleReconciler(t, newTestSchedule(examplev1alpha1.ClosePrevious))
+	now := time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)
+
+	reconcileSchedule(t, r, now)
+	reconcileSchedule(t, r, now.AddDate(0, 0, 1))
+	reconcileSchedule(t, r, now.AddDate(0, 0, 2))
+	// closing the previous issue reconciles the schedule again
+	_, schedule := reconcileSchedule(t, r, now.AddDate(0, 0, 2))
+
+	// the first issue was closed by the second tick and deleted by the history limit
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 2 {
+		t.Fatalf("GitHubIssues = %+v, want the last closed one and the active one", ghIssues)
+	}
+	if ghIssues[0].Spec.Title != "On-call handoff 2026-10-20" || ghIssues[0].Spec.State != "closed" {
+		t.Errorf("GitHubIssue = %+v, want the previous issue closed", ghIssues[0])
+	}
+	if !sameStrings(schedule.Status.Active, []string{ghIssues[1].Name}) || ghIssues[1].Spec.Title != "On-call handoff 2026-10-21" {
+		t.Errorf("active = %v, want only the last issue", schedule.Status.Active)
+	}
+}
+
+func TestScheduleSkipped(t *testing.T) {
+	suspended := newTestSchedule(examplev1alpha1.KeepConcurrent)
+	suspend := true
+	suspended.Spec.Suspend = &suspend
+	r := newTestScheduleReconciler(t, suspended)
+	reconcileSchedule(t, r, time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC))
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none while suspended", ghIssues)
+	}
+
+	late := newTestSchedule(examplev1alpha1.KeepConcurrent)
+	deadline := int64(600)
+	late.Spec.StartingDeadlineSeconds = &deadline
+	r = newTestScheduleReconciler(t, late)
+	reconcileSchedule(t, r, time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC))
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want the tick missed by more than the deadline skipped", ghIssues)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	invalid := newTestSchedule(examplev1alpha1.KeepConcurrent)
+	invalid.Spec.TimeZone = "Mars/Olympus"
+	r := newTestScheduleReconciler(t, invalid)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	now := time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)
+
+	_, schedule := reconcileSchedule(t, r, now)
+	condition := meta.FindStatusCondition(schedule.Status.Conditions, conditionInvalidSchedule)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != "InvalidTimeZone" {
+		t.Errorf("condition = %+v, want the time zone reported", condition)
+	}
+	if events := eventReasons(recorder); len(events) != 1 || events[0] != corev1.EventTypeWarning+" "+conditionInvalidSchedule {
+		t.Errorf("events = %v, want an %s warning", events, conditionInvalidSchedule)
+	}
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none", ghIssues)
+	}
+
+	// the fixed schedule files its tick and clears the condition
+	schedule.Spec.TimeZone = "Europe/Paris"
+	if err := r.Update(context.Background(), &schedule); err != nil {
+		t.Fatal(err)
+	}
+	_, schedule = reconcileSchedule(t, r, now)
+	if meta.IsStatusConditionTrue(schedule.Status.Conditions, conditionInvalidSchedule) {
+		t.Errorf("conditions = %+v, want %s false", schedule.Status.Conditions, conditionInvalidSchedule)
+	}
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 1 {
+		t.Errorf("GitHubIssues = %d, want the one of the tick", len(ghIssues))
+	}
+}
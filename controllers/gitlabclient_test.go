@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testGitLabProject = "platform/tools/example-operator"
+
+type fakeGitLabUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type fakeGitLabMilestone struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type fakeGitLabIssue struct {
+	IID         int                  `json:"iid"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	State       string               `json:"state"`
+	WebURL      string               `json:"web_url"`
+	UpdatedAt   string               `json:"updated_at"`
+	Labels      []string             `json:"labels"`
+	Assignees   []fakeGitLabUser     `json:"assignees"`
+	Milestone   *fakeGitLabMilestone `json:"milestone"`
+}
+
+// fakeGitLab serves the GitLab v4 issue endpoints used by GitLabClient from memory
+type fakeGitLab struct {
+	*httptest.Server
+	token      string
+	users      []fakeGitLabUser
+	milestones []fakeGitLabMilestone
+
+	mu       sync.Mutex
+	projects map[string][]*fakeGitLabIssue
+	paths    []string
+}
+
+func newFakeGitLab(t *testing.T) *fakeGitLab {
+	f := &fakeGitLab{
+		token:      "gitlab-token",
+		users:      []fakeGitLabUser{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}},
+		milestones: []fakeGitLabMilestone{{ID: 11, Title: conformanceMilestone}},
+		projects:   map[string][]*fakeGitLabIssue{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeGitLab) client(project string, token string) *GitLabClient {
+	gitLabClient := newGitLabClient(f.URL+"/api/v4", project, token, 0)
+	return &gitLabClient
+}
+
+func (f *fakeGitLab) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths = append(f.paths, req.Method+" "+req.URL.EscapedPath())
+
+	if req.Header.Get("PRIVATE-TOKEN") != f.token {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"message": "401 Unauthorized"})
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.EscapedPath(), "/api/v4")
+	if path == "/users" {
+		var found []fakeGitLabUser
+		for _, user := range f.users {
+			if user.Username == req.URL.Query().Get("username") {
+				found = append(found, user)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, append([]fakeGitLabUser{}, found...))
+		return
+	}
+
+	// /projects/{id}/milestones and /projects/{id}/issues[/{iid}], id is the escaped project path
+	parts := strings.Split(strings.TrimPrefix(path, "/projects/"), "/")
+	if !strings.HasPrefix(path, "/projects/") || len(parts) < 2 {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+		return
+	}
+	project := parts[0]
+
+	switch {
+	case parts[1] == "milestones" && req.Method == http.MethodGet:
+		var found []fakeGitLabMilestone
+		for _, milestone := range f.milestones {
+			if milestone.Title == req.URL.Query().Get("title") {
+				found = append(found, milestone)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, append([]fakeGitLabMilestone{}, found...))
+	case parts[1] == "issues" && len(parts) == 2 && req.Method == http.MethodGet:
+		issues := f.projects[project]
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+		start, end := (page-1)*perPage, page*perPage
+		if start > len(issues) {
+			start = len(issues)
+		}
+		if end > len(issues) {
+			end = len(issues)
+		}
+		writeFakeJSON(w, http.StatusOK, append([]*fakeGitLabIssue{}, issues[start:end]...))
+	case parts[1] == "issues" && len(parts) == 2 && req.Method == http.MethodPost:
+		issue := &fakeGitLabIssue{IID: len(f.projects[project]) + 1, State: "opened", Labels: []string{}, Assignees: []fakeGitLabUser{}}
+		issue.WebURL = fmt.Sprintf("https://gitlab.example.com/%s/-/issues/%d", strings.ReplaceAll(project, "%2F", "/"), issue.IID)
+		if !f.apply(w, req, issue) {
+			return
+		}
+		f.projects[project] = append(f.projects[project], issue)
+		writeFakeJSON(w, http.StatusCreated, issue)
+	case parts[1] == "issues" && len(parts) == 3:
+		iid, _ := strconv.Atoi(parts[2])
+		if iid < 1 || iid > len(f.projects[project]) {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not found"})
+			return
+		}
+		issue := f.projects[project][iid-1]
+		if req.Method == http.MethodPut && !f.apply(w, req, issue) {
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, issue)
+	case parts[1] == "issues" && len(parts) == 4 && parts[3] == "notes" && req.Method == http.MethodPost:
+		iid, _ := strconv.Atoi(parts[2])
+		if iid < 1 || iid > len(f.projects[project]) {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not found"})
+			return
+		}
+		var note map[string]string
+		json.NewDecoder(req.Body).Decode(&note)
+		writeFakeJSON(w, http.StatusCreated, map[string]interface{}{"id": 1, "body": note["body"]})
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// apply sets the fields of a create or edit request on issue, it answers 400 on a bad request
+func (f *fakeGitLab) apply(w http.ResponseWriter, req *http.Request, issue *fakeGitLabIssue) bool {
+	var request struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		StateEvent  string  `json:"state_event"`
+		Labels      *string `json:"labels"`
+		AssigneeIDs []int   `json:"assignee_ids"`
+		MilestoneID int     `json:"milestone_id"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &request); err != nil || (req.Method == http.MethodPost && (request.Title == nil || *request.Title == "")) {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "title is missing"})
+		return false
+	}
+
+	if request.Title != nil {
+		issue.Title = *request.Title
+	}
+	if request.Description != nil {
+		issue.Description = *request.Description
+	}
+	switch request.StateEvent {
+	case "close":
+		issue.State = "closed"
+	case "reopen":
+		issue.State = "opened"
+	}
+	if request.Labels != nil {
+		issue.Labels = strings.Split(*request.Labels, ",")
+	}
+	if request.AssigneeIDs != nil {
+		issue.Assignees = []fakeGitLabUser{}
+		for _, id := range request.AssigneeIDs {
+			for _, user := range f.users {
+				if user.ID == id {
+					issue.Assignees = append(issue.Assignees, user)
+				}
+			}
+		}
+	}
+	for _, milestone := range f.milestones {
+		if milestone.ID == request.MilestoneID {
+			found := milestone
+			issue.Milestone = &found
+		}
+	}
+	issue.UpdatedAt = "2021-06-01T10:00:00.000Z"
+	return true
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestGitLabClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		f := newFakeGitLab(t)
+		return f.client(testGitLabProject, f.token)
+	})
+}
+
+func TestGitLabClientAssignees(t *testing.T) {
+	f := newFakeGitLab(t)
+	ctx := context.Background()
+	gitLabClient := f.client(testGitLabProject, f.token)
+
+	created, ie := gitLabClient.Create(ctx, IssueData{Name: "assignees", Title: "assignees", Assignees: []string{"alice", "bob"}})
+	mustSucceed(t, "Create", ie)
+	if !sameStrings(created.Assignees, []string{"alice", "bob"}) {
+		t.Errorf("Create() assignees = %v, want [alice bob]", created.Assignees)
+	}
+	if want := "POST /api/v4/projects/platform%2Ftools%2Fexample-operator/issues"; f.paths[len(f.paths)-1] != want {
+		t.Errorf("last request = %q, want %q", f.paths[len(f.paths)-1], want)
+	}
+
+	created.Assignees = []string{"carol"}
+	if _, ie := gitLabClient.Update(ctx, *created); requestSucceeded(ie.Err) {
+		t.Errorf("Update() with an unknown assignee succeeded")
+	}
+}
+
+func TestGitLabClientListPages(t *testing.T) {
+	f := newFakeGitLab(t)
+	gitLabClient := f.client(testGitLabProject, f.token)
+	for i := 0; i < listPageSize+5; i++ {
+		_, ie := gitLabClient.Create(context.Background(), IssueData{Name: "pages", Title: fmt.Sprintf("issue %d", i)})
+		mustSucceed(t, "Create", ie)
+	}
+
+	issues, ie := gitLabClient.List(context.Background())
+	mustSucceed(t, "List", ie)
+	if len(issues) != listPageSize+5 {
+		t.Errorf("List() returned %d issues, want %d", len(issues), listPageSize+5)
+	}
+}
+
+func TestGitLabClientBadToken(t *testing.T) {
+	f := newFakeGitLab(t)
+
+	_, ie := f.client(testGitLabProject, "wrong-token").List(context.Background())
+	var apiErr *apiError
+	if !errors.As(ie.Err, &apiErr) || !apiErr.isAuthFailure() {
+		t.Errorf("List() error = %v, want an authentication failure", ie.Err)
+	}
+	if !strings.HasPrefix(ie.Err.Error(), "GitLab responded with status code 401") {
+		t.Errorf("List() error = %q, want it to name GitLab", ie.Err)
+	}
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const issueFinalizer = "example.training.redhat.com/finalizer"
+
+// findIssue looks for the issue of k8sBasedIssue by its title, or by the
+// occurrences section of its dedupKey. The issue recorded on the status is
+// tried first so that a sync doesn't list the whole repo, it's kept even when
+// the title was edited since.
+func (r *GitHubIssueReconciler) findIssue(ctx context.Context, ghClient GitHubClient, ghIssue examplev1alpha1.GitHubIssue, k8sBasedIssue IssueData) (bool, *IssueData, *InfoError) {
+	if ghIssue.Status.Number != 0 {
+		issue, ie := ghClient.Get(ctx, ghIssue.Status.Number)
+		if requestSucceeded(ie.Err) && (issue.Title == k8sBasedIssue.Title || (!isEmpty(issue.URL) && issue.URL == ghIssue.Status.URL)) {
+			return true, issue, ie
+		}
+	}
+
+	exist := false
+	existingIssue := &k8sBasedIssue
+
+	issues, ie := ghClient.List(ctx)
+
+	if requestSucceeded(ie.Err) {
+
+		for _, issue := range issues {
+			if issue.Title == k8sBasedIssue.Title || (!isEmpty(ghIssue.Spec.DedupKey) && strings.Contains(issue.Description, occurrencesMarker(ghIssue.Spec.DedupKey))) {
+				exist = true
+				existingIssue = &issue
+				break
+			}
+		}
+	}
+
+	return exist, existingIssue, ie
+}
+
+// recordedIssue is the issue recorded on the status. A GitHubIssue whose
+// template can't be rendered has no title to look for, so it's how its issue
+// is found when it's deleted. Nothing was filed when the status is empty.
+func (r *GitHubIssueReconciler) recordedIssue(ctx context.Context, ghClient GitHubClient, ghIssue examplev1alpha1.GitHubIssue) (bool, *IssueData, *InfoError) {
+	if ghIssue.Status.Number == 0 {
+		if isEmpty(ghIssue.Status.URL) && isEmpty(ghIssue.Status.State) {
+			return false, &IssueData{Name: ghIssue.Name}, &InfoError{}
+		}
+		ie := newInfoError(fmt.Errorf("the template can't be rendered and the status has no issue number"), fmt.Sprintf("%s - failed to find the issue to close", ghIssue.Name))
+		return false, &IssueData{Name: ghIssue.Name}, &ie
+	}
+
+	issue, ie := ghClient.Get(ctx, ghIssue.Status.Number)
+	var apiErr *apiError
+	if errors.As(ie.Err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		// the issue was deleted on the tracker, there's nothing left to close
+		return false, &IssueData{Name: ghIssue.Name}, &InfoError{}
+	}
+	if !requestSucceeded(ie.Err) {
+		return false, &IssueData{Name: ghIssue.Name}, ie
+	}
+	return true, issue, ie
+}
+
+// editIfNeeded updates the title, body, state and the set labels, assignees
+// and milestone of existingIssue when it differs from k8sBasedIssue
+func (r *GitHubIssueReconciler) editIfNeeded(ctx context.Context, ghClient GitHubClient, k8sBasedIssue IssueData, existingIssue IssueData) (*IssueData, *InfoError) {
+	if planIssue(k8sBasedIssue, existingIssue, true).Action == planNone {
+		return &existingIssue, &InfoError{}
+	}
+
+	existingIssue.Name = k8sBasedIssue.Name
+	existingIssue.Title = k8sBasedIssue.Title
+	if len(k8sBasedIssue.Labels) > 0 {
+		existingIssue.Labels = k8sBasedIssue.Labels
+	}
+	if len(k8sBasedIssue.Assignees) > 0 {
+		existingIssue.Assignees = k8sBasedIssue.Assignees
+	}
+	if !isEmpty(k8sBasedIssue.Milestone) {
+		existingIssue.Milestone = k8sBasedIssue.Milestone
+	}
+	existingIssue.Description = k8sBasedIssue.Description
+	existingIssue.State = desiredState(k8sBasedIssue)
+
+	return ghClient.Update(ctx, existingIssue)
+}
+
+// postComments posts the spec.comments that weren't posted yet in order, and
+// returns how many are posted now. A GitHubIssue without an issue posts none.
+func (r *GitHubIssueReconciler) postComments(ctx context.Context, ghClient GitHubClient, ghIssue examplev1alpha1.GitHubIssue, issue IssueData) (int, *InfoError) {
+	posted := ghIssue.Status.CommentsPosted
+	if posted >= len(ghIssue.Spec.Comments) || issue.Number == 0 {
+		return posted, &InfoError{}
+	}
+	commenter, ok := ghClient.(Commenter)
+	if !ok {
+		ie := newInfoError(fmt.Errorf("comments are %w", errNotSupported), fmt.Sprintf("%s - failed to post the comments", ghIssue.Name))
+		return posted, &ie
+	}
+
+	issue.Name = ghIssue.Name
+	for ; posted < len(ghIssue.Spec.Comments); posted++ {
+		if ie := commenter.Comment(ctx, issue, ghIssue.Spec.Comments[posted]); !requestSucceeded(ie.Err) {
+			return posted, ie
+		}
+	}
+	r.recordIssueEvent(ghIssue, reasonCommented, issue)
+	ie := newInfoError(nil, fmt.Sprintf("%s - %d comments were posted", ghIssue.Name, posted-ghIssue.Status.CommentsPosted))
+	return posted, &ie
+}
+
+// handleFinalizer registers the finalizer, and once the GitHubIssue is
+// deleted closes its issue and removes the finalizer. It returns true when
+// the reconcile must stop there. The issue is closed within syncCtx, the
+// GitHubIssue is updated within ctx.
+func (r *GitHubIssueReconciler) handleFinalizer(ctx context.Context, syncCtx context.Context, ghClient GitHubClient, ghIssue examplev1alpha1.GitHubIssue, issueExist bool, existingIssue IssueData) (bool, *InfoError) {
+	needToReturn := false
+	ie := InfoError{}
+
+	if ghIssue.ObjectMeta.DeletionTimestamp.IsZero() {
+		// The object is not being deleted, so if it does not have our finalizer,
+		// then lets add the finalizer and update the object.
+		// This is equivalent registering our finalizer. Dry-run writes nothing,
+		// not even the finalizer.
+		if !containsString(ghIssue.GetFinalizers(), issueFinalizer) && !r.isDryRun(ghIssue) {
+			controllerutil.AddFinalizer(&ghIssue, issueFinalizer)
+			if err := r.Update(ctx, &ghIssue); err != nil {
+				ie = newInfoError(err, fmt.Sprintf("%s - failed to update the finalizer", ghIssue.Name))
+				needToReturn = true
+			} else {
+				r.recordEvent(ghIssue, corev1.EventTypeNormal, reasonFinalizerAdded, fmt.Sprintf("Added finalizer %s", issueFinalizer))
+			}
+		}
+		return needToReturn, &ie
+	}
+
+	// The object is being deleted, stop reconciliation after handling it
+	needToReturn = true
+	if !containsString(ghIssue.GetFinalizers(), issueFinalizer) {
+		return needToReturn, &ie
+	}
+
+	// our finalizer is present, so lets handle any external dependency
+	// if the issue isn't on github, skip the external handle and just remove finalizer
+	if issueExist && !isEmpty(ghIssue.Spec.DedupKey) {
+		// the issue stays open while other GitHubIssues report its problem
+		reports, err := r.dedupReports(ctx, ghIssue)
+		if err != nil {
+			ie = newInfoError(err, fmt.Sprintf("%s - failed to list the reports of %s", ghIssue.Name, ghIssue.Spec.DedupKey))
+			return needToReturn, &ie
+		}
+		issueExist = len(reports) == 0
+	}
+	if issueExist && r.isDryRun(ghIssue) {
+		r.reportPlan(ghIssue, existingIssue.Title, planClosing(existingIssue))
+	} else if issueExist {
+		if ierr := ghClient.Close(syncCtx, existingIssue); ierr.Err != nil {
+			// if fail to delete the external dependency here, return with error
+			// so that it can be retried
+			ie = newInfoError(ierr.Err, fmt.Sprintf("%s - failed to delete the external dependency", ghIssue.Name))
+			r.recordFailure(ctx, &ghIssue, ie, existingIssue.URL)
+			return needToReturn, &ie
+		}
+		if existingIssue.State != "closed" {
+			r.recordIssueEvent(ghIssue, reasonClosed, existingIssue)
+		}
+	}
+
+	// remove our finalizer from the list and update it.
+	controllerutil.RemoveFinalizer(&ghIssue, issueFinalizer)
+	if err := r.Update(ctx, &ghIssue); err != nil {
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to update the list after removal our finalizer", ghIssue.Name))
+		return needToReturn, &ie
+	}
+	r.recordEvent(ghIssue, corev1.EventTypeNormal, reasonFinalizerRemoved, fmt.Sprintf("Removed finalizer %s", issueFinalizer))
+	ie = newInfoError(nil, fmt.Sprintf("%s - Issue was deleted successfully", ghIssue.Name))
+
+	return needToReturn, &ie
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	conditionTemplateRendered = "TemplateRendered"
+	// GitHub rejects issue bodies longer than this
+	maxRenderedBodySize = 65536
+)
+
+// templateData is what the title and body templates are executed against
+type templateData struct {
+	Metadata    metav1.ObjectMeta
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	Values      map[string]string
+}
+
+// safeFuncMap is the function set available to the templates.
+// It has no access to the environment, the filesystem or the clock,
+// so that the same GitHubIssue always renders to the same text.
+func safeFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      func(s string) string { return cases.Title(language.Und, cases.NoLower).String(s) },
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"quote":      func(s string) string { return fmt.Sprintf("%q", s) },
+		"indent": func(spaces int, s string) string {
+			pad := strings.Repeat(" ", spaces)
+			return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"default": func(def string, s string) string {
+			if isEmpty(s) {
+				return def
+			}
+			return s
+		},
+		"required": func(msg string, s string) (string, error) {
+			if isEmpty(s) {
+				return "", fmt.Errorf("%s", msg)
+			}
+			return s, nil
+		},
+		"toJson": func(v interface{}) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+	}
+}
+
+// renderIssue builds the issue that should exist on GitHub from the GitHubIssue spec.
+// Without a body template the title and description are used verbatim.
+func (r *GitHubIssueReconciler) renderIssue(ctx context.Context, ghIssue examplev1alpha1.GitHubIssue) (IssueData, *InfoError) {
+	k8sBasedIssue := IssueData{
+		Name:        ghIssue.Name,
+		Title:       ghIssue.Spec.Title,
+		Description: ghIssue.Spec.Description,
+		Labels:      ghIssue.Spec.Labels,
+		Assignees:   ghIssue.Spec.Assignees,
+		Milestone:   ghIssue.Spec.Milestone,
+		State:       ghIssue.Spec.State,
+	}
+	ie := InfoError{}
+
+	if ghIssue.Spec.BodyTemplate == nil {
+		return k8sBasedIssue, &ie
+	}
+
+	source, err := r.templateSource(ctx, ghIssue)
+	if err != nil {
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to load the body template", ghIssue.Name))
+		return k8sBasedIssue, &ie
+	}
+
+	data := templateData{
+		Metadata:    ghIssue.ObjectMeta,
+		Name:        ghIssue.Name,
+		Namespace:   ghIssue.Namespace,
+		Labels:      ghIssue.Labels,
+		Annotations: ghIssue.Annotations,
+		Values:      ghIssue.Spec.Values,
+	}
+
+	if k8sBasedIssue.Title, err = renderTemplate("title", ghIssue.Spec.Title, data); err != nil {
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to render the title template", ghIssue.Name))
+		return k8sBasedIssue, &ie
+	}
+	if k8sBasedIssue.Description, err = renderTemplate("body", source, data); err != nil {
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to render the body template", ghIssue.Name))
+		return k8sBasedIssue, &ie
+	}
+	if len(k8sBasedIssue.Description) > maxRenderedBodySize {
+		ie = newInfoError(fmt.Errorf("rendered body is %d bytes, the limit is %d", len(k8sBasedIssue.Description), maxRenderedBodySize),
+			fmt.Sprintf("%s - rendered body is too long", ghIssue.Name))
+	}
+
+	return k8sBasedIssue, &ie
+}
+
+func (r *GitHubIssueReconciler) templateSource(ctx context.Context, ghIssue examplev1alpha1.GitHubIssue) (string, error) {
+	bodyTemplate := ghIssue.Spec.BodyTemplate
+	if bodyTemplate.ConfigMapRef == nil {
+		return bodyTemplate.Inline, nil
+	}
+
+	ref := bodyTemplate.ConfigMapRef
+	configMap := corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ghIssue.Namespace, Name: ref.Name}, &configMap); err != nil {
+		return "", err
+	}
+	source, found := configMap.Data[ref.Key]
+	if !found && (ref.Optional == nil || !*ref.Optional) {
+		return "", fmt.Errorf("key %q not found in ConfigMap %s", ref.Key, ref.Name)
+	}
+
+	return source, nil
+}
+
+func renderTemplate(name string, source string, data templateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Funcs(safeFuncMap()).Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// renderedHash identifies the title and body sent to GitHub so that an
+// unchanged rendering can skip the PATCH request. The managed fields are only
+// hashed when set, which keeps the hash of the GitHubIssues that don't use them.
+func renderedHash(issue IssueData) string {
+	content := issue.Title + "\x00" + issue.Description
+	if len(issue.Labels) > 0 || len(issue.Assignees) > 0 || !isEmpty(issue.Milestone) {
+		content += "\x00" + strings.Join(issue.Labels, ",") + "\x00" + strings.Join(issue.Assignees, ",") + "\x00" + issue.Milestone
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func setTemplateCondition(ghIssue *examplev1alpha1.GitHubIssue, ie InfoError) {
+	condition := metav1.Condition{
+		Type:               conditionTemplateRendered,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Rendered",
+		Message:            "Title and body were rendered",
+		ObservedGeneration: ghIssue.Generation,
+	}
+	if !requestSucceeded(ie.Err) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RenderFailed"
+		condition.Message = ie.Err.Error()
+	}
+	meta.SetStatusCondition(&ghIssue.Status.Conditions, condition)
+}
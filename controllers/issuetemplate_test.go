@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func withTemplate(ghIssue *examplev1alpha1.GitHubIssue, title string, bodyTemplate examplev1alpha1.IssueTemplate) *examplev1alpha1.GitHubIssue {
+	ghIssue.Spec.Title = title
+	ghIssue.Spec.BodyTemplate = &bodyTemplate
+	ghIssue.Labels = map[string]string{"app": "api"}
+	ghIssue.Spec.Values = map[string]string{"owner": "sre"}
+	return ghIssue
+}
+
+func configMapTemplate(key string, optional bool) examplev1alpha1.IssueTemplate {
+	ref := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "templates"}, Key: key}
+	if optional {
+		ref.Optional = &optional
+	}
+	return examplev1alpha1.IssueTemplate{ConfigMapRef: ref}
+}
+
+func TestRenderIssue(t *testing.T) {
+	tests := []struct {
+		name      string
+		ghIssue   *examplev1alpha1.GitHubIssue
+		wantTitle string
+		wantBody  string
+		wantErr   string
+	}{
+		{
+			name:      "verbatim without a template",
+			ghIssue:   newTestGitHubIssue("{{ .Name }}", "{{ .Namespace }}", nil, false),
+			wantTitle: "{{ .Name }}",
+			wantBody:  "{{ .Namespace }}",
+		},
+		{
+			name:      "inline",
+			ghIssue:   withTemplate(newTestGitHubIssue("", "", nil, false), "{{ .Labels.app | upper }} is down", examplev1alpha1.IssueTemplate{Inline: "{{ .Namespace }}/{{ .Name }} owned by {{ .Values.owner }}"}),
+			wantTitle: "API is down",
+			wantBody:  "default/sample1 owned by sre",
+		},
+		{
+			name:      "config map",
+			ghIssue:   withTemplate(newTestGitHubIssue("", "", nil, false), "{{ .Name }}", configMapTemplate("body", false)),
+			wantTitle: "sample1",
+			wantBody:  "Paged sre",
+		},
+		{
+			name:      "optional key missing",
+			ghIssue:   withTemplate(newTestGitHubIssue("", "", nil, false), "{{ .Name }}", configMapTemplate("missing", true)),
+			wantTitle: "sample1",
+		},
+		{
+			name:    "key missing",
+			ghIssue: withTemplate(newTestGitHubIssue("", "", nil, false), "{{ .Name }}", configMapTemplate("missing", false)),
+			wantErr: `key "missing" not found in ConfigMap templates`,
+		},
+		{
+			name:    "invalid title",
+			ghIssue: withTemplate(newTestGitHubIssue("", "", nil, false), "{{ .Name", examplev1alpha1.IssueTemplate{Inline: "body"}),
+			wantErr: "unclosed action",
+		},
+		{
+			name:    "invalid body",
+			ghIssue: withTemplate(newTestGitHubIssue("", "", nil, false), "title", examplev1alpha1.IssueTemplate{Inline: "{{ if }}"}),
+			wantErr: "missing value for if",
+		},
+		{
+			name:    "required value",
+			ghIssue: withTemplate(newTestGitHubIssue("", "", nil, false), "title", examplev1alpha1.IssueTemplate{Inline: `{{ required "the runbook is required" .Values.runbook }}`}),
+			wantErr: "the runbook is required",
+		},
+		{
+			name:    "unknown function",
+			ghIssue: withTemplate(newTestGitHubIssue("", "", nil, false), "title", examplev1alpha1.IssueTemplate{Inline: `{{ env "GITOKEN" }}`}),
+			wantErr: `function "env" not defined`,
+		},
+		{
+			name:    "body too long",
+			ghIssue: withTemplate(newTestGitHubIssue("", "", nil, false), "title", examplev1alpha1.IssueTemplate{Inline: strings.Repeat("x", maxRenderedBodySize+1)}),
+			wantErr: "rendered body is 65537 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, tt.ghIssue, NewFakeGitHubClient(testRepo))
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: "default"},
+				Data:       map[string]string{"body": "Paged {{ .Values.owner }}"},
+			}
+			if err := r.Create(context.Background(), configMap); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ie := r.renderIssue(context.Background(), *tt.ghIssue)
+			if !isEmpty(tt.wantErr) {
+				if ie.Err == nil || !strings.Contains(ie.Err.Error(), tt.wantErr) {
+					t.Fatalf("renderIssue() error = %v, want %q", ie.Err, tt.wantErr)
+				}
+				return
+			}
+			if ie.Err != nil {
+				t.Fatalf("renderIssue() error = %v", ie.Err)
+			}
+			if got.Title != tt.wantTitle || got.Description != tt.wantBody {
+				t.Errorf("renderIssue() = %q %q, want %q %q", got.Title, got.Description, tt.wantTitle, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSafeFuncMap(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`{{ "a-b" | replace "-" "_" }}`, "a_b"},
+		{`{{ "v1.2" | trimPrefix "v" }}`, "1.2"},
+		{`{{ "a,b" | split "," | join " " }}`, "a b"},
+		{`{{ "" | default "none" }}`, "none"},
+		{`{{ "x" | default "none" }}`, "x"},
+		{`{{ "a\nb" | indent 2 }}`, "  a\n  b"},
+		{`{{ .Values | toJson }}`, `{"owner":"sre"}`},
+		{`{{ if "api-server" | hasPrefix "api" }}yes{{ end }}`, "yes"},
+		{`{{ .Values.missing }}`, ""},
+		{`{{ "élan vital of k8sAPI" | title }}`, "Élan Vital Of K8sAPI"},
+	}
+
+	for _, tt := range tests {
+		got, err := renderTemplate("test", tt.source, templateData{Values: map[string]string{"owner": "sre"}})
+		if err != nil {
+			t.Errorf("renderTemplate(%s) error = %v", tt.source, err)
+		} else if got != tt.want {
+			t.Errorf("renderTemplate(%s) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderedHash(t *testing.T) {
+	issue := IssueData{Title: "title", Description: "body"}
+	tests := []struct {
+		name     string
+		other    IssueData
+		wantSame bool
+	}{
+		{"same rendering", IssueData{Title: "title", Description: "body", State: "closed", Number: 2}, true},
+		{"title", IssueData{Title: "title2", Description: "body"}, false},
+		{"body", IssueData{Title: "title", Description: "body2"}, false},
+		{"title and body boundary", IssueData{Title: "titleb", Description: "ody"}, false},
+		{"labels", IssueData{Title: "title", Description: "body", Labels: []string{"bug"}}, false},
+		{"milestone", IssueData{Title: "title", Description: "body", Milestone: "v1"}, false},
+	}
+
+	for _, tt := range tests {
+		if same := renderedHash(issue) == renderedHash(tt.other); same != tt.wantSame {
+			t.Errorf("%s: same hash = %v, want %v", tt.name, same, tt.wantSame)
+		}
+	}
+}
+
+func TestReconcileRevertsRemoteEdits(t *testing.T) {
+	ghIssue := withTemplate(newTestGitHubIssue("", "", nil, false), "issue1", examplev1alpha1.IssueTemplate{Inline: "body of {{ .Name }}"})
+	ghClient := NewFakeGitHubClient(testRepo)
+	r, _ := newTestReconciler(t, ghIssue, ghClient)
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+	reconcile := func() {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+
+	reconcile()
+	reconcile()
+	if calls := ghClient.Calls(); strings.Join(calls, ",") != "create #1" {
+		t.Errorf("GitHub calls = %v, want no edit of an issue already in sync", calls)
+	}
+
+	// someone edits the issue on GitHub, the spec didn't change
+	edited := ghClient.Issues()[0]
+	edited.Title, edited.Description = "edited", "edited"
+	ghClient.Update(context.Background(), edited)
+	reconcile()
+	if issue := ghClient.Issues()[0]; issue.Title != "issue1" || issue.Description != "body of "+ghIssue.Name {
+		t.Errorf("issue = %+v, want the remote edit reverted", issue)
+	}
+}
+
+func TestReconcileRenderFailure(t *testing.T) {
+	ghIssue := withTemplate(newTestGitHubIssue("", "", []string{issueFinalizer}, false), "{{ .Name", examplev1alpha1.IssueTemplate{Inline: "body"})
+	ghClient := NewFakeGitHubClient(testRepo)
+	r, _ := newTestReconciler(t, ghIssue, ghClient)
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if calls := ghClient.Calls(); len(calls) != 0 {
+		t.Errorf("GitHub calls = %v, want none", calls)
+	}
+	got := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if condition := meta.FindStatusCondition(got.Status.Conditions, conditionTemplateRendered); condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("conditions = %+v, want %s false", got.Status.Conditions, conditionTemplateRendered)
+	}
+
+	// the template is dropped, its condition goes away with it
+	got.Spec.BodyTemplate = nil
+	got.Spec.Title = "issue1"
+	if err := r.Update(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	synced := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), key, &synced); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(synced.Status.Conditions, conditionTemplateRendered) != nil || !meta.IsStatusConditionTrue(synced.Status.Conditions, conditionSynced) || synced.Status.Number != 1 {
+		t.Errorf("status = %+v, want the issue synced without the %s condition", synced.Status, conditionTemplateRendered)
+	}
+}
+
+func TestReconcileRenderFailureOnDeletion(t *testing.T) {
+	tests := []struct {
+		name          string
+		ghIssue       *examplev1alpha1.GitHubIssue
+		existing      []IssueData
+		wantCalls     []string
+		wantFinalizer bool
+	}{
+		{
+			name:      "closes the issue of the status",
+			ghIssue:   withIssueStatus(newTestGitHubIssue("", "", []string{issueFinalizer}, true), 1),
+			existing:  []IssueData{{Title: "sample1", Description: "body", State: "open"}},
+			wantCalls: []string{"close #1"},
+		},
+		{
+			name:    "never filed",
+			ghIssue: newTestGitHubIssue("", "", []string{issueFinalizer}, true),
+		},
+		{
+			name:     "issue deleted on the tracker",
+			ghIssue:  withIssueStatus(newTestGitHubIssue("", "", []string{issueFinalizer}, true), 7),
+			existing: []IssueData{{Title: "sample1", Description: "body", State: "open"}},
+		},
+		{
+			name: "status without a number",
+			ghIssue: func() *examplev1alpha1.GitHubIssue {
+				ghIssue := newTestGitHubIssue("", "", []string{issueFinalizer}, true)
+				ghIssue.Status.State = "open"
+				return ghIssue
+			}(),
+			existing:      []IssueData{{Title: "sample1", Description: "body", State: "open"}},
+			wantFinalizer: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghIssue := withTemplate(tt.ghIssue, "{{ .Name", examplev1alpha1.IssueTemplate{Inline: "body"})
+			ghClient := NewFakeGitHubClient(testRepo, tt.existing...)
+			r, _ := newTestReconciler(t, ghIssue, ghClient)
+			key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			if (err != nil) != tt.wantFinalizer {
+				t.Errorf("Reconcile() error = %v, want an error only while the issue can't be found", err)
+			}
+			if calls := ghClient.Calls(); strings.Join(calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("GitHub calls = %v, want %v", calls, tt.wantCalls)
+			}
+			got := examplev1alpha1.GitHubIssue{}
+			if err := r.Get(context.Background(), key, &got); err != nil {
+				t.Fatal(err)
+			}
+			if hasFinalizer := containsString(got.Finalizers, issueFinalizer); hasFinalizer != tt.wantFinalizer {
+				t.Errorf("finalizer present = %v, want %v", hasFinalizer, tt.wantFinalizer)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	testJiraProject = "OPS"
+	testJiraRepo    = testJiraProject + "/Bug"
+)
+
+type fakeJiraStatus struct {
+	Name           string            `json:"name"`
+	StatusCategory map[string]string `json:"statusCategory"`
+}
+
+var (
+	fakeJiraToDo       = fakeJiraStatus{Name: "To Do", StatusCategory: map[string]string{"key": "new"}}
+	fakeJiraInProgress = fakeJiraStatus{Name: "In Progress", StatusCategory: map[string]string{"key": "indeterminate"}}
+	fakeJiraDone       = fakeJiraStatus{Name: "Done", StatusCategory: map[string]string{"key": "done"}}
+)
+
+type fakeJiraTransition struct {
+	ID   string         `json:"id"`
+	Name string         `json:"name"`
+	To   fakeJiraStatus `json:"to"`
+}
+
+type fakeJiraIssue struct {
+	number      int
+	issueType   string
+	summary     string
+	description string
+	status      fakeJiraStatus
+	labels      []string
+	assignee    string
+	fixVersions []string
+}
+
+// fakeJira serves the Jira REST v2 endpoints used by JiraClient from memory
+// with a To Do, In Progress, Done workflow
+type fakeJira struct {
+	*httptest.Server
+	username string
+	token    string
+	users    []string
+	versions []string
+
+	mu     sync.Mutex
+	issues []*fakeJiraIssue
+}
+
+func newFakeJira(t *testing.T) *fakeJira {
+	f := &fakeJira{
+		username: "jira-bot",
+		token:    "jira-token",
+		users:    []string{"alice", "bob"},
+		versions: []string{conformanceMilestone},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeJira) client(credentials Credentials) *JiraClient {
+	jiraClient, err := newJiraClient(f.URL, testJiraRepo, credentials, 0)
+	if err != nil {
+		panic(err)
+	}
+	return &jiraClient
+}
+
+// authorized accepts the API token of the username with basic auth, or the token alone as a personal access token
+func (f *fakeJira) authorized(req *http.Request) bool {
+	if username, password, ok := req.BasicAuth(); ok {
+		return username == f.username && password == f.token
+	}
+	return req.Header.Get("Authorization") == "Bearer "+f.token
+}
+
+func (f *fakeJira) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.authorized(req) {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string][]string{"errorMessages": {"You are not authenticated."}})
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/rest/api/2")
+	switch {
+	case path == "/search" && req.Method == http.MethodGet:
+		f.search(w, req)
+	case path == "/issue" && req.Method == http.MethodPost:
+		issue := &fakeJiraIssue{number: len(f.issues) + 1, status: fakeJiraToDo}
+		if !f.apply(w, req, issue) {
+			return
+		}
+		f.issues = append(f.issues, issue)
+		writeFakeJSON(w, http.StatusCreated, map[string]string{"id": strconv.Itoa(10000 + issue.number), "key": f.key(issue)})
+	case strings.HasPrefix(path, "/issue/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/issue/"), "/")
+		number, _ := strconv.Atoi(strings.TrimPrefix(parts[0], testJiraProject+"-"))
+		if number < 1 || number > len(f.issues) {
+			writeFakeJSON(w, http.StatusNotFound, map[string][]string{"errorMessages": {"Issue does not exist or you do not have permission to see it."}})
+			return
+		}
+		issue := f.issues[number-1]
+		switch {
+		case len(parts) == 1 && req.Method == http.MethodGet:
+			writeFakeJSON(w, http.StatusOK, f.render(issue))
+		case len(parts) == 1 && req.Method == http.MethodPut:
+			if f.apply(w, req, issue) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case len(parts) == 2 && parts[1] == "comment" && req.Method == http.MethodPost:
+			var comment map[string]string
+			json.NewDecoder(req.Body).Decode(&comment)
+			writeFakeJSON(w, http.StatusCreated, map[string]string{"id": "10100", "body": comment["body"]})
+		case len(parts) == 2 && parts[1] == "transitions" && req.Method == http.MethodGet:
+			writeFakeJSON(w, http.StatusOK, map[string][]fakeJiraTransition{"transitions": f.transitions(issue)})
+		case len(parts) == 2 && parts[1] == "transitions" && req.Method == http.MethodPost:
+			f.transition(w, req, issue)
+		default:
+			writeFakeJSON(w, http.StatusNotFound, map[string][]string{"errorMessages": {"not found"}})
+		}
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string][]string{"errorMessages": {"not found"}})
+	}
+}
+
+func (f *fakeJira) key(issue *fakeJiraIssue) string {
+	return fmt.Sprintf("%s-%d", testJiraProject, issue.number)
+}
+
+// search only understands the JQL sent by JiraClient, the issues of one project and type
+func (f *fakeJira) search(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	var matching []*fakeJiraIssue
+	for _, issue := range f.issues {
+		if strings.Contains(query.Get("jql"), fmt.Sprintf("project = %q AND issuetype = %q", testJiraProject, issue.issueType)) {
+			matching = append(matching, issue)
+		}
+	}
+
+	startAt, _ := strconv.Atoi(query.Get("startAt"))
+	maxResults, _ := strconv.Atoi(query.Get("maxResults"))
+	// Jira caps maxResults, at 50 on some instances
+	if maxResults <= 0 || maxResults > 50 {
+		maxResults = 50
+	}
+	end := startAt + maxResults
+	if startAt > len(matching) {
+		startAt = len(matching)
+	}
+	if end > len(matching) {
+		end = len(matching)
+	}
+	page := []map[string]interface{}{}
+	for _, issue := range matching[startAt:end] {
+		page = append(page, f.render(issue))
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"startAt": startAt, "maxResults": maxResults, "total": len(matching), "issues": page})
+}
+
+// apply sets the fields of a create or edit request on issue, like Jira it answers 400 on unknown values
+func (f *fakeJira) apply(w http.ResponseWriter, req *http.Request, issue *fakeJiraIssue) bool {
+	var request struct {
+		Fields struct {
+			Summary     *string `json:"summary"`
+			Description *string `json:"description"`
+			IssueType   *struct {
+				Name string `json:"name"`
+			} `json:"issuetype"`
+			Labels   []string `json:"labels"`
+			Assignee *struct {
+				Name string `json:"name"`
+			} `json:"assignee"`
+			FixVersions []struct {
+				Name string `json:"name"`
+			} `json:"fixVersions"`
+		} `json:"fields"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeFakeJSON(w, http.StatusBadRequest, map[string][]string{"errorMessages": {err.Error()}})
+		return false
+	}
+	fields := request.Fields
+	errs := map[string]string{}
+	if req.Method == http.MethodPost && (fields.Summary == nil || *fields.Summary == "") {
+		errs["summary"] = "You must specify a summary of the issue."
+	}
+	if fields.Assignee != nil && !containsString(f.users, fields.Assignee.Name) {
+		errs["assignee"] = fmt.Sprintf("User '%s' does not exist.", fields.Assignee.Name)
+	}
+	for _, version := range fields.FixVersions {
+		if !containsString(f.versions, version.Name) {
+			errs["fixVersions"] = fmt.Sprintf("Version name '%s' is not valid", version.Name)
+		}
+	}
+	if len(errs) > 0 {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]interface{}{"errorMessages": []string{}, "errors": errs})
+		return false
+	}
+
+	if fields.Summary != nil {
+		issue.summary = *fields.Summary
+	}
+	if fields.Description != nil {
+		issue.description = *fields.Description
+	}
+	if fields.IssueType != nil {
+		issue.issueType = fields.IssueType.Name
+	}
+	if fields.Labels != nil {
+		issue.labels = fields.Labels
+	}
+	if fields.Assignee != nil {
+		issue.assignee = fields.Assignee.Name
+	}
+	if fields.FixVersions != nil {
+		issue.fixVersions = nil
+		for _, version := range fields.FixVersions {
+			issue.fixVersions = append(issue.fixVersions, version.Name)
+		}
+	}
+	return true
+}
+
+// transitions of the workflow, a done issue can only be reopened
+func (f *fakeJira) transitions(issue *fakeJiraIssue) []fakeJiraTransition {
+	if issue.status.Name == fakeJiraDone.Name {
+		return []fakeJiraTransition{{ID: "41", Name: "Reopen", To: fakeJiraToDo}}
+	}
+	return []fakeJiraTransition{
+		{ID: "21", Name: "Start Progress", To: fakeJiraInProgress},
+		{ID: "31", Name: "Resolve", To: fakeJiraDone},
+	}
+}
+
+func (f *fakeJira) transition(w http.ResponseWriter, req *http.Request, issue *fakeJiraIssue) {
+	var request struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	json.Unmarshal(body, &request)
+	for _, transition := range f.transitions(issue) {
+		if transition.ID == request.Transition.ID {
+			issue.status = transition.To
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeFakeJSON(w, http.StatusBadRequest, map[string][]string{"errorMessages": {"It seems that you have tried to perform a workflow operation that is not valid."}})
+}
+
+func (f *fakeJira) render(issue *fakeJiraIssue) map[string]interface{} {
+	fields := map[string]interface{}{
+		"summary":     issue.summary,
+		"description": nil,
+		"status":      issue.status,
+		"labels":      append([]string{}, issue.labels...),
+		"assignee":    nil,
+		"fixVersions": []map[string]string{},
+		"updated":     "2021-06-01T10:00:00.000+0000",
+	}
+	if issue.description != "" {
+		fields["description"] = issue.description
+	}
+	if issue.assignee != "" {
+		fields["assignee"] = map[string]string{"name": issue.assignee}
+	}
+	for _, version := range issue.fixVersions {
+		fields["fixVersions"] = append(fields["fixVersions"].([]map[string]string), map[string]string{"name": version})
+	}
+	return map[string]interface{}{
+		"id":     strconv.Itoa(10000 + issue.number),
+		"key":    f.key(issue),
+		"self":   f.URL + "/rest/api/2/issue/" + f.key(issue),
+		"fields": fields,
+	}
+}
+
+func TestJiraClientConformance(t *testing.T) {
+	runGitHubClientConformance(t, func(t *testing.T) GitHubClient {
+		f := newFakeJira(t)
+		return f.client(Credentials{Username: f.username, Token: f.token})
+	})
+}
+
+func TestJiraClientKey(t *testing.T) {
+	f := newFakeJira(t)
+	// a personal access token is sent alone
+	jiraClient := f.client(Credentials{Token: f.token})
+
+	created, ie := jiraClient.Create(context.Background(), IssueData{Name: "key", Title: "key", Assignees: []string{"alice"}})
+	mustSucceed(t, "Create", ie)
+	if created.Key != "OPS-1" || created.Number != 1 || created.URL != f.URL+"/browse/OPS-1" {
+		t.Errorf("Create() key = %q number = %d URL = %q, want OPS-1 1 %s/browse/OPS-1", created.Key, created.Number, created.URL, f.URL)
+	}
+	if f.issues[0].issueType != "Bug" || !sameStrings(created.Assignees, []string{"alice"}) {
+		t.Errorf("created issue type = %q assignees = %v, want Bug [alice]", f.issues[0].issueType, created.Assignees)
+	}
+}
+
+func TestJiraClientRepo(t *testing.T) {
+	if _, err := NewJiraClientFactory("https://jira.example.com", 0)("jira", "OPS", Credentials{}); err == nil {
+		t.Errorf("a repo without an issue type was accepted")
+	}
+}
+
+func TestJiraClientListPages(t *testing.T) {
+	f := newFakeJira(t)
+	jiraClient := f.client(Credentials{Username: f.username, Token: f.token})
+	for i := 0; i < jiraPageSize+5; i++ {
+		_, ie := jiraClient.Create(context.Background(), IssueData{Name: "pages", Title: fmt.Sprintf("issue %d", i)})
+		mustSucceed(t, "Create", ie)
+	}
+
+	issues, ie := jiraClient.List(context.Background())
+	mustSucceed(t, "List", ie)
+	if len(issues) != jiraPageSize+5 {
+		t.Errorf("List() returned %d issues, want %d", len(issues), jiraPageSize+5)
+	}
+}
+
+func TestJiraClientBadCredentials(t *testing.T) {
+	f := newFakeJira(t)
+
+	_, ie := f.client(Credentials{Username: f.username, Token: "wrong-token"}).List(context.Background())
+	var apiErr *apiError
+	if !errors.As(ie.Err, &apiErr) || !apiErr.isAuthFailure() {
+		t.Errorf("List() error = %v, want an authentication failure", ie.Err)
+	}
+}
+
+func TestReconcileJiraAssignees(t *testing.T) {
+	ghIssue := newTestGitHubIssue("issue1", "test1", []string{issueFinalizer}, false)
+	ghIssue.Spec.Provider = examplev1alpha1.ProviderJira
+	ghIssue.Spec.Assignees = []string{"alice", "bob", "carol"}
+	ghClient := NewFakeGitHubClient(testRepo)
+	r, recorder := newTestReconciler(t, ghIssue, ghClient)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	if issues := ghClient.Issues(); len(issues) != 1 || !sameStrings(issues[0].Assignees, []string{"alice"}) {
+		t.Errorf("issues = %+v, want alice assigned", issues)
+	}
+	if calls := ghClient.Calls(); strings.Join(calls, ",") != "create #1" {
+		t.Errorf("GitHub calls = %v, want the single assignee left alone", calls)
+	}
+	if events := eventReasons(recorder); len(events) == 0 || events[0] != corev1.EventTypeWarning+" "+reasonAssigneesDropped {
+		t.Errorf("events = %v, want a %s warning", events, reasonAssigneesDropped)
+	}
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TrackFailuresAnnotation is set on a CronJob or a Job to the repo its failures are filed in
+	TrackFailuresAnnotation = "example.training.redhat.com/track-failures"
+	// TrackFailuresProviderAnnotation is the provider of that repo, github when not set
+	TrackFailuresProviderAnnotation = "example.training.redhat.com/track-failures-provider"
+
+	jobSourceLabel = "example.training.redhat.com/job"
+)
+
+// JobFailureReconciler files the failures of the Jobs and CronJobs annotated
+// with TrackFailuresAnnotation as GitHubIssues, one per CronJob or per Job
+// when it isn't run by a CronJob. The issue is closed by the next successful run.
+type JobFailureReconciler struct {
+	client.Client
+	// KubeClient reads the logs of the failed pods
+	KubeClient kubernetes.Interface
+	Log        logr.Logger
+	// LogLines is the number of log lines of the failed pod put in the issue
+	LogLines int64
+}
+
+// jobParent is what the failures of a Job are tracked against, its CronJob or itself
+type jobParent struct {
+	kind     string
+	name     string
+	schedule string
+	meta     metav1.ObjectMeta
+}
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch
+
+// Reconcile files a finished Job. Runs are ordered by creation, so a Job
+// reconciled again, or late, never undoes what a newer run did.
+func (r *JobFailureReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("job", req.NamespacedName)
+
+	var job batchv1.Job
+	if err := r.Get(ctx, req.NamespacedName, &job); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	finished, failed := jobFinished(job)
+	if !finished {
+		return ctrl.Result{}, nil
+	}
+	parent, err := r.parentOf(ctx, job)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	repo := parent.meta.Annotations[TrackFailuresAnnotation]
+	if repo == "" {
+		return ctrl.Result{}, nil
+	}
+
+	source := sourceFingerprint(strings.Join([]string{parent.kind, job.Namespace, parent.name}, "/"))
+	key := types.NamespacedName{Namespace: job.Namespace, Name: "job-" + source}
+	run := job.CreationTimestamp.UTC().Format(time.RFC3339)
+
+	if !failed {
+		return ctrl.Result{}, syncGeneratedIssue(ctx, r.Client, key, jobSourceLabel, source, false, func(ghIssue *examplev1alpha1.GitHubIssue) {
+			if ghIssue.Spec.Values == nil {
+				ghIssue.Spec.Values = map[string]string{}
+			}
+			if ghIssue.Spec.Values["lastRun"] > run {
+				return
+			}
+			ghIssue.Spec.Values["lastRun"] = run
+			ghIssue.Spec.Values["lastJob"] = job.Name
+			ghIssue.Spec.Values["consecutiveFailures"] = "0"
+			ghIssue.Spec.State = "closed"
+		})
+	}
+
+	reason := jobFailureReason(job)
+	pod, logs := r.failedPodLogs(ctx, job)
+	log.Info("the job failed", "reason", reason)
+	return ctrl.Result{}, syncGeneratedIssue(ctx, r.Client, key, jobSourceLabel, source, true, func(ghIssue *examplev1alpha1.GitHubIssue) {
+		if ghIssue.ResourceVersion == "" {
+			ghIssue.Spec = examplev1alpha1.GitHubIssueSpec{Provider: parent.meta.Annotations[TrackFailuresProviderAnnotation], Repo: repo}
+		}
+		values := ghIssue.Spec.Values
+		if values == nil {
+			values = map[string]string{}
+		}
+		if values["lastRun"] > run || (values["lastRun"] == run && values["lastJob"] != job.Name) {
+			return
+		}
+		failures, _ := strconv.Atoi(values["consecutiveFailures"])
+		if values["lastJob"] != job.Name {
+			failures++
+		}
+
+		values["lastRun"] = run
+		values["lastJob"] = job.Name
+		values["consecutiveFailures"] = strconv.Itoa(failures)
+		values["reason"] = reason
+		values["schedule"] = parent.schedule
+		ghIssue.Spec.Values = values
+		ghIssue.Spec.State = "open"
+		ghIssue.Spec.Title = fmt.Sprintf("%s %s/%s failed", parent.kind, job.Namespace, parent.name)
+		ghIssue.Spec.Description = jobFailureBody(parent, job, failures, reason, pod, logs)
+	})
+}
+
+// jobFinished is whether the Job completed or failed, and whether it failed
+func jobFinished(job batchv1.Job) (bool, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, false
+		case batchv1.JobFailed:
+			return true, true
+		}
+	}
+	return false, false
+}
+
+func jobFailureReason(job batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return strings.TrimSuffix(condition.Reason+": "+condition.Message, ": ")
+		}
+	}
+	return ""
+}
+
+// parentOf is the CronJob running the Job, or the Job itself
+func (r *JobFailureReconciler) parentOf(ctx context.Context, job batchv1.Job) (jobParent, error) {
+	parent := jobParent{kind: "Job", name: job.Name, meta: job.ObjectMeta}
+	owner := metav1.GetControllerOf(&job)
+	if owner == nil || owner.Kind != "CronJob" {
+		return parent, nil
+	}
+
+	var cronJob batchv1beta1.CronJob
+	err := r.Get(ctx, types.NamespacedName{Namespace: job.Namespace, Name: owner.Name}, &cronJob)
+	if apierrors.IsNotFound(err) {
+		return parent, nil
+	}
+	if err != nil {
+		return jobParent{}, err
+	}
+	return jobParent{kind: "CronJob", name: cronJob.Name, schedule: cronJob.Spec.Schedule, meta: cronJob.ObjectMeta}, nil
+}
+
+// failedPodLogs is the name and the logs tail of the last failed pod of the Job
+func (r *JobFailureReconciler) failedPodLogs(ctx context.Context, job batchv1.Job) (string, string) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return "", fmt.Sprintf("the pods are not available: %v", err)
+	}
+
+	var failed *corev1.Pod
+	for i, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodFailed && (failed == nil || failed.CreationTimestamp.Before(&pod.CreationTimestamp)) {
+			failed = &pods.Items[i]
+		}
+	}
+	if failed == nil || r.KubeClient == nil {
+		return "", ""
+	}
+
+	for _, status := range failed.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			pod := fmt.Sprintf("%s, container %s exited with %d", failed.Name, status.Name, terminated.ExitCode)
+			return pod, tailLogs(ctx, r.KubeClient, *failed, status.Name, r.LogLines, false)
+		}
+	}
+	return failed.Name, ""
+}
+
+func jobFailureBody(parent jobParent, job batchv1.Job, failures int, reason string, pod string, logs string) string {
+	var body strings.Builder
+	switch {
+	case parent.kind == "CronJob" && failures > 1:
+		fmt.Fprintf(&body, "The last %d runs of CronJob `%s/%s` failed.\n\n- Schedule: `%s`\n", failures, job.Namespace, parent.name, parent.schedule)
+	case parent.kind == "CronJob":
+		fmt.Fprintf(&body, "The last run of CronJob `%s/%s` failed.\n\n- Schedule: `%s`\n", job.Namespace, parent.name, parent.schedule)
+	default:
+		fmt.Fprintf(&body, "Job `%s/%s` failed.\n\n", job.Namespace, job.Name)
+	}
+	fmt.Fprintf(&body, "- Job: %s\n- Reason: %s\n", job.Name, reason)
+	if pod != "" {
+		fmt.Fprintf(&body, "- Pod: %s\n", pod)
+	}
+	if logs != "" {
+		fmt.Fprintf(&body, "\n<details><summary>Logs of the failed pod</summary>\n\n```\n%s\n```\n</details>\n", strings.TrimRight(logs, "\n"))
+	}
+	return truncate(body.String(), maxRenderedBodySize)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *JobFailureReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("jobfailure").
+		For(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var testJobStart = time.Date(2021, 6, 1, 2, 0, 0, 0, time.UTC)
+
+func newTestJobFailureReconciler(t *testing.T, objects ...client.Object) *JobFailureReconciler {
+	return &JobFailureReconciler{
+		Client:     newTestClient(t, objects...),
+		KubeClient: kubefake.NewSimpleClientset(),
+		Log:        logr.Discard(),
+	}
+}
+
+func newTestCronJob(name string, annotations map[string]string) *batchv1beta1.CronJob {
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+		Spec:       batchv1beta1.CronJobSpec{Schedule: "0 2 * * *"},
+	}
+}
+
+// newTestJob is the run of cronJob on the given day, cronJob may be empty for a standalone Job
+func newTestJob(name string, cronJob string, day int, condition batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(testJobStart.AddDate(0, 0, day)),
+		},
+	}
+	if cronJob != "" {
+		isController := true
+		job.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: cronJob, UID: types.UID(cronJob), Controller: &isController}}
+	}
+	if condition != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+	}
+	if condition == batchv1.JobFailed {
+		job.Status.Conditions[0].Reason = "BackoffLimitExceeded"
+		job.Status.Conditions[0].Message = "Job has reached the specified backoff limit"
+	}
+	return job
+}
+
+func newTestFailedJobPod(job string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job + "-x2f9q", Namespace: "default", Labels: map[string]string{"job-name": job}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "backup",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}},
+			}},
+		},
+	}
+}
+
+func TestJobFailureCronJob(t *testing.T) {
+	r := newTestJobFailureReconciler(t,
+		newTestCronJob("nightly", map[string]string{TrackFailuresAnnotation: testRepo}),
+		newTestJob("nightly-1", "nightly", 0, batchv1.JobFailed),
+		newTestJob("nightly-2", "nightly", 1, batchv1.JobFailed),
+		newTestFailedJobPod("nightly-2"),
+		newTestJob("nightly-3", "nightly", 2, batchv1.JobComplete))
+
+	reconcileRequest(t, r, "default", "nightly-1")
+	reconcileRequest(t, r, "default", "nightly-1")
+	reconcileRequest(t, r, "default", "nightly-2")
+	// a late reconcile of an older run changes nothing
+	reconcileRequest(t, r, "default", "nightly-1")
+
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 1 {
+		t.Fatalf("GitHubIssues = %+v, want one for the CronJob", ghIssues)
+	}
+	spec := ghIssues[0].Spec
+	if spec.Title != "CronJob default/nightly failed" || spec.State != "open" || spec.Repo != testRepo || spec.Values["consecutiveFailures"] != "2" {
+		t.Errorf("spec = %+v, want an open issue counting 2 failures", spec)
+	}
+	for _, want := range []string{
+		"The last 2 runs of CronJob `default/nightly` failed.",
+		"- Schedule: `0 2 * * *`",
+		"- Job: nightly-2",
+		"- Reason: BackoffLimitExceeded: Job has reached the specified backoff limit",
+		"- Pod: nightly-2-x2f9q, container backup exited with 2",
+		"fake logs",
+	} {
+		if !strings.Contains(spec.Description, want) {
+			t.Errorf("description = %q, want %q", spec.Description, want)
+		}
+	}
+
+	reconcileRequest(t, r, "default", "nightly-3")
+	reconcileRequest(t, r, "default", "nightly-2")
+	spec = listGitHubIssues(t, r.Client)[0].Spec
+	if spec.State != "closed" || spec.Values["consecutiveFailures"] != "0" {
+		t.Errorf("spec = %+v, want the issue closed by the successful run", spec)
+	}
+}
+
+func TestJobFailureJob(t *testing.T) {
+	job := newTestJob("migrate", "", 0, batchv1.JobFailed)
+	job.Annotations = map[string]string{TrackFailuresAnnotation: testRepo, TrackFailuresProviderAnnotation: examplev1alpha1.ProviderGitLab}
+	r := newTestJobFailureReconciler(t, job)
+
+	reconcileRequest(t, r, "default", "migrate")
+	ghIssues := listGitHubIssues(t, r.Client)
+	if len(ghIssues) != 1 || ghIssues[0].Spec.Title != "Job default/migrate failed" || ghIssues[0].Spec.Provider != examplev1alpha1.ProviderGitLab {
+		t.Errorf("GitHubIssues = %+v, want one on GitLab for the Job", ghIssues)
+	}
+}
+
+func TestJobFailureIgnored(t *testing.T) {
+	r := newTestJobFailureReconciler(t,
+		newTestCronJob("untracked", nil),
+		newTestJob("untracked-1", "untracked", 0, batchv1.JobFailed),
+		newTestCronJob("tracked", map[string]string{TrackFailuresAnnotation: testRepo}),
+		newTestJob("tracked-1", "tracked", 0, ""),
+		newTestJob("tracked-2", "tracked", 1, batchv1.JobComplete))
+
+	for _, name := range []string{"untracked-1", "tracked-1", "tracked-2", "deleted"} {
+		reconcileRequest(t, r, "default", name)
+	}
+	if ghIssues := listGitHubIssues(t, r.Client); len(ghIssues) != 0 {
+		t.Errorf("GitHubIssues = %+v, want none", ghIssues)
+	}
+}
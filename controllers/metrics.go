@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "githubissue"
+
+	outcomeCreated  = "created"
+	outcomeEdited   = "edited"
+	outcomeReopened = "reopened"
+	outcomeClosed   = "closed"
+	outcomeNoop     = "noop"
+	outcomePlanned  = "planned"
+	outcomeError    = "error"
+)
+
+var (
+	githubRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_requests_total",
+		Help:      "Number of requests sent to the GitHub API by method, endpoint template, status code and repo.",
+	}, []string{"method", "endpoint", "code", "repo"})
+
+	githubRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_request_duration_seconds",
+		Help:      "Latency of the requests sent to the GitHub API by method, endpoint template, status code and repo.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint", "code", "repo"})
+
+	githubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "Requests left in the current GitHub rate limit window, as reported by the last response.",
+	}, []string{"resource"})
+
+	reconcileOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_total",
+		Help:      "Number of GitHubIssue reconciles by the action taken on GitHub.",
+	}, []string{"action"})
+
+	managedIssuesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "managed_issues"),
+		"Number of GitHubIssues by repo and the state last seen on GitHub.",
+		[]string{"repo", "state"}, nil)
+
+	// numeric path segments, the owner/repo pair, the GitLab project, the Bitbucket project/repo pair and the
+	// Jira issue key are replaced to keep the endpoint label bounded
+	numberSegment        = regexp.MustCompile(`/\d+(/|$)`)
+	bitbucketRepoSegment = regexp.MustCompile(`/projects/[^/]+/repos/[^/]+`)
+	repoSegment          = regexp.MustCompile(`/repos/[^/{]+/[^/]+`)
+	projectSegment       = regexp.MustCompile(`/projects/[^/{]+`)
+	jiraKeySegment       = regexp.MustCompile(`/issue/[A-Z][A-Z0-9_]*-\d+`)
+)
+
+func init() {
+	metrics.Registry.MustRegister(githubRequests, githubRequestDuration, githubRateLimitRemaining, reconcileOutcomes)
+}
+
+// observeRequest records a GitHub API call, resp is nil when the request didn't get a response
+func observeRequest(method string, apiURL string, repo string, resp *http.Response, duration time.Duration) {
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+			resource := resp.Header.Get("X-RateLimit-Resource")
+			if isEmpty(resource) {
+				resource = "core"
+			}
+			githubRateLimitRemaining.WithLabelValues(resource).Set(float64(remaining))
+		}
+	}
+
+	endpoint := endpointTemplate(apiURL)
+	githubRequests.WithLabelValues(method, endpoint, code, repo).Inc()
+	githubRequestDuration.WithLabelValues(method, endpoint, code, repo).Observe(duration.Seconds())
+}
+
+// endpointTemplate turns https://api.github.com/repos/o/r/issues/12?state=all
+// into /repos/{owner}/{repo}/issues/{number}
+func endpointTemplate(apiURL string) string {
+	path := apiURL
+	if parsed, err := url.Parse(apiURL); err == nil {
+		path = parsed.EscapedPath()
+	}
+	path = bitbucketRepoSegment.ReplaceAllString(path, "/projects/{project}/repos/{repo}")
+	path = repoSegment.ReplaceAllString(path, "/repos/{owner}/{repo}")
+	path = projectSegment.ReplaceAllString(path, "/projects/{project}")
+	path = jiraKeySegment.ReplaceAllString(path, "/issue/{key}")
+	for numberSegment.MatchString(path) {
+		path = numberSegment.ReplaceAllString(path, "/{number}$1")
+	}
+	return strings.TrimSuffix(path, "/")
+}
+
+func observeReconcile(outcome string) {
+	reconcileOutcomes.WithLabelValues(outcome).Inc()
+}
+
+// reconcileOutcome maps the planned action to the outcome label
+func reconcileOutcome(action string) string {
+	switch action {
+	case planCreate:
+		return outcomeCreated
+	case planEdit:
+		return outcomeEdited
+	case planReopen:
+		return outcomeReopened
+	case planClose:
+		return outcomeClosed
+	}
+	return outcomeNoop
+}
+
+// deletionOutcome is the outcome of a reconcile that stopped at the finalizer handling
+func deletionOutcome(ie InfoError, issueExist bool, dryRun bool) string {
+	switch {
+	case !requestSucceeded(ie.Err):
+		return outcomeError
+	case dryRun:
+		return outcomePlanned
+	case issueExist:
+		return outcomeClosed
+	}
+	return outcomeNoop
+}
+
+// managedIssuesCollector counts the GitHubIssues from the manager's cache on every scrape
+type managedIssuesCollector struct {
+	mu     sync.RWMutex
+	client client.Reader
+}
+
+// managedIssues is registered once, every manager points it at its own cache
+var managedIssues = &managedIssuesCollector{}
+
+func (c *managedIssuesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedIssuesDesc
+}
+
+func (c *managedIssuesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c.mu.RLock()
+	reader := c.client
+	c.mu.RUnlock()
+	if reader == nil {
+		return
+	}
+
+	ghIssues := examplev1alpha1.GitHubIssueList{}
+	if err := reader.List(ctx, &ghIssues); err != nil {
+		ch <- prometheus.NewInvalidMetric(managedIssuesDesc, err)
+		return
+	}
+
+	type repoState struct{ repo, state string }
+	counts := map[repoState]int{}
+	for _, ghIssue := range ghIssues.Items {
+		state := ghIssue.Status.State
+		if isEmpty(state) {
+			state = "unknown"
+		}
+		counts[repoState{ghIssue.Spec.Repo, state}]++
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(managedIssuesDesc, prometheus.GaugeValue, float64(count), key.repo, key.state)
+	}
+}
+
+// registerManagedIssuesCollector counts the GitHubIssues of reader, the
+// collector is registered by the first call and later calls swap its reader
+func registerManagedIssuesCollector(reader client.Reader) error {
+	managedIssues.mu.Lock()
+	managedIssues.client = reader
+	managedIssues.mu.Unlock()
+
+	err := metrics.Registry.Register(managedIssues)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) && alreadyRegistered.ExistingCollector == managedIssues {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestEndpointTemplate(t *testing.T) {
+	tests := []struct {
+		apiURL string
+		want   string
+	}{
+		{"https://api.github.com/repos/o/r/issues?state=all&per_page=100&page=2", "/repos/{owner}/{repo}/issues"},
+		{"https://api.github.com/repos/o/r/issues/12", "/repos/{owner}/{repo}/issues/{number}"},
+		{"https://api.github.com/repos/o/r/issues/12/comments", "/repos/{owner}/{repo}/issues/{number}/comments"},
+		{"https://gitlab.com/api/v4/projects/o%2Fr/issues/3/notes", "/api/v4/projects/{project}/issues/{number}/notes"},
+		{"https://gitea.example.com/api/v1/repos/o/r/labels?limit=50", "/api/v1/repos/{owner}/{repo}/labels"},
+		{"https://jira.example.com/rest/api/2/issue/OPS-12/transitions", "/rest/api/{number}/issue/{key}/transitions"},
+		{"https://bitbucket.example.com/rest/api/1.0/projects/OPS/repos/r/pull-requests/4/tasks/7", "/rest/api/1.0/projects/{project}/repos/{repo}/pull-requests/{number}/tasks/{number}"},
+	}
+
+	for _, tt := range tests {
+		if got := endpointTemplate(tt.apiURL); got != tt.want {
+			t.Errorf("endpointTemplate(%s) = %s, want %s", tt.apiURL, got, tt.want)
+		}
+	}
+}
+
+func TestReconcileOutcome(t *testing.T) {
+	for action, want := range map[string]string{
+		planCreate:  outcomeCreated,
+		planEdit:    outcomeEdited,
+		planReopen:  outcomeReopened,
+		planClose:   outcomeClosed,
+		planComment: outcomeNoop,
+		planNone:    outcomeNoop,
+	} {
+		if got := reconcileOutcome(action); got != want {
+			t.Errorf("reconcileOutcome(%s) = %s, want %s", action, got, want)
+		}
+	}
+
+	failed := newInfoError(&apiError{StatusCode: 502}, "failed")
+	tests := []struct {
+		name       string
+		ie         InfoError
+		issueExist bool
+		dryRun     bool
+		want       string
+	}{
+		{"closed", InfoError{}, true, false, outcomeClosed},
+		{"no issue", InfoError{}, false, false, outcomeNoop},
+		{"dry-run", InfoError{}, true, true, outcomePlanned},
+		{"failed", failed, true, false, outcomeError},
+		{"failed in dry-run", failed, true, true, outcomeError},
+	}
+	for _, tt := range tests {
+		if got := deletionOutcome(tt.ie, tt.issueExist, tt.dryRun); got != tt.want {
+			t.Errorf("deletionOutcome(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func newManagedIssuesReader(t *testing.T, states ...string) client.Reader {
+	var ghIssues []client.Object
+	for i, state := range states {
+		ghIssue := newTestGitHubIssue("issue", "", nil, false)
+		ghIssue.Name = strings.Repeat("x", i+1)
+		ghIssue.Status.State = state
+		ghIssues = append(ghIssues, ghIssue)
+	}
+	return newTestClient(t, ghIssues...)
+}
+
+func TestManagedIssuesCollector(t *testing.T) {
+	collector := &managedIssuesCollector{client: newManagedIssuesReader(t, "open", "open", "closed", "")}
+	want := `
+# HELP githubissue_managed_issues Number of GitHubIssues by repo and the state last seen on GitHub.
+# TYPE githubissue_managed_issues gauge
+githubissue_managed_issues{repo="AlmogLevii/example-operator",state="closed"} 1
+githubissue_managed_issues{repo="AlmogLevii/example-operator",state="open"} 2
+githubissue_managed_issues{repo="AlmogLevii/example-operator",state="unknown"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterManagedIssuesCollector(t *testing.T) {
+	if err := registerManagedIssuesCollector(newManagedIssuesReader(t, "open")); err != nil {
+		t.Fatalf("first registration error = %v", err)
+	}
+	// a second manager counts its own GitHubIssues
+	if err := registerManagedIssuesCollector(newManagedIssuesReader(t, "closed", "closed")); err != nil {
+		t.Fatalf("second registration error = %v", err)
+	}
+	want := `
+# HELP githubissue_managed_issues Number of GitHubIssues by repo and the state last seen on GitHub.
+# TYPE githubissue_managed_issues gauge
+githubissue_managed_issues{repo="AlmogLevii/example-operator",state="closed"} 2
+`
+	if err := testutil.CollectAndCompare(managedIssues, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// another collector of the same metric is still rejected
+	if err := metrics.Registry.Register(&managedIssuesCollector{}); err == nil {
+		t.Error("registering another collector of the managed issues succeeded, want an error")
+	}
+}
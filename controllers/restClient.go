@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// restClient sends the JSON requests of an issue tracker API on behalf of a
+// single repo, the backends differ only by how they authorize a request
+type restClient struct {
+	// provider names the tracker in the errors, e.g. GitLab
+	provider       string
+	httpClient     http.Client
+	repo           string
+	requestTimeout time.Duration
+	authorize      func(req *http.Request)
+}
+
+// connect sends a single request, it gives up after the client's request
+// timeout or as soon as ctx is done, whichever comes first
+func (rc *restClient) connect(ctx context.Context, method string, apiURL string, jsonData []byte, desireStatusCode int, callerID string) ([]byte, *InfoError) {
+	log := ctrllog.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, rc.requestTimeout)
+	defer cancel()
+
+	client := rc.httpClient
+	req, _ := http.NewRequestWithContext(ctx, method, apiURL, bytes.NewReader(jsonData))
+	if jsonData != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rc.authorize(req)
+	start := time.Now()
+	resp, err := client.Do(req)
+	observeRequest(method, apiURL, rc.repo, resp, time.Since(start))
+	if resp != nil {
+		log.V(1).Info("API request", "method", method, "url", apiURL, "statusCode", resp.StatusCode, "duration", time.Since(start))
+	}
+	var ie InfoError
+	var body []byte
+
+	if !requestSucceeded(err) {
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to connect with %s method", callerID, method))
+	} else {
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != desireStatusCode {
+			ie = newInfoError(newAPIError(rc.provider, resp), fmt.Sprintf("%s - Actual status code: %d. \t Expected: %d", callerID, resp.StatusCode, desireStatusCode))
+		} else {
+			body, _ = ioutil.ReadAll(resp.Body)
+		}
+	}
+
+	return body, &ie
+}
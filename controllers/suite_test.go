@@ -17,13 +17,16 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
@@ -31,6 +34,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	"github.com/AlmogLevii/example-operator/controllers/fakegithub"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -40,6 +44,12 @@ import (
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var stopManager context.CancelFunc
+
+// fakeGitHub serves the GitHub API to the reconcilers under test, so the
+// suite needs neither network access nor a token
+var fakeGitHub *fakegithub.Server
+var fakeGitHubClients GitHubClientFactory
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -58,7 +68,8 @@ var _ = BeforeSuite(func() {
 		ErrorIfCRDPathMissing: true,
 	}
 
-	cfg, err := testEnv.Start()
+	var err error
+	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
@@ -71,10 +82,51 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("starting the fake GitHub API")
+	fakeGitHub = fakegithub.NewServer()
+	fakeGitHub.Token = "envtest-token"
+	realClients := NewRealGitHubClientFactory(fakeGitHub.URL, defaultRequestTimeout)
+	fakeGitHubClients = func(provider string, repo string, credentials Credentials) (GitHubClient, error) {
+		return realClients(provider, repo, Credentials{Token: fakeGitHub.Token})
+	}
+
+	By("starting the manager")
+	// a short resync stands in for the periodic sync that notices remote changes
+	syncPeriod := 2 * time.Second
+	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+		SyncPeriod:         &syncPeriod,
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&GitHubIssueReconciler{
+		Client:          k8sManager.GetClient(),
+		Log:             ctrl.Log.WithName("controllers").WithName("GitHubIssue"),
+		Scheme:          k8sManager.GetScheme(),
+		NewGitHubClient: fakeGitHubClients,
+		Recorder:        k8sManager.GetEventRecorderFor("githubissue-controller"),
+	}).SetupWithManager(k8sManager)
+	Expect(err).NotTo(HaveOccurred())
+
+	var ctx context.Context
+	ctx, stopManager = context.WithCancel(context.Background())
+	go func() {
+		defer GinkgoRecover()
+		err := k8sManager.Start(ctx)
+		Expect(err).NotTo(HaveOccurred())
+	}()
+
 }, 60)
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
+	if stopManager != nil {
+		stopManager()
+	}
+	if fakeGitHub != nil {
+		fakeGitHub.Close()
+	}
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
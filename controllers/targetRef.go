@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	conditionTargetReady = "TargetReady"
+	onReadyDelete        = "delete"
+	// the informer of a kind the manager can't list never syncs, the kind is
+	// listed once with this deadline before it is watched
+	targetProbeTimeout = 10 * time.Second
+)
+
+// checkTarget reads the target of the GitHubIssue and records whether it is
+// ready on the TargetReady condition
+func (r *GitHubIssueReconciler) checkTarget(ctx context.Context, ghIssue *examplev1alpha1.GitHubIssue) (bool, *InfoError) {
+	ref := ghIssue.Spec.TargetRef
+	gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
+	ie := InfoError{}
+	condition := metav1.Condition{
+		Type:               conditionTargetReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ghIssue.Generation,
+	}
+	target := &unstructured.Unstructured{}
+	target.SetGroupVersionKind(gvk)
+
+	// a kind the manager can't list is recorded on the condition, it is
+	// probed again on the next reconcile
+	var err error
+	probeErr := r.probeTarget(ctx, gvk)
+	if probeErr == nil {
+		if err := r.watchTarget(gvk); err != nil {
+			ie = newInfoError(err, fmt.Sprintf("%s - failed to watch %s", ghIssue.Name, gvk.Kind))
+			return false, &ie
+		}
+		err = r.Get(ctx, types.NamespacedName{Namespace: ghIssue.Namespace, Name: ref.Name}, target)
+	}
+	switch {
+	case probeErr != nil:
+		condition.Reason = "TargetUnreadable"
+		condition.Message = fmt.Sprintf("%s can't be listed: %v", gvk.Kind, probeErr)
+	case apierrors.IsNotFound(err):
+		condition.Reason = "TargetMissing"
+		condition.Message = fmt.Sprintf("%s %s does not exist", ref.Kind, ref.Name)
+	case err != nil:
+		ie = newInfoError(err, fmt.Sprintf("%s - failed to read %s %s", ghIssue.Name, ref.Kind, ref.Name))
+		return false, &ie
+	default:
+		ready, err := targetReady(target, ref.ReadyWhen)
+		if err != nil {
+			condition.Reason = "InvalidReadyWhen"
+			condition.Message = err.Error()
+		} else if ready {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "TargetReady"
+			condition.Message = fmt.Sprintf("%s %s is ready", ref.Kind, ref.Name)
+		} else {
+			condition.Reason = "TargetNotReady"
+			condition.Message = fmt.Sprintf("%s %s is not ready", ref.Kind, ref.Name)
+		}
+	}
+
+	ready := condition.Status == metav1.ConditionTrue
+	current := meta.FindStatusCondition(ghIssue.Status.Conditions, conditionTargetReady)
+	if current != nil && current.Status == condition.Status && current.Reason == condition.Reason &&
+		current.Message == condition.Message && current.ObservedGeneration == condition.ObservedGeneration {
+		return ready, &ie
+	}
+	patch := client.MergeFrom(ghIssue.DeepCopy())
+	meta.SetStatusCondition(&ghIssue.Status.Conditions, condition)
+	if err := r.Client.Status().Patch(ctx, ghIssue, patch); err != nil {
+		ie = newInfoError(err, fmt.Sprintf("%s - Falied to update status", ghIssue.Name))
+	}
+	return ready, &ie
+}
+
+// targetReady evaluates readyWhen on the target, by default it is ready once
+// its Ready condition is True
+func targetReady(target *unstructured.Unstructured, readyWhen *examplev1alpha1.ReadinessCheck) (bool, error) {
+	if readyWhen == nil {
+		conditions, _, _ := unstructured.NestedSlice(target.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if ok && condition["type"] == "Ready" {
+				return condition["status"] == string(metav1.ConditionTrue), nil
+			}
+		}
+		return false, nil
+	}
+
+	path := jsonpath.New("readyWhen").AllowMissingKeys(true)
+	if err := path.Parse(readyWhen.JSONPath); err != nil {
+		return false, fmt.Errorf("invalid jsonPath %q: %w", readyWhen.JSONPath, err)
+	}
+	var value bytes.Buffer
+	if err := path.Execute(&value, target.Object); err != nil {
+		return false, fmt.Errorf("invalid jsonPath %q: %w", readyWhen.JSONPath, err)
+	}
+	return value.String() == readyWhen.Value, nil
+}
+
+// probeTarget lists the kind of a target straight from the API server before
+// it is watched, so that a kind the manager can't read fails fast instead of
+// blocking the reconcile on an informer that never syncs
+func (r *GitHubIssueReconciler) probeTarget(ctx context.Context, gvk schema.GroupVersionKind) error {
+	r.watchLock.Lock()
+	watched := r.watchedKinds[gvk]
+	r.watchLock.Unlock()
+	if watched {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, targetProbeTimeout)
+	defer cancel()
+	targets := &unstructured.UnstructuredList{}
+	targets.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	return r.List(ctx, targets, client.Limit(1))
+}
+
+// watchTarget starts watching the kind of a target the first time it is met,
+// the GitHubIssues targeting an object are reconciled when it changes
+func (r *GitHubIssueReconciler) watchTarget(gvk schema.GroupVersionKind) error {
+	if r.controller == nil {
+		return nil
+	}
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if r.watchedKinds[gvk] {
+		return nil
+	}
+
+	target := &unstructured.Unstructured{}
+	target.SetGroupVersionKind(gvk)
+	if err := r.controller.Watch(&source.Kind{Type: target}, handler.EnqueueRequestsFromMapFunc(r.targetRequests(gvk))); err != nil {
+		return err
+	}
+	if r.watchedKinds == nil {
+		r.watchedKinds = map[schema.GroupVersionKind]bool{}
+	}
+	r.watchedKinds[gvk] = true
+	return nil
+}
+
+// targetRequests maps an object of kind gvk to the GitHubIssues targeting it
+func (r *GitHubIssueReconciler) targetRequests(gvk schema.GroupVersionKind) handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		var ghIssues examplev1alpha1.GitHubIssueList
+		if err := r.List(context.Background(), &ghIssues, client.InNamespace(object.GetNamespace())); err != nil {
+			r.Log.Error(err, "failed to list the GitHubIssues targeting an object", "kind", gvk.Kind, "name", object.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, ghIssue := range ghIssues.Items {
+			ref := ghIssue.Spec.TargetRef
+			if ref != nil && ref.Name == object.GetName() && schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind) == gvk {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}})
+			}
+		}
+		return requests
+	}
+}
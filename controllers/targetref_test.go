@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	examplev1alpha1 "github.com/AlmogLevii/example-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func withTargetRef(ghIssue *examplev1alpha1.GitHubIssue, ref examplev1alpha1.TargetReference) *examplev1alpha1.GitHubIssue {
+	ghIssue.Spec.TargetRef = &ref
+	return ghIssue
+}
+
+// reconcileTarget reconciles the GitHubIssue and returns its TargetReady condition
+func reconcileTarget(t *testing.T, r *GitHubIssueReconciler, key types.NamespacedName) *metav1.Condition {
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got := examplev1alpha1.GitHubIssue{}
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	return meta.FindStatusCondition(got.Status.Conditions, conditionTargetReady)
+}
+
+func TestReconcileTargetRef(t *testing.T) {
+	ghIssue := withTargetRef(newTestGitHubIssue("migration", "track the migration", nil, false), examplev1alpha1.TargetReference{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Name:       "migrate",
+		ReadyWhen:  &examplev1alpha1.ReadinessCheck{JSONPath: "{.status.succeeded}", Value: "1"},
+	})
+	ghClient := NewFakeGitHubClient(testRepo)
+	r, _ := newTestReconciler(t, ghIssue, ghClient)
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	condition := reconcileTarget(t, r, key)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != "TargetMissing" {
+		t.Errorf("condition = %+v, want the target missing", condition)
+	}
+	if issues := ghClient.Issues(); len(issues) != 1 || issues[0].State != "open" {
+		t.Fatalf("issues = %+v, want an open issue while the Job is missing", issues)
+	}
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "default"}}
+	if err := r.Create(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if condition := reconcileTarget(t, r, key); condition.Reason != "TargetNotReady" {
+		t.Errorf("condition = %+v, want the target not ready", condition)
+	}
+	if issues := ghClient.Issues(); issues[0].State != "open" {
+		t.Errorf("state = %q, want open while the Job runs", issues[0].State)
+	}
+
+	job.Status.Succeeded = 1
+	if err := r.Update(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if condition := reconcileTarget(t, r, key); condition.Status != metav1.ConditionTrue {
+		t.Errorf("condition = %+v, want the target ready", condition)
+	}
+	if issues := ghClient.Issues(); issues[0].State != "closed" {
+		t.Errorf("state = %q, want closed once the Job succeeded", issues[0].State)
+	}
+}
+
+// forbiddenListClient is a client whose RBAC doesn't allow listing resource
+type forbiddenListClient struct {
+	client.Client
+	resource schema.GroupResource
+}
+
+func (c forbiddenListClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if _, ok := list.(*unstructured.UnstructuredList); ok {
+		return apierrors.NewForbidden(c.resource, "", errors.New("the service account can't list it"))
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestReconcileTargetRefUnreadable(t *testing.T) {
+	ghIssue := withTargetRef(newTestGitHubIssue("migration", "track the migration", nil, false), examplev1alpha1.TargetReference{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Name:       "migrate",
+	})
+	ghClient := NewFakeGitHubClient(testRepo)
+	r, _ := newTestReconciler(t, ghIssue, ghClient)
+	r.Client = forbiddenListClient{Client: r.Client, resource: schema.GroupResource{Group: "batch", Resource: "jobs"}}
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	condition := reconcileTarget(t, r, key)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != "TargetUnreadable" {
+		t.Errorf("condition = %+v, want the target unreadable", condition)
+	}
+	if issues := ghClient.Issues(); len(issues) != 1 || issues[0].State != "open" {
+		t.Errorf("issues = %+v, want an open issue while the target can't be read", issues)
+	}
+}
+
+func TestReconcileTargetRefDelete(t *testing.T) {
+	ghIssue := withTargetRef(withIssueStatus(newTestGitHubIssue("rollout", "track the rollout", []string{issueFinalizer}, false), 1), examplev1alpha1.TargetReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       "web-1",
+		OnReady:    onReadyDelete,
+	})
+	ghClient := NewFakeGitHubClient(testRepo, IssueData{Title: "rollout", Description: "track the rollout", State: "open"})
+	r, _ := newTestReconciler(t, ghIssue, ghClient)
+	key := types.NamespacedName{Namespace: ghIssue.Namespace, Name: ghIssue.Name}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}},
+	}
+	if err := r.Create(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	if condition := reconcileTarget(t, r, key); condition.Reason != "TargetNotReady" {
+		t.Errorf("condition = %+v, want the pod not ready", condition)
+	}
+
+	pod.Status.Conditions[0].Status = corev1.ConditionTrue
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	// the fake client ignores finalizers, the issue is closed by the deletion tests
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(context.Background(), key, &examplev1alpha1.GitHubIssue{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Get() error = %v, want the GitHubIssue deleted", err)
+	}
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -26,7 +27,9 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -53,11 +56,67 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var dryRun bool
+	var githubAPIURL string
+	var gitlabAPIURL string
+	var giteaAPIURL string
+	var jiraURL string
+	var bitbucketURL string
+	var issuesDir string
+	var alertmanagerAddr string
+	var alertmanagerRoutes string
+	var cloudEventsAddr string
+	var cloudEventsRules string
+	var eventBridgeRules string
+	var crashLoopRules string
+	var crashLoopRestarts int
+	var crashLoopLogLines int64
+	var crashLoopHealthyWindow time.Duration
+	var trackJobFailures bool
+	var certExpiryRules string
+	var requestTimeout time.Duration
+	var syncTimeout time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Compute the GitHub changes and report them on the GitHubIssue status and events without sending them.")
+	flag.StringVar(&githubAPIURL, "github-api-url", "https://api.github.com",
+		"The base URL of the GitHub API, e.g. https://github.example.com/api/v3 for GitHub Enterprise.")
+	flag.StringVar(&gitlabAPIURL, "gitlab-api-url", "https://gitlab.com/api/v4",
+		"The base URL of the GitLab API used by the GitHubIssues with the gitlab provider.")
+	flag.StringVar(&giteaAPIURL, "gitea-api-url", "",
+		"The base URL of the Gitea or Forgejo API used by the GitHubIssues with the gitea provider, e.g. https://gitea.example.com/api/v1.")
+	flag.StringVar(&jiraURL, "jira-url", "",
+		"The base URL of the Jira instance used by the GitHubIssues with the jira provider, e.g. https://jira.example.com.")
+	flag.StringVar(&bitbucketURL, "bitbucket-url", "",
+		"The base URL of the Bitbucket Data Center instance used by the GitHubIssues with the bitbucket provider, e.g. https://bitbucket.example.com.")
+	flag.StringVar(&issuesDir, "issues-dir", "",
+		"Write the issues of every provider as Markdown files under this directory instead of calling the issue trackers, for disconnected clusters.")
+	flag.StringVar(&alertmanagerAddr, "alertmanager-bind-address", "",
+		"The address the Alertmanager webhook binds to, the webhook is disabled when empty.")
+	flag.StringVar(&alertmanagerRoutes, "alertmanager-routes", "",
+		"The namespace/name of the ConfigMap holding the routes of the Alertmanager webhook under routes.yaml.")
+	flag.StringVar(&cloudEventsAddr, "cloudevents-bind-address", "",
+		"The address the CloudEvents endpoint binds to, the endpoint is disabled when empty.")
+	flag.StringVar(&cloudEventsRules, "cloudevents-rules", "",
+		"The namespace/name of the ConfigMap holding the rules of the CloudEvents endpoint under rules.yaml.")
+	flag.StringVar(&eventBridgeRules, "event-bridge-rules", "",
+		"The namespace/name of the ConfigMap holding the rules, under rules.yaml, of the Events filed as GitHubIssues. The bridge is disabled when empty.")
+	flag.StringVar(&crashLoopRules, "crashloop-rules", "",
+		"The namespace/name of the ConfigMap holding the rules, under rules.yaml, of the crash looping workloads filed as GitHubIssues. The detector is disabled when empty.")
+	flag.IntVar(&crashLoopRestarts, "crashloop-restart-threshold", 3, "The number of restarts from which a crash looping or OOM killed container gets an issue.")
+	flag.Int64Var(&crashLoopLogLines, "crashloop-log-lines", 50, "The number of log lines of a crashed container or a failed Job put in its issue.")
+	flag.DurationVar(&crashLoopHealthyWindow, "crashloop-healthy-window", 30*time.Minute,
+		"How long a crash looping workload has to stay healthy before its issue is closed.")
+	flag.BoolVar(&trackJobFailures, "track-job-failures", false,
+		"File the failures of the Jobs and CronJobs annotated with "+controllers.TrackFailuresAnnotation+" as GitHubIssues.")
+	flag.StringVar(&certExpiryRules, "cert-expiry-rules", "",
+		"The namespace/name of the ConfigMap holding the rules, under rules.yaml, of the TLS Secrets whose expiring certificates are filed as GitHubIssues. The watcher is disabled when empty.")
+	flag.DurationVar(&requestTimeout, "github-request-timeout", 30*time.Second, "The timeout of a single GitHub API request.")
+	flag.DurationVar(&syncTimeout, "github-sync-timeout", 2*time.Minute, "The timeout of all the GitHub API requests of a single reconcile.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -81,17 +140,127 @@ func main() {
 		os.Exit(1)
 	}
 
+	issueTrackers := map[string]controllers.GitHubClientFactory{
+		examplev1alpha1.ProviderGitHub: controllers.NewRealGitHubClientFactory(githubAPIURL, requestTimeout),
+		examplev1alpha1.ProviderGitLab: controllers.NewGitLabClientFactory(gitlabAPIURL, requestTimeout),
+	}
+	// Gitea has no public instance, the provider is only available once its URL is configured
+	if giteaAPIURL != "" {
+		issueTrackers[examplev1alpha1.ProviderGitea] = controllers.NewGiteaClientFactory(giteaAPIURL, requestTimeout)
+	}
+	if jiraURL != "" {
+		issueTrackers[examplev1alpha1.ProviderJira] = controllers.NewJiraClientFactory(jiraURL, requestTimeout)
+	}
+	if bitbucketURL != "" {
+		issueTrackers[examplev1alpha1.ProviderBitbucket] = controllers.NewBitbucketClientFactory(bitbucketURL, requestTimeout)
+	}
+	newIssueClient := controllers.NewProviderClientFactory(issueTrackers)
+	if issuesDir != "" {
+		setupLog.Info("writing the issues to files", "dir", issuesDir)
+		newIssueClient = controllers.NewFileClientFactory(issuesDir)
+	}
+
 	if err = (&controllers.GitHubIssueReconciler{
-		Client:       mgr.GetClient(),
-		Log:          ctrl.Log.WithName("controllers").WithName("GitHubIssue"),
-		Scheme:       mgr.GetScheme(),
-		GitHubClient: &controllers.RealGitHubClient{},
+		Client:          mgr.GetClient(),
+		Log:             ctrl.Log.WithName("controllers").WithName("GitHubIssue"),
+		Scheme:          mgr.GetScheme(),
+		NewGitHubClient: newIssueClient,
+		Recorder:        mgr.GetEventRecorderFor("githubissue-controller"),
+		DryRun:          dryRun,
+		SyncTimeout:     syncTimeout,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GitHubIssue")
 		os.Exit(1)
 	}
+	if err = (&controllers.GitHubIssueDigestReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("GitHubIssueDigest"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GitHubIssueDigest")
+		os.Exit(1)
+	}
+	if err = (&controllers.GitHubIssueScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("GitHubIssueSchedule"),
+		Recorder: mgr.GetEventRecorderFor("githubissueschedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GitHubIssueSchedule")
+		os.Exit(1)
+	}
+	if eventBridgeRules != "" {
+		if err = (&controllers.EventBridgeReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("EventBridge"),
+			Rules:  configMapFlag("event-bridge-rules", eventBridgeRules),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EventBridge")
+			os.Exit(1)
+		}
+	}
+	kubeClient := kubernetes.NewForConfigOrDie(mgr.GetConfig())
+	if crashLoopRules != "" {
+		if err = (&controllers.CrashLoopReconciler{
+			Client:           mgr.GetClient(),
+			KubeClient:       kubeClient,
+			Log:              ctrl.Log.WithName("controllers").WithName("CrashLoop"),
+			Rules:            configMapFlag("crashloop-rules", crashLoopRules),
+			RestartThreshold: int32(crashLoopRestarts),
+			LogLines:         crashLoopLogLines,
+			HealthyWindow:    crashLoopHealthyWindow,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CrashLoop")
+			os.Exit(1)
+		}
+	}
+	if trackJobFailures {
+		if err = (&controllers.JobFailureReconciler{
+			Client:     mgr.GetClient(),
+			KubeClient: kubeClient,
+			Log:        ctrl.Log.WithName("controllers").WithName("JobFailure"),
+			LogLines:   crashLoopLogLines,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "JobFailure")
+			os.Exit(1)
+		}
+	}
+	if certExpiryRules != "" {
+		if err = (&controllers.CertExpiryReconciler{
+			Client:     mgr.GetClient(),
+			KubeClient: kubeClient,
+			Log:        ctrl.Log.WithName("controllers").WithName("CertExpiry"),
+			Rules:      configMapFlag("cert-expiry-rules", certExpiryRules),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CertExpiry")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if alertmanagerAddr != "" {
+		if err := mgr.Add(&controllers.AlertmanagerReceiver{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("alertmanager"),
+			BindAddress: alertmanagerAddr,
+			Routes:      configMapFlag("alertmanager-routes", alertmanagerRoutes),
+			Token:       os.Getenv("ALERTMANAGER_WEBHOOK_TOKEN"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add the Alertmanager webhook")
+			os.Exit(1)
+		}
+	}
+	if cloudEventsAddr != "" {
+		if err := mgr.Add(&controllers.CloudEventsReceiver{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("cloudevents"),
+			BindAddress: cloudEventsAddr,
+			Rules:       configMapFlag("cloudevents-rules", cloudEventsRules),
+			Token:       os.Getenv("CLOUDEVENTS_WEBHOOK_TOKEN"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add the CloudEvents endpoint")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -107,3 +276,13 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// configMapFlag parses the namespace/name value of a ConfigMap flag
+func configMapFlag(name string, value string) types.NamespacedName {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		setupLog.Error(nil, "the flag must be namespace/name", "flag", name, "value", value)
+		os.Exit(1)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+}